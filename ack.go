@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ackCallbackPrefix marks callback data produced by the Acknowledge button.
+	ackCallbackPrefix = "ack:"
+	// maxCallbackDataBytes is Telegram's limit for callback_data.
+	maxCallbackDataBytes = 64
+)
+
+// ackButton returns the Acknowledge button for a DOWN alert of monitorID.
+// The callback data names the outage by when it began, so a button pressed
+// after the monitor recovered can't acknowledge a later outage. It reports
+// false when the outage is unknown or the data does not fit into
+// callback_data.
+func ackButton(monitorID string, downSince time.Time, l messageLabels) (inlineKeyboardButton, bool) {
+	data := ackCallbackPrefix + monitorID + ":" + strconv.FormatInt(downSince.Unix(), 10)
+	if monitorID == "" || downSince.IsZero() || len(data) > maxCallbackDataBytes {
+		return inlineKeyboardButton{}, false
+	}
+	return inlineKeyboardButton{Text: l.acknowledge, CallbackData: data}, true
+}
+
+// parseAckData splits the callback data of an Acknowledge button into the
+// monitor and the start of the outage it was sent for.
+func parseAckData(data string) (monitorID string, downSince time.Time, ok bool) {
+	rest, ok := strings.CutPrefix(data, ackCallbackPrefix)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	i := strings.LastIndex(rest, ":")
+	if i <= 0 {
+		return "", time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(rest[i+1:], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return rest[:i], time.Unix(seconds, 0), true
+}
+
+// callbackUpdate is the part of a Telegram update the callback endpoint uses.
+type callbackUpdate struct {
+	CallbackQuery *struct {
+		ID   string `json:"id"`
+		Data string `json:"data"`
+		From struct {
+			Username  string `json:"username"`
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+		} `json:"from"`
+		Message *struct {
+			MessageID int64  `json:"message_id"`
+			Text      string `json:"text"`
+			// Entities carry the formatting of Text, which Telegram sends
+			// without markup.
+			Entities []json.RawMessage `json:"entities"`
+			Chat     struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			ReplyMarkup *struct {
+				InlineKeyboard [][]inlineKeyboardButton `json:"inline_keyboard"`
+			} `json:"reply_markup"`
+		} `json:"message"`
+	} `json:"callback_query"`
+}
+
+// callbackHandler receives Telegram updates for button presses. Pressing
+// Acknowledge mutes further DOWN alerts for the monitor, logs who acked and
+// edits the alert to show it. Buttons of an outage that already ended only
+// tell the user so.
+func callbackHandler(live *atomic.Pointer[config], telegram *telegramNotifier, states *downTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, client := *live.Load(), telegram.client()
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !secureCompare(r.Header.Get("X-Telegram-Bot-Api-Secret-Token"), cfg.telegramWebhookSecret) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update callbackUpdate
+		if err := json.NewDecoder(io.LimitReader(r.Body, defaultMaxPayloadBytes)).Decode(&update); err != nil {
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		// Telegram retries updates that are not answered with 2xx, so
+		// anything unexpected is acknowledged and ignored.
+		query := update.CallbackQuery
+		if query == nil || !strings.HasPrefix(query.Data, ackCallbackPrefix) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		user := query.From.Username
+		if user != "" {
+			user = "@" + user
+		} else {
+			user = strings.TrimSpace(query.From.FirstName + " " + query.From.LastName)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.requestTimeout)
+		defer cancel()
+
+		answer := cfg.messageLabels.acknowledged
+		monitorID, downSince, ok := parseAckData(query.Data)
+		if ok && states.acknowledge(monitorID, downSince, time.Now()) {
+			slog.Info("alert acknowledged", "monitor_id", monitorID, "user", user)
+			if message := query.Message; message != nil {
+				var keyboard [][]inlineKeyboardButton
+				if message.ReplyMarkup != nil {
+					keyboard = withoutAckButtons(message.ReplyMarkup.InlineKeyboard)
+				}
+				chat := client.forChat(strconv.FormatInt(message.Chat.ID, 10), 0)
+				text := message.Text + "\n\n" + fmt.Sprintf(cfg.messageLabels.acknowledgedBy, user)
+				if err := chat.editMessageText(ctx, message.MessageID, text, message.Entities, keyboard); err != nil {
+					slog.Warn("failed to mark alert as acknowledged", "monitor_id", monitorID, "error", err)
+				}
+			}
+		} else {
+			slog.Info("acknowledgement of an ended outage ignored", "monitor_id", monitorID, "user", user)
+			answer = cfg.messageLabels.alreadyRecovered
+		}
+		if err := client.answerCallbackQuery(ctx, query.ID, answer); err != nil {
+			slog.Warn("failed to answer callback query", "error", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// withoutAckButtons returns keyboard without its Acknowledge buttons,
+// dropping rows that become empty.
+func withoutAckButtons(keyboard [][]inlineKeyboardButton) [][]inlineKeyboardButton {
+	var rows [][]inlineKeyboardButton
+	for _, row := range keyboard {
+		var kept []inlineKeyboardButton
+		for _, button := range row {
+			if !strings.HasPrefix(button.CallbackData, ackCallbackPrefix) {
+				kept = append(kept, button)
+			}
+		}
+		if len(kept) > 0 {
+			rows = append(rows, kept)
+		}
+	}
+	return rows
+}
+
+// editMessageText replaces the text of messageID. The formatting is given as
+// entities, the form Telegram reports it in for received messages, which
+// stay valid when text is appended. The message keeps keyboard as its
+// inline keyboard; an empty one removes it.
+func (c *telegramClient) editMessageText(ctx context.Context, messageID int64, text string, entities []json.RawMessage, keyboard [][]inlineKeyboardButton) error {
+	payload := map[string]any{
+		"chat_id":                  c.chatID,
+		"message_id":               messageID,
+		"text":                     text,
+		"disable_web_page_preview": !c.linkPreview,
+	}
+	if len(entities) > 0 {
+		payload["entities"] = entities
+	}
+	if len(keyboard) > 0 {
+		payload["reply_markup"] = map[string]any{"inline_keyboard": keyboard}
+	}
+	return c.callAPI(ctx, "editMessageText", payload, nil)
+}
+
+// answerCallbackQuery shows text as a short notification to the user who
+// pressed the button.
+func (c *telegramClient) answerCallbackQuery(ctx context.Context, queryID, text string) error {
+	return c.callAPI(ctx, "answerCallbackQuery", map[string]any{
+		"callback_query_id": queryID,
+		"text":              text,
+	}, nil)
+}
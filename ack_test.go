@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAckData(t *testing.T) {
+	since := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		monitorID string
+		since     time.Time
+		wantOK    bool
+	}{
+		{name: "numeric ID", monitorID: "42", since: since, wantOK: true},
+		{name: "name with colon", monitorID: "db:primary", since: since, wantOK: true},
+		{name: "no outage", monitorID: "42"},
+		{name: "no monitor", since: since},
+		{name: "too long", monitorID: strings.Repeat("x", maxCallbackDataBytes), since: since},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			button, ok := ackButton(tt.monitorID, tt.since, messageLanguages["en"])
+			if ok != tt.wantOK {
+				t.Fatalf("ackButton ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			monitorID, downSince, ok := parseAckData(button.CallbackData)
+			if !ok || monitorID != tt.monitorID || !downSince.Equal(tt.since) {
+				t.Errorf("parseAckData(%q) = %q, %v, %v", button.CallbackData, monitorID, downSince, ok)
+			}
+		})
+	}
+
+	for _, data := range []string{"ack:42", "ack::1", "ack:42:soon", "other:42:1"} {
+		if _, _, ok := parseAckData(data); ok {
+			t.Errorf("parseAckData(%q) accepted invalid data", data)
+		}
+	}
+}
+
+func TestAcknowledgeOnlyCurrentOutage(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	down := testPayload(t, `{"monitor":{"id":1},"heartbeat":{"status":0}}`)
+	up := testPayload(t, `{"monitor":{"id":1},"heartbeat":{"status":1}}`)
+
+	tests := []struct {
+		name      string
+		events    []kumaPayload
+		ackSince  func(states *downTracker) time.Time
+		wantAcked bool
+	}{
+		{
+			name:      "current outage",
+			events:    []kumaPayload{down},
+			ackSince:  func(states *downTracker) time.Time { return states.downSince("1") },
+			wantAcked: true,
+		},
+		{
+			name:     "after recovery",
+			events:   []kumaPayload{down, up},
+			ackSince: func(*downTracker) time.Time { return now },
+		},
+		{
+			name:     "button of an earlier outage",
+			events:   []kumaPayload{down, up, down},
+			ackSince: func(*downTracker) time.Time { return now.Add(-time.Hour) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := newDownTracker(newMonitorStates(newMemoryStateStore()))
+			for i, event := range tt.events {
+				states.observe(event, now.Add(time.Duration(i)*time.Minute))
+			}
+			if acked := states.acknowledge("1", tt.ackSince(states), now); acked != tt.wantAcked {
+				t.Fatalf("acknowledge = %v, want %v", acked, tt.wantAcked)
+			}
+			if muted := states.muted(down, now, 0); muted != tt.wantAcked {
+				t.Errorf("muted = %v, want %v", muted, tt.wantAcked)
+			}
+		})
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	now := time.Now()
+	dashboard := inlineKeyboardButton{Text: "Dashboard", URL: "https://kuma.example.com/dashboard/1"}
+
+	tests := []struct {
+		name       string
+		down       bool
+		wantAnswer string
+		wantEdit   bool
+	}{
+		{name: "monitor is down", down: true, wantAnswer: "Acknowledged", wantEdit: true},
+		{name: "monitor recovered", wantAnswer: "Already recovered, nothing to acknowledge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTelegram(t)
+			cfg := testConfig(fake)
+			cfg.telegramWebhookSecret = "secret"
+			cfg.messageLabels = messageLanguages["en"]
+			states := newDownTracker(newMonitorStates(newMemoryStateStore()))
+			states.observe(testPayload(t, `{"monitor":{"id":7},"heartbeat":{"status":0}}`), now)
+			button, _ := ackButton("7", states.downSince("7"), cfg.messageLabels)
+			if !tt.down {
+				states.observe(testPayload(t, `{"monitor":{"id":7},"heartbeat":{"status":1}}`), now)
+			}
+
+			update := map[string]any{"callback_query": map[string]any{
+				"id":   "q1",
+				"data": button.CallbackData,
+				"from": map[string]any{"username": "alice"},
+				"message": map[string]any{
+					"message_id": 5,
+					"text":       "DOWN db",
+					"entities":   []any{map[string]any{"type": "bold", "offset": 0, "length": 4}},
+					"chat":       map[string]any{"id": 99},
+					"reply_markup": map[string]any{"inline_keyboard": [][]inlineKeyboardButton{
+						{dashboard}, {button},
+					}},
+				},
+			}}
+			body, _ := json.Marshal(update)
+			req := httptest.NewRequest(http.MethodPost, "/telegram-callback", strings.NewReader(string(body)))
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "secret")
+			rec := httptest.NewRecorder()
+			callbackHandler(liveConfig(cfg), newTelegramNotifier(cfg), states).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			answers := fake.sent("answerCallbackQuery")
+			if len(answers) != 1 || answers[0].body["text"] != tt.wantAnswer {
+				t.Errorf("answers = %v, want %q", answers, tt.wantAnswer)
+			}
+			edits := fake.sent("editMessageText")
+			if !tt.wantEdit {
+				if len(edits) != 0 {
+					t.Errorf("alert of a recovered monitor was edited: %v", edits)
+				}
+				return
+			}
+			if len(edits) != 1 {
+				t.Fatalf("got %d edits, want 1", len(edits))
+			}
+			edit := edits[0].body
+			if edit["chat_id"] != "99" || edit["text"] != "DOWN db\n\n✅ Acknowledged by @alice" {
+				t.Errorf("edit = %v", edit)
+			}
+			if entities, _ := edit["entities"].([]any); len(entities) != 1 {
+				t.Errorf("entities = %v, want the original bold entity", edit["entities"])
+			}
+			markup, _ := json.Marshal(edit["reply_markup"])
+			if want := `{"inline_keyboard":[[{"text":"Dashboard","url":"https://kuma.example.com/dashboard/1"}]]}`; string(markup) != want {
+				t.Errorf("reply_markup = %s, want %s", markup, want)
+			}
+		})
+	}
+}
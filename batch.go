@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batcher buffers deliveries and sends them as one combined message per
+// destination chat, either every interval (BATCH_INTERVAL) or once a window
+// has passed since the first buffered delivery (DIGEST_WINDOW). A destination
+// with a single buffered delivery gets the original message instead.
+type batcher struct {
+	send    func(delivery)
+	combine func([]delivery) delivery
+	window  time.Duration // zero for interval batching
+
+	mu      sync.Mutex
+	pending []delivery
+	timer   *time.Timer // pending window flush
+	ticker  *time.Ticker
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newBatcher flushes every interval.
+func newBatcher(interval time.Duration, send func(delivery), combine func([]delivery) delivery) *batcher {
+	b := &batcher{send: send, combine: combine, ticker: time.NewTicker(interval), done: make(chan struct{})}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// newWindowBatcher flushes window after the first delivery buffered since the
+// previous flush, so a burst is coalesced while a quiet chat sees no extra
+// delay beyond window.
+func newWindowBatcher(window time.Duration, send func(delivery), combine func([]delivery) delivery) *batcher {
+	return &batcher{send: send, combine: combine, window: window}
+}
+
+func (b *batcher) run() {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-b.ticker.C:
+			b.flush()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// add buffers job until the next flush.
+func (b *batcher) add(job delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, job)
+	if b.window > 0 && b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+}
+
+// flush sends everything buffered so far.
+func (b *batcher) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	for _, jobs := range groupByDestination(pending) {
+		if len(jobs) == 1 {
+			b.send(jobs[0])
+			continue
+		}
+		b.send(b.combine(jobs))
+	}
+}
+
+// close stops the ticker and sends whatever is still buffered.
+func (b *batcher) close() {
+	if b.ticker != nil {
+		b.ticker.Stop()
+		close(b.done)
+		b.wg.Wait()
+	}
+	b.flush()
+}
+
+// groupByDestination splits jobs by target chat and topic, keeping their
+// order.
+func groupByDestination(jobs []delivery) [][]delivery {
+	type destination struct {
+		chatID   string
+		threadID int64
+	}
+	var order []destination
+	groups := map[destination][]delivery{}
+	for _, job := range jobs {
+		dest := destination{job.chatID, job.threadID}
+		if _, ok := groups[dest]; !ok {
+			order = append(order, dest)
+		}
+		groups[dest] = append(groups[dest], job)
+	}
+
+	result := make([][]delivery, 0, len(order))
+	for _, dest := range order {
+		result = append(result, groups[dest])
+	}
+	return result
+}
+
+// buildBatchMessage renders a compact summary of jobs grouped by status,
+// e.g. "❌ DOWN: api, db" and "✅ UP: cdn". Every monitor is listed once per
+// status.
+func buildBatchMessage(jobs []delivery, f formatter, l messageLabels) string {
+	var statuses []string
+	names := map[string][]string{}
+	seen := map[string]bool{}
+	for _, job := range jobs {
+		name := job.monitorName
+		if name == "" {
+			name = job.monitorID
+		}
+		if name == "" || seen[job.status+"\x00"+name] {
+			continue
+		}
+		seen[job.status+"\x00"+name] = true
+		if _, ok := names[job.status]; !ok {
+			statuses = append(statuses, job.status)
+		}
+		names[job.status] = append(names[job.status], name)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("📦 " + f.bold(fmt.Sprintf(l.batchTitle, len(jobs))) + "\n")
+	for _, status := range batchStatusOrder(statuses) {
+		emoji, text := statusLabel(status, l)
+		escaped := make([]string, len(names[status]))
+		for i, name := range names[status] {
+			escaped[i] = f.escape(name)
+		}
+		builder.WriteString("\n" + emoji + " " + f.bold(text) + ": " + strings.Join(escaped, f.escape(", ")))
+	}
+	return builder.String()
+}
+
+// batchStatusOrder puts DOWN first and UP second, followed by any other
+// statuses in the order they were seen.
+func batchStatusOrder(statuses []string) []string {
+	ordered := make([]string, 0, len(statuses))
+	for _, first := range []string{"0", "1"} {
+		for _, status := range statuses {
+			if status == first {
+				ordered = append(ordered, status)
+			}
+		}
+	}
+	for _, status := range statuses {
+		if status != "0" && status != "1" {
+			ordered = append(ordered, status)
+		}
+	}
+	return ordered
+}
+
+// buildRecoveryDigest renders the "all clear" message for monitors that
+// recovered within RECOVERY_DIGEST_WINDOW, listing each monitor once.
+func buildRecoveryDigest(jobs []delivery, f formatter, l messageLabels) string {
+	var names []string
+	seen := map[string]bool{}
+	for _, job := range jobs {
+		name := job.monitorName
+		if name == "" {
+			name = job.monitorID
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(l.emojiUp + " " + f.bold(fmt.Sprintf(l.recoveryTitle, len(names))) + "\n")
+	for i, name := range names {
+		if i == maxDigestEvents {
+			builder.WriteString("\n" + f.escape(fmt.Sprintf(l.moreEvents, len(names)-i)))
+			break
+		}
+		builder.WriteString("\n" + f.escape("• ") + f.code(name))
+	}
+	return builder.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recovery returns the delivery of a recovery of monitor name to chatID.
+func recovery(name, chatID string) delivery {
+	return delivery{message: outgoingMessage{text: name + " is up"}, monitorName: name, status: "1", chatID: chatID}
+}
+
+func TestRecoveryDigest(t *testing.T) {
+	flushed := make(chan []delivery, 1)
+	combine := func(jobs []delivery) delivery {
+		text := buildRecoveryDigest(jobs, formatter{}, messageLanguages["en"])
+		return delivery{message: outgoingMessage{text: text}, chatID: jobs[0].chatID}
+	}
+	var sent []delivery
+	b := newWindowBatcher(50*time.Millisecond, func(job delivery) {
+		sent = append(sent, job)
+		if len(sent) == 2 {
+			flushed <- sent
+		}
+	}, combine)
+
+	b.add(recovery("api", "1"))
+	b.add(recovery("db", "1"))
+	b.add(recovery("api", "1"))
+	b.add(recovery("cdn", "2"))
+	var got []delivery
+	select {
+	case got = <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the window did not flush")
+	}
+
+	digest := got[0].message.text
+	if got[0].chatID != "1" || !strings.HasPrefix(digest, "✅ Recovered: 2 services\n") {
+		t.Fatalf("first message to chat %s:\n%s\nwant the digest of api and db", got[0].chatID, digest)
+	}
+	if strings.Count(digest, "api") != 1 || !strings.Contains(digest, "• db") {
+		t.Errorf("digest does not list each monitor once:\n%s", digest)
+	}
+	if got[1].chatID != "2" || got[1].message.text != "cdn is up" {
+		t.Errorf("second message %+v, want the single recovery of cdn unchanged", got[1])
+	}
+}
+
+func TestRecoveryDigestLimit(t *testing.T) {
+	var jobs []delivery
+	for i := range maxDigestEvents + 3 {
+		jobs = append(jobs, recovery(fmt.Sprintf("m%d", i), ""))
+	}
+	digest := buildRecoveryDigest(jobs, formatter{}, messageLanguages["en"])
+	if lines := strings.Count(digest, "• "); lines != maxDigestEvents {
+		t.Errorf("%d monitors listed, want %d", lines, maxDigestEvents)
+	}
+	if !strings.HasSuffix(digest, "… and 3 more") {
+		t.Errorf("digest does not end with the number left out:\n%s", digest)
+	}
+}
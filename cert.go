@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// certExpiryPattern matches the msg of Uptime Kuma's TLS expiry notifications:
+//
+//	[name][https://example.com]  certificate example.com will be expired in 7 days
+//
+// The certificate type in front of "certificate" is empty for the leaf and
+// e.g. "Intermediate" for chain certificates.
+var certExpiryPattern = regexp.MustCompile(`^\[(.*?)\]\[(.*?)\]\s*(.*?)\s*certificate\s+(.*?)\s+will be expired in (\d+) days?`)
+
+// certExpiry is a parsed TLS certificate expiry notification.
+type certExpiry struct {
+	monitorName string
+	url         string
+	certificate string // common name, prefixed by the type for chain certificates
+	days        int
+}
+
+// parseCertExpiry recognizes certificate expiry notifications. They carry no
+// heartbeat, only a msg in the format described by certExpiryPattern.
+func parseCertExpiry(payload kumaPayload) (certExpiry, bool) {
+	if payload.Heartbeat != nil {
+		return certExpiry{}, false
+	}
+	match := certExpiryPattern.FindStringSubmatch(string(payload.Msg))
+	if match == nil {
+		return certExpiry{}, false
+	}
+	days, err := strconv.Atoi(match[5])
+	if err != nil {
+		return certExpiry{}, false
+	}
+	return certExpiry{
+		monitorName: strings.TrimSpace(match[1]),
+		url:         strings.TrimSpace(match[2]),
+		certificate: strings.TrimSpace(match[3] + " " + match[4]),
+		days:        days,
+	}, true
+}
+
+// buildCertExpiryMessage renders a certificate expiry notification.
+func buildCertExpiryMessage(cert certExpiry, f formatter, l messageLabels) string {
+	var builder strings.Builder
+	builder.WriteString("🔐 " + f.bold(l.certExpiryTitle) + "\n\n")
+
+	if cert.monitorName != "" {
+		builder.WriteString("📊 " + f.bold(l.monitorName) + ": " + f.code(cert.monitorName) + "\n")
+	}
+	if cert.url != "" {
+		builder.WriteString("🔗 " + f.bold(l.url) + ": " + f.link(cert.url, cert.url) + "\n")
+	}
+	if cert.certificate != "" {
+		builder.WriteString("📜 " + f.bold(l.certificate) + ": " + f.code(cert.certificate) + "\n")
+	}
+	builder.WriteString("⏳ " + f.bold(fmt.Sprintf(l.certExpiresIn, cert.days)) + "\n")
+
+	return strings.TrimSpace(builder.String())
+}
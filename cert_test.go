@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// certExpiryPayload is the body Uptime Kuma's webhook notification posts when
+// a monitored certificate is about to expire; it has neither monitor nor
+// heartbeat.
+const certExpiryPayload = `{"heartbeat":null,"monitor":null,"msg":"[Shop][https://shop.example.com]  certificate shop.example.com will be expired in 14 days"}`
+
+func TestParseCertExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want certExpiry
+		ok   bool
+	}{
+		{
+			name: "leaf",
+			raw:  certExpiryPayload,
+			want: certExpiry{monitorName: "Shop", url: "https://shop.example.com", certificate: "shop.example.com", days: 14},
+			ok:   true,
+		},
+		{
+			name: "intermediate",
+			raw:  `{"msg":"[Shop][https://shop.example.com] Intermediate certificate R11 will be expired in 1 day"}`,
+			want: certExpiry{monitorName: "Shop", url: "https://shop.example.com", certificate: "Intermediate R11", days: 1},
+			ok:   true,
+		},
+		{name: "heartbeat", raw: `{"heartbeat":{"status":0},"msg":"[Shop][https://shop.example.com]  certificate shop.example.com will be expired in 14 days"}`},
+		{name: "other message", raw: `{"msg":"[Shop] [🔴 Down] timeout"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCertExpiry(testPayload(t, tt.raw))
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseCertExpiry = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCertExpiryMessage(t *testing.T) {
+	opts := messageOptions{labels: messageLanguages["en"]}
+	text, _ := buildTelegramMessage(testPayload(t, certExpiryPayload), []byte(certExpiryPayload), opts)
+	for _, want := range []string{"🔐 Uptime Kuma Certificate Expiry", "Shop", "https://shop.example.com", "Certificate: shop.example.com", "expires in 14 days"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("message does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, messageLanguages["en"].notificationTitle) {
+		t.Errorf("certificate notice rendered as a generic notification:\n%s", text)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// chatLocks serializes sends per chat while letting different chats proceed
+// in parallel. Waiters for a chat are queued explicitly and handed the lock
+// in the order they arrived, so messages for the same chat are delivered in
+// the order they started waiting.
+type chatLocks struct {
+	mu    sync.Mutex
+	chats map[string]*chatQueue
+}
+
+// chatQueue is the lock of a single chat. It exists only while the lock is
+// held; waiters are closed one at a time to pass the lock on.
+type chatQueue struct {
+	waiters []chan struct{}
+}
+
+func newChatLocks() *chatLocks {
+	return &chatLocks{chats: make(map[string]*chatQueue)}
+}
+
+// lock blocks until the caller holds the lock for chatID or ctx is done. The
+// returned function releases the lock to the next waiter.
+func (l *chatLocks) lock(ctx context.Context, chatID string) (func(), error) {
+	l.mu.Lock()
+	queue, held := l.chats[chatID]
+	if !held {
+		l.chats[chatID] = &chatQueue{}
+		l.mu.Unlock()
+		return func() { l.release(chatID) }, nil
+	}
+	turn := make(chan struct{})
+	queue.waiters = append(queue.waiters, turn)
+	l.mu.Unlock()
+
+	select {
+	case <-turn:
+		return func() { l.release(chatID) }, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if i := slices.Index(queue.waiters, turn); i >= 0 {
+			queue.waiters = slices.Delete(queue.waiters, i, i+1)
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		l.mu.Unlock()
+		// The lock was handed over while ctx expired; pass it on.
+		l.release(chatID)
+		return nil, ctx.Err()
+	}
+}
+
+// release hands the lock of chatID to its oldest waiter, or frees it.
+func (l *chatLocks) release(chatID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	queue := l.chats[chatID]
+	if len(queue.waiters) == 0 {
+		delete(l.chats, chatID)
+		return
+	}
+	next := queue.waiters[0]
+	queue.waiters = queue.waiters[1:]
+	close(next)
+}
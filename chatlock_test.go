@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waiting returns how many callers are queued for chatID.
+func (l *chatLocks) waiting(chatID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if queue, ok := l.chats[chatID]; ok {
+		return len(queue.waiters)
+	}
+	return 0
+}
+
+// waitFor polls until cond holds or fails the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestChatLocksFIFO(t *testing.T) {
+	locks := newChatLocks()
+	unlock, err := locks.lock(context.Background(), "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const waiters = 20
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := locks.lock(context.Background(), "chat")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			release()
+		}()
+		waitFor(t, func() bool { return locks.waiting("chat") == i+1 })
+	}
+	unlock()
+	wg.Wait()
+
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("lock order = %v, want ascending", order)
+		}
+	}
+	if len(locks.chats) != 0 {
+		t.Errorf("%d chats still tracked after every lock was released", len(locks.chats))
+	}
+}
+
+func TestChatLocksCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		chatID string
+		cancel bool
+		want   error
+	}{
+		{name: "other chat proceeds", chatID: "other"},
+		{name: "same chat gives up when cancelled", chatID: "chat", cancel: true, want: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locks := newChatLocks()
+			unlock, _ := locks.lock(context.Background(), "chat")
+			defer unlock()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			release, err := locks.lock(ctx, tt.chatID)
+			if err != tt.want {
+				t.Fatalf("lock error = %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				release()
+			}
+			if n := locks.waiting("chat"); n != 0 {
+				t.Errorf("%d waiters left queued", n)
+			}
+		})
+	}
+}
+
+func TestSendMessageKeepsChatOrder(t *testing.T) {
+	fake := newFakeTelegram(t)
+	client := newTelegramClient(testConfig(fake))
+
+	// Hold the chat so every send queues up before any is delivered.
+	unlock, _ := client.chatLocks.lock(context.Background(), client.chatID)
+	const messages = 10
+	var wg sync.WaitGroup
+	for i := range messages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.sendMessage(context.Background(), outgoingMessage{text: fmt.Sprint(i)}); err != nil {
+				t.Error(err)
+			}
+		}()
+		waitFor(t, func() bool { return client.chatLocks.waiting(client.chatID) == i+1 })
+	}
+	unlock()
+	wg.Wait()
+
+	calls := fake.sent("sendMessage")
+	if len(calls) != messages {
+		t.Fatalf("got %d messages, want %d", len(calls), messages)
+	}
+	for i, call := range calls {
+		if call.body["text"] != fmt.Sprint(i) {
+			t.Fatalf("message %d has text %v, want %d", i, call.body["text"], i)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// commit is the source revision, injected with -ldflags "-X main.commit=...".
+var commit = "unknown"
+
+// buildDate is when the binary was built, injected with
+// -ldflags "-X main.buildDate=...".
+var buildDate = "unknown"
+
+// envFlag is a command-line flag that mirrors an environment variable.
+type envFlag struct {
+	name, env, usage string
+}
+
+var envFlags = []envFlag{
+	{"listen-addr", "LISTEN_ADDR", "listen address, overriding LISTEN_ADDR"},
+	{"bot-token", "TELEGRAM_BOT_TOKEN", "Telegram bot token, overriding TELEGRAM_BOT_TOKEN"},
+	{"chat-id", "TELEGRAM_CHAT_ID", "Telegram chat ID, overriding TELEGRAM_CHAT_ID"},
+	{"webhook-token", "WEBHOOK_AUTH_TOKEN", "webhook bearer token, overriding WEBHOOK_AUTH_TOKEN"},
+	{"timeout", "REQUEST_TIMEOUT", "outbound request timeout such as 10s, overriding REQUEST_TIMEOUT"},
+	{"profile", "PROFILE", "CONFIG_FILE profile to use, overriding PROFILE"},
+}
+
+// registerEnvFlags defines a flag for each entry of envFlags.
+func registerEnvFlags(fs *flag.FlagSet) {
+	for _, f := range envFlags {
+		fs.String(f.name, "", f.usage)
+	}
+}
+
+// applyEnvFlags copies the envFlags given on the command line into env, so
+// they take precedence over the environment and .env when loadConfig reads
+// it.
+func applyEnvFlags(fs *flag.FlagSet, env settings) {
+	fs.Visit(func(set *flag.Flag) {
+		index := slices.IndexFunc(envFlags, func(f envFlag) bool { return f.name == set.Name })
+		if index >= 0 {
+			env[envFlags[index].env] = set.Value.String()
+		}
+	})
+}
+
+// printVersion writes the build version, commit and date to out.
+func printVersion(out io.Writer) {
+	fmt.Fprintf(out, "%s %s (commit %s, built %s)\n", serviceName, version, commit, buildDate)
+}
+
+// checkConfig reports the loaded configuration to out and, when Telegram is
+// enabled, verifies the bot token with getMe, so deployments can be
+// validated without starting the server.
+func checkConfig(cfg config, out io.Writer) error {
+	fmt.Fprintf(out, "configuration OK (notifiers: %v)\n", cfg.notifiers)
+	for _, warning := range cfg.warnings {
+		fmt.Fprintf(out, "warning: %s\n", warning)
+	}
+	if !slices.Contains(cfg.notifiers, notifierTelegram) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.requestTimeout)
+	defer cancel()
+	bot, err := newTelegramClient(cfg).getMe(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "telegram bot @%s (id %d)\n", bot.Username, bot.ID)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvFlagPrecedence(t *testing.T) {
+	dotEnv := filepath.Join(t.TempDir(), ".env")
+	content := "TELEGRAM_CHAT_ID=from-dotenv\nREQUEST_TIMEOUT=3s\nLISTEN_ADDR=:7000\n"
+	if err := os.WriteFile(dotEnv, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	required := []string{"TELEGRAM_BOT_TOKEN=" + testBotToken, "WEBHOOK_AUTH_TOKEN=" + testWebhookToken}
+
+	tests := []struct {
+		name        string
+		environ     []string
+		args        []string
+		wantChatID  string
+		wantTimeout time.Duration
+		wantListen  string
+	}{
+		{name: ".env only", wantChatID: "from-dotenv", wantTimeout: 3 * time.Second, wantListen: ":7000"},
+		{name: "env over .env", environ: []string{"TELEGRAM_CHAT_ID=from-env", "REQUEST_TIMEOUT=4s"}, wantChatID: "from-env", wantTimeout: 4 * time.Second, wantListen: ":7000"},
+		{name: "flag over env", environ: []string{"TELEGRAM_CHAT_ID=from-env"}, args: []string{"-chat-id", "from-flag"}, wantChatID: "from-flag", wantTimeout: 3 * time.Second, wantListen: ":7000"},
+		{name: "flag over .env", args: []string{"-timeout=5s", "-listen-addr", ":9000"}, wantChatID: "from-dotenv", wantTimeout: 5 * time.Second, wantListen: ":9000"},
+		{name: "env kept when its flag is not set", environ: []string{"TELEGRAM_CHAT_ID=from-env", "LISTEN_ADDR=:8000"}, args: []string{"-timeout", "6s"}, wantChatID: "from-env", wantTimeout: 6 * time.Second, wantListen: ":8000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := environSettings(append(tt.environ, required...))
+			if err := env.loadDotEnv(dotEnv); err != nil {
+				t.Fatal(err)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			registerEnvFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			applyEnvFlags(fs, env)
+
+			cfg, err := loadConfig(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.telegramChatID != tt.wantChatID || cfg.requestTimeout != tt.wantTimeout || cfg.listenAddr != tt.wantListen {
+				t.Errorf("chat %q, timeout %s, listen %q; want %q, %s, %q", cfg.telegramChatID, cfg.requestTimeout, cfg.listenAddr, tt.wantChatID, tt.wantTimeout, tt.wantListen)
+			}
+		})
+	}
+}
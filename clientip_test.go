@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseNetworks("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		unix       bool
+		headers    map[string]string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.5:4000", want: "203.0.113.5"},
+		{name: "untrusted peer can't spoof", remoteAddr: "203.0.113.5:4000", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "203.0.113.5"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:4000", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "1.2.3.4"},
+		{name: "right-most untrusted hop", remoteAddr: "10.1.2.3:4000", headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 192.168.1.1"}, want: "1.2.3.4"},
+		{name: "malformed hop", remoteAddr: "10.1.2.3:4000", headers: map[string]string{"X-Forwarded-For": "junk, 10.9.9.9"}, want: "10.9.9.9"},
+		{name: "real IP", remoteAddr: "10.1.2.3:4000", headers: map[string]string{"X-Real-IP": "1.2.3.4"}, want: "1.2.3.4"},
+		{name: "unix socket forwarded", remoteAddr: "@", unix: true, headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, want: "1.2.3.4"},
+		{name: "unix socket real IP", remoteAddr: "", unix: true, headers: map[string]string{"X-Real-IP": "2001:db8::1"}, want: "2001:db8::1"},
+		{name: "unix socket without headers", remoteAddr: "@", unix: true, want: "@"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if tt.unix {
+				addr := &net.UnixAddr{Name: "/run/bot.sock", Net: "unix"}
+				r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, addr))
+			}
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settingScope says when a change to a setting takes effect.
+type settingScope int
+
+const (
+	restartOnly settingScope = iota + 1 // after a restart
+	reloadable                          // on the next SIGHUP reload
+)
+
+// settingTable lists every environment variable CONFIG_FILE may set and
+// when a change to it takes effect. configSettings and reloadableSettings
+// are derived from it.
+var settingTable = map[string]settingScope{
+	"ACK_MUTE_TIMEOUT":              reloadable,
+	"ALLOWED_SOURCE_CIDRS":          reloadable,
+	"ASYNC_DELIVERY":                restartOnly,
+	"AUTH_ALLOW_HEADER":             reloadable,
+	"AUTH_ALLOW_QUERY":              reloadable,
+	"AUTH_MODE":                     reloadable,
+	"BATCH_INTERVAL":                restartOnly,
+	"COMPACT_DATA_MAX_INLINE":       reloadable,
+	"DEAD_LETTER_PATH":              restartOnly,
+	"DEDUP_KEY_FIELDS":              restartOnly,
+	"DEDUP_WINDOW":                  restartOnly,
+	"DEFAULT_MONITOR_NAME":          reloadable,
+	"DELIVERY_SEMANTICS":            restartOnly,
+	"DIGEST_WINDOW":                 restartOnly,
+	"DISPLAY_TIMEZONE":              reloadable,
+	"ECHO_MODE":                     restartOnly,
+	"EMOJI_DOWN":                    reloadable,
+	"EMOJI_TEST":                    reloadable,
+	"EMOJI_UP":                      reloadable,
+	"ENABLE_ACK_BUTTON":             restartOnly,
+	"FLAP_COOLDOWN":                 restartOnly,
+	"FLAP_THRESHOLD":                restartOnly,
+	"FLAP_WINDOW":                   restartOnly,
+	"FORWARD_URL":                   restartOnly,
+	"HTTP_USER_AGENT":               restartOnly,
+	"IMPORTANT_ONLY":                reloadable,
+	"LINK_PREVIEW":                  reloadable,
+	"LISTEN_ADDR":                   restartOnly,
+	"LOCALE":                        reloadable,
+	"LOG_FORMAT":                    restartOnly,
+	"LOG_LEVEL":                     restartOnly,
+	"LOG_RAW_PAYLOAD":               reloadable,
+	"LOG_URL_TEMPLATE":              reloadable,
+	"MAX_PAYLOAD_BYTES":             reloadable,
+	"MAX_TELEGRAM_CONCURRENCY":      restartOnly,
+	"MESSAGE_LANG":                  reloadable,
+	"MESSAGE_LANGUAGE":              reloadable,
+	"MESSAGE_TEMPLATE_FILE":         reloadable,
+	"MESSAGE_TITLE":                 reloadable,
+	"NOTIFIER":                      restartOnly,
+	"OUTBOUND_USER_AGENT":           restartOnly,
+	"PIN_DOWN_MESSAGES":             restartOnly,
+	"QUEUE_DELIVERY_TIMEOUT":        restartOnly,
+	"QUEUE_DELIVERY_TIMEOUT_EXTEND": restartOnly,
+	"QUEUE_MAX_RETRIES":             restartOnly,
+	"QUEUE_RETRY_BACKOFF":           restartOnly,
+	"QUEUE_SIZE":                    restartOnly,
+	"QUEUE_WORKERS":                 restartOnly,
+	"QUIET_HOURS":                   restartOnly,
+	"QUIET_HOURS_BREAKTHROUGH":      restartOnly,
+	"QUIET_HOURS_TZ":                restartOnly,
+	"RATE_LIMIT_BURST":              reloadable,
+	"RATE_LIMIT_PER_MINUTE":         reloadable,
+	"RATE_LIMIT_RPS":                reloadable,
+	"RATE_LIMIT_SCOPE":              reloadable,
+	"RECOVERY_DIGEST_WINDOW":        restartOnly,
+	"REQUEST_TIMEOUT":               restartOnly,
+	"ROUTING_CONFIG_PATH":           reloadable,
+	"SHOW_PORT_FOR_HTTP":            reloadable,
+	"SHOW_RELATIVE_TIME":            reloadable,
+	"SHOW_TREND":                    restartOnly,
+	"SHOW_UNMEASURED_PING":          reloadable,
+	"SLACK_WEBHOOK_URL":             restartOnly,
+	"SPOOL_DIR":                     restartOnly,
+	"SPOOL_MAX_AGE":                 restartOnly,
+	"SPOOL_RETRY_INTERVAL":          restartOnly,
+	"STATE_FILE":                    restartOnly,
+	"STATSD_ADDR":                   restartOnly,
+	"STATSD_PREFIX":                 restartOnly,
+	"STRICT_PAYLOAD":                reloadable,
+	"SUPPRESS_ORPHAN_RECOVERY":      reloadable,
+	"SUPPRESS_REPEATED_RECOVERY":    reloadable,
+	"TELEGRAM_API_BASE_URL":         reloadable,
+	"TELEGRAM_BOT_TOKEN":            reloadable,
+	"TELEGRAM_CALLBACK_PATH":        restartOnly,
+	"TELEGRAM_CA_FILE":              reloadable,
+	"TELEGRAM_CHAT_ID":              reloadable,
+	"TELEGRAM_FALLBACK_CHAT_ID":     restartOnly,
+	"TELEGRAM_MESSAGE_THREAD_ID":    reloadable,
+	"TELEGRAM_PARSE_MODE":           reloadable,
+	"TELEGRAM_PROXY_URL":            reloadable,
+	"TELEGRAM_THREAD_ID":            reloadable,
+	"TELEGRAM_WEBHOOK_SECRET":       reloadable,
+	"TEMPLATE_PATH":                 reloadable,
+	"TERSE_WHEN_MINIMAL":            reloadable,
+	"TIME_FORMAT":                   reloadable,
+	"TLS_ALLOWED_CLIENT_CNS":        restartOnly,
+	"TLS_CERT_FILE":                 restartOnly,
+	"TLS_CLIENT_CA_FILE":            restartOnly,
+	"TLS_KEY_FILE":                  restartOnly,
+	"TRUSTED_PROXY_CIDRS":           reloadable,
+	"UNIX_SOCKET_MODE":              restartOnly,
+	"UPTIME_KUMA_BASE_URL":          reloadable,
+	"VERBOSE_TEST_RESPONSE":         reloadable,
+	"WEBHOOK_AUTH_TOKEN":            reloadable,
+	"WEBHOOK_AUTH_TOKENS":           reloadable,
+	"WEBHOOK_HMAC_SECRET":           reloadable,
+	"WEBHOOK_PATH":                  restartOnly,
+	"WEBHOOK_PATHS":                 restartOnly,
+}
+
+var configSettings, reloadableSettings = func() (all, reload map[string]bool) {
+	all, reload = make(map[string]bool), make(map[string]bool)
+	for name, scope := range settingTable {
+		all[name] = true
+		reload[name] = scope == reloadable
+	}
+	return all, reload
+}()
+
+// configFile is a parsed CONFIG_FILE. It is a small, strict subset of YAML:
+// top-level "key: value" settings named like their environment variables
+// (in either case), and a routing_rules list in the format of the routing
+// config:
+//
+//	telegram_chat_id: "-1001234567890"
+//	dedup_window: 5m
+//	routing_rules:
+//	  - monitor: "team-a-*"
+//	    chat_id: -1009876543210
+//	    active_days: [mon, tue, wed, thu, fri]
+//
+// A profiles map holds further sections of settings and routing rules, one
+// per environment, of which PROFILE selects one to merge over the base:
+//
+//	profiles:
+//	  prod:
+//	    telegram_chat_id: "-1001111111111"
+//	  dev:
+//	    log_level: debug
+type configFile struct {
+	path string
+	configSection
+	profiles map[string]*configSection
+	applied  []string // settings taken from the file because the environment lacked them
+}
+
+// configSection holds the settings and routing rules of the base file or of
+// one profile.
+type configSection struct {
+	settings     map[string]fileSetting
+	routingRules []fileRule
+}
+
+func newConfigSection() *configSection {
+	return &configSection{settings: make(map[string]fileSetting)}
+}
+
+type fileSetting struct {
+	value string
+	line  int
+}
+
+type fileRule struct {
+	fields map[string]any
+	line   int
+}
+
+// loadConfigFile reads and parses the config file at path.
+func loadConfigFile(path string) (*configFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseConfigFile(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	file.path = path
+	return file, nil
+}
+
+func parseConfigFile(content []byte) (*configFile, error) {
+	file := &configFile{configSection: *newConfigSection()}
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+
+	// section receives the settings, at sectionIndent: the base file at 0
+	// or, inside profiles, the profile last named at profileIndent.
+	section, sectionIndent := &file.configSection, 0
+	inProfiles, profileIndent := false, 0
+	inRules := false
+	// itemIndent is the indentation of the current rule's keys; 0 until
+	// the first key after a bare "-" sets it.
+	itemIndent, dashIndent := 0, 0
+	for i, raw := range strings.Split(string(content), "\n") {
+		line := i + 1
+		text := strings.TrimRight(raw, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", line)
+		}
+		indent := len(text) - len(trimmed)
+
+		if indent == 0 {
+			section, sectionIndent = &file.configSection, 0
+			inProfiles, inRules = false, false
+		}
+		if inProfiles && !(inRules && indent > sectionIndent) {
+			if profileIndent == 0 {
+				profileIndent = indent
+			}
+			switch {
+			case indent == profileIndent:
+				key, value, err := splitConfigLine(trimmed)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				if value != "" {
+					return nil, fmt.Errorf("line %d: profile %s must hold settings, one per indented line", line, key)
+				}
+				if _, ok := file.profiles[key]; ok {
+					return nil, fmt.Errorf("line %d: profile %s is defined twice", line, key)
+				}
+				section, sectionIndent = newConfigSection(), 0
+				file.profiles[key] = section
+				inRules = false
+				continue
+			case section != &file.configSection && indent > profileIndent && (sectionIndent == 0 || indent == sectionIndent):
+				sectionIndent = indent
+				inRules = false
+			default:
+				return nil, fmt.Errorf("line %d: unexpected indentation", line)
+			}
+		}
+
+		if indent == sectionIndent {
+			key, value, err := splitConfigLine(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if strings.EqualFold(key, "profiles") && section == &file.configSection {
+				if value != "" || file.profiles != nil {
+					return nil, fmt.Errorf("line %d: profiles must be given once, as a map of profile names to settings", line)
+				}
+				file.profiles = make(map[string]*configSection)
+				inProfiles, profileIndent = true, 0
+				continue
+			}
+			if strings.EqualFold(key, "routing_rules") {
+				if value != "" || section.routingRules != nil {
+					return nil, fmt.Errorf("line %d: routing_rules must be given once, as a list of rules", line)
+				}
+				section.routingRules = []fileRule{}
+				inRules = true
+				itemIndent, dashIndent = 0, 0
+				continue
+			}
+			name := strings.ToUpper(key)
+			if !configSettings[name] {
+				return nil, fmt.Errorf("line %d: unknown setting %q", line, key)
+			}
+			if _, ok := section.settings[name]; ok {
+				return nil, fmt.Errorf("line %d: %s is set twice", line, key)
+			}
+			scalar, err := parseConfigValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, key, err)
+			}
+			if _, isList := scalar.([]any); isList {
+				return nil, fmt.Errorf("line %d: %s: lists are only allowed in routing_rules; use a comma-separated string", line, key)
+			}
+			section.settings[name] = fileSetting{value: fmt.Sprint(scalar), line: line}
+			continue
+		}
+
+		if !inRules || indent < sectionIndent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line)
+		}
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok && (item == "" || item[0] == ' ') {
+			section.routingRules = append(section.routingRules, fileRule{fields: make(map[string]any), line: line})
+			item = strings.TrimLeft(item, " ")
+			if item == "" {
+				itemIndent, dashIndent = 0, indent
+				continue
+			}
+			itemIndent = len(text) - len(item)
+			trimmed, indent = item, itemIndent
+		}
+		if itemIndent == 0 && len(section.routingRules) > 0 && indent > dashIndent {
+			itemIndent = indent
+		}
+		if len(section.routingRules) == 0 || indent != itemIndent {
+			return nil, fmt.Errorf("line %d: routing_rules entries must look like \"- monitor: ...\" with their keys aligned", line)
+		}
+		key, value, err := splitConfigLine(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		parsed, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, key, err)
+		}
+		fields := section.routingRules[len(section.routingRules)-1].fields
+		if _, ok := fields[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", line, key)
+		}
+		fields[key] = parsed
+	}
+	return file, nil
+}
+
+// splitConfigLine splits "key: value", dropping a trailing comment.
+func splitConfigLine(text string) (key, value string, err error) {
+	key, value, ok := strings.Cut(text, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \"'") {
+		return "", "", errors.New("expected \"key: value\"")
+	}
+	if value != "" && value[0] != ' ' {
+		return "", "", errors.New("expected a space after the colon")
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+var configInteger = regexp.MustCompile(`^-?[0-9]+$`)
+
+// parseConfigValue parses a scalar or a flow list such as [mon, tue].
+// Quoted scalars are strings; unquoted integers and booleans keep their type
+// so routing rules decode like their JSON counterparts.
+func parseConfigValue(value string) (any, error) {
+	if value == "" {
+		return nil, errors.New("value is missing; quote an empty string as \"\"")
+	}
+	if inner, ok := strings.CutPrefix(value, "["); ok {
+		inner, ok = strings.CutSuffix(stripConfigComment(inner), "]")
+		if !ok {
+			return nil, errors.New("list is missing its closing ]")
+		}
+		items := []any{}
+		if strings.TrimSpace(inner) == "" {
+			return items, nil
+		}
+		for _, item := range strings.Split(inner, ",") {
+			parsed, err := parseConfigScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, parsed)
+		}
+		return items, nil
+	}
+	return parseConfigScalar(value)
+}
+
+func parseConfigScalar(value string) (any, error) {
+	switch {
+	case value == "":
+		return nil, errors.New("empty list item")
+	case value[0] == '"':
+		end := strings.LastIndex(value, "\"")
+		if end == 0 || strings.TrimSpace(stripConfigComment(value[end+1:])) != "" {
+			return nil, fmt.Errorf("malformed quoted string %s", value)
+		}
+		unquoted, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed quoted string %s", value)
+		}
+		return unquoted, nil
+	case value[0] == '\'':
+		end := strings.LastIndex(value, "'")
+		if end == 0 || strings.TrimSpace(stripConfigComment(value[end+1:])) != "" {
+			return nil, fmt.Errorf("malformed quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:end], "''", "'"), nil
+	}
+
+	value = strings.TrimSpace(stripConfigComment(value))
+	switch {
+	case strings.ContainsRune("|>&*!{%@`", rune(value[0])):
+		// YAML syntax outside the subset, such as block scalars, anchors
+		// and aliases, is rejected rather than read as a plain string.
+		return nil, fmt.Errorf("unsupported YAML syntax %s; quote the value if it is meant literally", value)
+	case configInteger.MatchString(value):
+		return json.Number(value), nil
+	case value == "true" || value == "false":
+		return value == "true", nil
+	}
+	return value, nil
+}
+
+// stripConfigComment removes a " #" comment from an unquoted value.
+func stripConfigComment(value string) string {
+	if index := strings.Index(value, " #"); index >= 0 {
+		return value[:index]
+	}
+	return value
+}
+
+// selectProfile merges the named profile over the base settings: its
+// settings override those of the base and its routing_rules, when given,
+// replace the base list. An empty name keeps the base alone.
+func (f *configFile) selectProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := f.profiles[name]
+	if !ok {
+		if len(f.profiles) == 0 {
+			return fmt.Errorf("%s defines no profiles", f.path)
+		}
+		return fmt.Errorf("%s has no profile %q (profiles: %s)", f.path, name, strings.Join(slices.Sorted(maps.Keys(f.profiles)), ", "))
+	}
+	maps.Copy(f.settings, profile.settings)
+	if profile.routingRules != nil {
+		f.routingRules = profile.routingRules
+	}
+	return nil
+}
+
+// apply copies the settings env doesn't already define into it, so
+// environment variables and .env take precedence over the file.
+func (f *configFile) apply(env settings) {
+	for name, setting := range f.settings {
+		if _, ok := env[name]; ok {
+			continue
+		}
+		env[name] = setting.value
+		f.applied = append(f.applied, name)
+	}
+}
+
+// annotate points a configuration error at the line of the file setting it
+// is about, when the setting came from the file.
+func (f *configFile) annotate(err error) error {
+	msg := err.Error()
+	for _, name := range f.applied {
+		if regexp.MustCompile(`\b` + name + `\b`).MatchString(msg) {
+			return fmt.Errorf("%w (%s line %d)", err, f.path, f.settings[name].line)
+		}
+	}
+	return err
+}
+
+// rules decodes and validates the routing rules with the same strictness as
+// ROUTING_CONFIG_PATH.
+func (f *configFile) rules(location *time.Location) ([]routeRule, error) {
+	rules := make([]routeRule, 0, len(f.routingRules))
+	for _, entry := range f.routingRules {
+		content, err := json.Marshal(entry.fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", f.path, entry.line, err)
+		}
+		var rule routeRule
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rule); err != nil {
+			return nil, fmt.Errorf("%s line %d: routing rule: %w", f.path, entry.line, err)
+		}
+		if err := rule.validate(location); err != nil {
+			return nil, fmt.Errorf("%s line %d: routing rule: %w", f.path, entry.line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantSettings map[string]string
+		wantRules    []map[string]any
+		wantProfiles map[string]map[string]string
+		wantErr      string // substring of the error; empty means success
+	}{
+		{
+			name:         "keys in either case",
+			content:      "dedup_window: 5m\nLOG_LEVEL: debug\n",
+			wantSettings: map[string]string{"DEDUP_WINDOW": "5m", "LOG_LEVEL": "debug"},
+		},
+		{
+			name:         "byte order mark and CRLF",
+			content:      "\ufeffdedup_window: 5m\r\nlog_level: info\r\n",
+			wantSettings: map[string]string{"DEDUP_WINDOW": "5m", "LOG_LEVEL": "info"},
+		},
+		{
+			name:         "double quotes",
+			content:      `message_title: "Kuma \"prod\" # not a comment"` + "\n",
+			wantSettings: map[string]string{"MESSAGE_TITLE": `Kuma "prod" # not a comment`},
+		},
+		{
+			name:         "single quotes",
+			content:      "message_title: 'it''s down' # comment\n",
+			wantSettings: map[string]string{"MESSAGE_TITLE": "it's down"},
+		},
+		{
+			name:         "quoted YAML indicator",
+			content:      `message_title: "*title"` + "\n",
+			wantSettings: map[string]string{"MESSAGE_TITLE": "*title"},
+		},
+		{
+			name:         "quoted empty string",
+			content:      `default_monitor_name: ""` + "\n",
+			wantSettings: map[string]string{"DEFAULT_MONITOR_NAME": ""},
+		},
+		{
+			name:         "comments",
+			content:      "# header\n\n  # indented comment\nlog_level: debug # trailing\nmessage_title: a#b\n",
+			wantSettings: map[string]string{"LOG_LEVEL": "debug", "MESSAGE_TITLE": "a#b"},
+		},
+		{
+			name: "routing rules",
+			content: "routing_rules:\n" +
+				"  - monitor: \"team-a-*\"\n" +
+				"    chat_id: -100123\n" +
+				"    active_days: [mon, fri]\n" +
+				"  -\n" +
+				"    monitor: db\n" +
+				"    active_hours: '09:00-18:00'\n",
+			wantSettings: map[string]string{},
+			wantRules: []map[string]any{
+				{"monitor": "team-a-*", "chat_id": json.Number("-100123"), "active_days": []any{"mon", "fri"}},
+				{"monitor": "db", "active_hours": "09:00-18:00"},
+			},
+		},
+		{
+			name: "profiles",
+			content: "dedup_window: 5m\n" +
+				"profiles:\n" +
+				"  dev:\n" +
+				"    dedup_window: 1m\n" +
+				"    log_format: text\n" +
+				"  prod:\n" +
+				"      telegram_chat_id: \"-100123\"\n" +
+				"message_title: Kuma\n",
+			wantSettings: map[string]string{"DEDUP_WINDOW": "5m", "MESSAGE_TITLE": "Kuma"},
+			wantProfiles: map[string]map[string]string{
+				"dev":  {"DEDUP_WINDOW": "1m", "LOG_FORMAT": "text"},
+				"prod": {"TELEGRAM_CHAT_ID": "-100123"},
+			},
+		},
+		{name: "unknown key", content: "telegram_chat: 1\n", wantErr: `line 1: unknown setting "telegram_chat"`},
+		{name: "key set twice", content: "log_level: info\nLOG_LEVEL: debug\n", wantErr: "line 2: LOG_LEVEL is set twice"},
+		{name: "missing value", content: "log_level:\n", wantErr: "line 1: log_level: value is missing"},
+		{name: "no space after colon", content: "log_level:debug\n", wantErr: "line 1: expected a space after the colon"},
+		{name: "not a key value pair", content: "log_level debug\n", wantErr: `line 1: expected "key: value"`},
+		{name: "unterminated quote", content: "message_title: \"kuma\n", wantErr: "line 1: message_title: malformed quoted string"},
+		{name: "text after quote", content: "message_title: \"kuma\" prod\n", wantErr: "malformed quoted string"},
+		{name: "list outside rules", content: "webhook_paths: [/a, /b]\n", wantErr: "lists are only allowed in routing_rules"},
+		{name: "unclosed list", content: "routing_rules:\n  - active_days: [mon, tue\n", wantErr: "line 2: active_days: list is missing its closing ]"},
+		{name: "block scalar", content: "message_title: |\n", wantErr: "line 1: message_title: unsupported YAML syntax |"},
+		{name: "alias", content: "message_title: *title\n", wantErr: "unsupported YAML syntax *title"},
+		{name: "flow mapping", content: "routing_rules:\n  - monitor: {a: 1}\n", wantErr: "line 2: monitor: unsupported YAML syntax"},
+		{name: "second document", content: "log_level: info\n---\n", wantErr: `line 2: expected "key: value"`},
+		{name: "nested setting", content: "log_level: info\n  log_format: json\n", wantErr: "line 2: unexpected indentation"},
+		{name: "tab indentation", content: "routing_rules:\n\t- monitor: db\n", wantErr: "line 2: indent with spaces, not tabs"},
+		{name: "rule keys misaligned", content: "routing_rules:\n  - monitor: db\n      chat_id: 1\n", wantErr: "line 3: routing_rules entries must look like"},
+		{name: "rule key before item", content: "routing_rules:\n    monitor: db\n", wantErr: "line 2: routing_rules entries must look like"},
+		{name: "rules with a value", content: "routing_rules: []\n", wantErr: "line 1: routing_rules must be given once"},
+		{name: "rules twice", content: "routing_rules:\n  - monitor: a\nrouting_rules:\n", wantErr: "line 3: routing_rules must be given once"},
+		{name: "rule key twice", content: "routing_rules:\n  - monitor: a\n    monitor: b\n", wantErr: "line 3: monitor is set twice"},
+		{name: "profiles with a value", content: "profiles: prod\n", wantErr: "line 1: profiles must be given once"},
+		{name: "profiles twice", content: "profiles:\n  dev:\nprofiles:\n", wantErr: "line 3: profiles must be given once"},
+		{name: "profile with a value", content: "profiles:\n  prod: true\n", wantErr: "line 2: profile prod must hold settings"},
+		{name: "profile twice", content: "profiles:\n  prod:\n    log_level: info\n  prod:\n", wantErr: "line 4: profile prod is defined twice"},
+		{name: "profile setting twice", content: "profiles:\n  prod:\n    log_level: info\n    log_level: debug\n", wantErr: "line 4: log_level is set twice"},
+		{name: "unknown profile setting", content: "profiles:\n  prod:\n    chat: 1\n", wantErr: `line 3: unknown setting "chat"`},
+		{name: "profile settings misaligned", content: "profiles:\n  prod:\n    log_level: info\n      log_format: json\n", wantErr: "line 4: unexpected indentation"},
+		{name: "nested profiles", content: "profiles:\n  prod:\n    profiles:\n", wantErr: `line 3: unknown setting "profiles"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parseConfigFile([]byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sectionValues(&file.configSection); !reflect.DeepEqual(got, tt.wantSettings) {
+				t.Errorf("settings = %v, want %v", got, tt.wantSettings)
+			}
+			var rules []map[string]any
+			for _, rule := range file.routingRules {
+				rules = append(rules, rule.fields)
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("routing rules = %v, want %v", rules, tt.wantRules)
+			}
+			var profiles map[string]map[string]string
+			for name, profile := range file.profiles {
+				if profiles == nil {
+					profiles = make(map[string]map[string]string)
+				}
+				profiles[name] = sectionValues(profile)
+			}
+			if !reflect.DeepEqual(profiles, tt.wantProfiles) {
+				t.Errorf("profiles = %v, want %v", profiles, tt.wantProfiles)
+			}
+		})
+	}
+}
+
+// sectionValues returns the values of the settings in section.
+func sectionValues(section *configSection) map[string]string {
+	values := make(map[string]string)
+	for name, setting := range section.settings {
+		values[name] = setting.value
+	}
+	return values
+}
+
+func TestConfigFileRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: "routing_rules:\n  - monitor: db\n    chat_id: 5\n"},
+		{name: "unknown field", content: "routing_rules:\n  - monitor: db\n    chat: 5\n", wantErr: `line 2: routing rule: json: unknown field "chat"`},
+		{name: "missing chat and schedule", content: "routing_rules:\n  - monitor: db\n", wantErr: "line 2: routing rule: chat_id or a schedule is required"},
+		{name: "wrong type", content: "routing_rules:\n  - monitor: db\n    chat_id: 5\n    thread_id: abc\n", wantErr: "line 2: routing rule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parseConfigFile([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.path = "config.yaml"
+			rules, err := file.rules(nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(rules) != 1 || rules[0].chatID != "5" {
+				t.Errorf("rules = %+v, %v; want one rule for chat 5", rules, err)
+			}
+		})
+	}
+}
+
+func TestSettingTable(t *testing.T) {
+	for name := range reloadableSettings {
+		if !configSettings[name] {
+			t.Errorf("reloadable setting %s is not a config setting", name)
+		}
+	}
+	if len(configSettings) != len(settingTable) {
+		t.Errorf("%d config settings, want %d", len(configSettings), len(settingTable))
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "dedup_window: 5m\n" +
+		"log_level: info\n" +
+		"routing_rules:\n" +
+		"  - monitor: base\n" +
+		"    chat_id: 10\n" +
+		"profiles:\n" +
+		"  dev:\n" +
+		"    log_level: debug\n" +
+		"    telegram_chat_id: \"2\"\n" +
+		"  prod:\n" +
+		"    quiet_hours: \"23:00-07:00\"\n" +
+		"    routing_rules:\n" +
+		"      - monitor: \"team-a-*\"\n" +
+		"        chat_id: 20\n" +
+		"      - monitor: db\n" +
+		"        chat_id: 21\n" +
+		"    dedup_window: 1m\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile   string
+		chatID    string
+		logLevel  slog.Level
+		dedup     time.Duration
+		quiet     bool
+		ruleChats []string
+	}{
+		{profile: "", chatID: "1", logLevel: slog.LevelInfo, dedup: 5 * time.Minute, ruleChats: []string{"10"}},
+		{profile: "dev", chatID: "2", logLevel: slog.LevelDebug, dedup: 5 * time.Minute, ruleChats: []string{"10"}},
+		{profile: "prod", chatID: "1", logLevel: slog.LevelInfo, dedup: time.Minute, quiet: true, ruleChats: []string{"20", "21"}},
+	}
+	for _, tt := range tests {
+		t.Run("profile "+tt.profile, func(t *testing.T) {
+			env := testSettings(map[string]string{"CONFIG_FILE": path, "PROFILE": tt.profile})
+			// The file supplies the chat ID unless the environment does.
+			if tt.profile == "dev" {
+				delete(env, "TELEGRAM_CHAT_ID")
+			}
+			cfg, err := loadConfig(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.telegramChatID != tt.chatID || cfg.logLevel != tt.logLevel || cfg.dedupWindow != tt.dedup || (cfg.quietHours != nil) != tt.quiet {
+				t.Errorf("chat %s, log level %v, dedup %v, quiet hours %v; want %s, %v, %v, %v",
+					cfg.telegramChatID, cfg.logLevel, cfg.dedupWindow, cfg.quietHours != nil, tt.chatID, tt.logLevel, tt.dedup, tt.quiet)
+			}
+			var ruleChats []string
+			for _, rule := range cfg.routingRules {
+				ruleChats = append(ruleChats, rule.chatID)
+			}
+			if !slices.Equal(ruleChats, tt.ruleChats) {
+				t.Errorf("routing rule chats = %v, want %v", ruleChats, tt.ruleChats)
+			}
+		})
+	}
+
+	t.Run("profile flag", func(t *testing.T) {
+		env := testSettings(map[string]string{"CONFIG_FILE": path, "PROFILE": "dev"})
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		registerEnvFlags(fs)
+		if err := fs.Parse([]string{"-profile", "prod"}); err != nil {
+			t.Fatal(err)
+		}
+		applyEnvFlags(fs, env)
+		cfg, err := loadConfig(env)
+		if err != nil || cfg.dedupWindow != time.Minute {
+			t.Errorf("dedup %v, %v; want prod's 1m", cfg.dedupWindow, err)
+		}
+	})
+	t.Run("environment wins", func(t *testing.T) {
+		cfg, err := loadConfig(testSettings(map[string]string{"CONFIG_FILE": path, "PROFILE": "dev", "TELEGRAM_CHAT_ID": "3"}))
+		if err != nil || cfg.telegramChatID != "3" {
+			t.Errorf("chat %s, %v; want the environment's 3", cfg.telegramChatID, err)
+		}
+	})
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := loadConfig(testSettings(map[string]string{"CONFIG_FILE": path, "PROFILE": "staging"}))
+		if err == nil || !strings.Contains(err.Error(), `invalid PROFILE: `+path+` has no profile "staging" (profiles: dev, prod)`) {
+			t.Errorf("error = %v, want the unknown profile listed with the defined ones", err)
+		}
+	})
+	t.Run("profile without a file", func(t *testing.T) {
+		if _, err := loadConfig(testSettings(map[string]string{"PROFILE": "prod"})); err == nil {
+			t.Error("PROFILE without CONFIG_FILE was accepted")
+		}
+	})
+	t.Run("profile setting error points at its line", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(bad, []byte("dedup_window: 5m\nprofiles:\n  prod:\n    dedup_window: soon\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadConfig(testSettings(map[string]string{"CONFIG_FILE": bad, "PROFILE": "prod"}))
+		if err == nil || !strings.Contains(err.Error(), "line 4") {
+			t.Errorf("error = %v, want it to point at line 4", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadLetterRecord is one line of the dead-letter JSONL file.
+type deadLetterRecord struct {
+	Time    time.Time       `json:"time"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Raw     string          `json:"raw,omitempty"`
+	Error   string          `json:"error"`
+}
+
+// deadLetterWriter appends notifications that could not be delivered to a
+// JSONL file so they can be inspected or replayed later.
+type deadLetterWriter struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newDeadLetterWriter(path string) *deadLetterWriter {
+	return &deadLetterWriter{path: path}
+}
+
+// write appends a record for raw. Valid JSON payloads are stored as-is, other
+// bodies are kept as a string.
+func (d *deadLetterWriter) write(raw []byte, sendErr error) error {
+	record := deadLetterRecord{Time: time.Now().UTC(), Error: sendErr.Error()}
+	if json.Valid(raw) {
+		record.Payload = json.RawMessage(raw)
+	} else {
+		record.Raw = string(raw)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open dead letter file: %w", err)
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return fmt.Errorf("write dead letter file: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedupFields maps the names accepted in DEDUP_KEY_FIELDS to the payload
+// value each one contributes to the dedup key.
+var dedupFields = map[string]func(p kumaPayload) string{
+	"monitor": kumaPayload.monitorKey,
+	"status":  kumaPayload.statusCode,
+	"time":    func(p kumaPayload) string { return string(p.heartbeat().Time) },
+	"msg":     kumaPayload.message,
+}
+
+var defaultDedupKeyFields = []string{"monitor", "status", "time"}
+
+// parseDedupKeyFields parses a comma separated DEDUP_KEY_FIELDS value.
+func parseDedupKeyFields(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if _, ok := dedupFields[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q: must be one of monitor, status, time, msg", field)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("at least one field is required")
+	}
+	return fields, nil
+}
+
+// deduplicator drops notifications whose key was already seen within window.
+type deduplicator struct {
+	window time.Duration
+	fields []string
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newDeduplicator(window time.Duration, fields []string) *deduplicator {
+	return &deduplicator{window: window, fields: fields, seen: make(map[string]time.Time)}
+}
+
+// key builds the dedup key for payload from the configured fields.
+func (d *deduplicator) key(payload kumaPayload) string {
+	parts := make([]string, len(d.fields))
+	for i, field := range d.fields {
+		parts[i] = dedupFields[field](payload)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// duplicate reports whether payload was already seen within the window and
+// records it otherwise.
+func (d *deduplicator) duplicate(payload kumaPayload, now time.Time) bool {
+	key := d.key(payload)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, seenAt := range d.seen {
+		if now.Sub(seenAt) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	d.seen[key] = now
+	return false
+}
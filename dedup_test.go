@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseDedupKeyFields(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "monitor,status", want: []string{"monitor", "status"}},
+		{value: " Monitor , MSG ,", want: []string{"monitor", "msg"}},
+		{value: "monitor,url", wantErr: true},
+		{value: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDedupKeyFields(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseDedupKeyFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	const (
+		down      = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:00:00","msg":"timeout"}}`
+		downLater = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:01:00","msg":"timeout"}}`
+		downOther = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:01:00","msg":"refused"}}`
+		up        = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":1,"time":"2024-05-01 10:02:00","msg":"OK"}}`
+	)
+	tests := []struct {
+		name   string
+		fields []string
+		sends  []string
+		want   []bool // duplicate per send
+	}{
+		{name: "default fields", fields: defaultDedupKeyFields, sends: []string{down, down, downLater}, want: []bool{false, true, false}},
+		{name: "monitor and status", fields: []string{"monitor", "status"}, sends: []string{down, downLater, up, down}, want: []bool{false, true, false, true}},
+		{name: "message", fields: []string{"monitor", "msg"}, sends: []string{down, downLater, downOther}, want: []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeduplicator(time.Minute, tt.fields)
+			now := time.Now()
+			for i, raw := range tt.sends {
+				if got := d.duplicate(testPayload(t, raw), now); got != tt.want[i] {
+					t.Errorf("send %d: duplicate = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("window expires", func(t *testing.T) {
+		d := newDeduplicator(time.Minute, defaultDedupKeyFields)
+		now := time.Now()
+		d.duplicate(testPayload(t, down), now)
+		if d.duplicate(testPayload(t, down), now.Add(time.Minute)) {
+			t.Error("a payload was still a duplicate after the window")
+		}
+	})
+}
+
+func TestWebhookDropsDuplicates(t *testing.T) {
+	const body = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:00:00"},"msg":"down"}`
+	s := newWebhookServer(t, nil)
+	s.dedup = newDeduplicator(time.Minute, defaultDedupKeyFields)
+	if rec := s.post(body); rec.Code != http.StatusAccepted {
+		t.Fatalf("first alert: status %d", rec.Code)
+	}
+	if rec := s.post(body); rec.Code != http.StatusAccepted || rec.Body.String() != `{"duplicate":true,"ok":true}`+"\n" {
+		t.Errorf("repeated alert: %d %s, want it reported as a duplicate", rec.Code, rec.Body)
+	}
+	if len(s.notifier.jobs) != 1 {
+		t.Errorf("%d alerts delivered, want 1", len(s.notifier.jobs))
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// delivery is a rendered notification on its way to the notifiers.
+type delivery struct {
+	message     outgoingMessage
+	raw         []byte
+	monitorID   string
+	monitorName string
+	status      string
+
+	// chatID and threadID are the Telegram destination: the configured chat
+	// when the job was created, unless a token or routing rule overrides it.
+	// Empty uses the client's chat.
+	chatID   string
+	threadID int64
+
+	// notifier restricts the delivery to the notifier of that name; empty
+	// means every configured notifier.
+	notifier string
+
+	// requestID is the ID of the webhook request the delivery came from, if
+	// any, so its log lines can be correlated.
+	requestID string
+}
+
+// dispatcher sends deliveries to the configured notifiers and records the
+// outcome.
+type dispatcher struct {
+	notifiers      []notifier
+	requestTimeout time.Duration
+	deadLetters    *deadLetterWriter
+	pins           *pinTracker
+	// fallbackChatID receives alerts the bot may not post to their chat.
+	fallbackChatID string
+	spool          *spool
+	stats          *statsdClient
+	// atMostOnce gives up on sends that timed out instead of retrying them,
+	// since the notifier may already have posted the message.
+	atMostOnce bool
+}
+
+// deliver sends job to each of its notifiers, bounded by the request
+// timeout. Failures are logged and written to the dead-letter file when one
+// is configured, separately for each notifier, so a later retry doesn't
+// repeat the sends that succeeded. The Telegram message is returned when
+// there is one.
+func (d *dispatcher) deliver(ctx context.Context, job delivery) (sentMessage, error) {
+	var sent sentMessage
+	var errs []error
+	for _, n := range d.targets(job) {
+		target := job
+		target.notifier = n.name()
+		result, err := d.send(ctx, n, target)
+		if err != nil {
+			d.deadLetter(target, err)
+			errs = append(errs, err)
+			continue
+		}
+		if sent.MessageID == 0 {
+			sent = result
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// targets returns the notifiers job is delivered to.
+func (d *dispatcher) targets(job delivery) []notifier {
+	if job.notifier == "" {
+		return d.notifiers
+	}
+	for _, n := range d.notifiers {
+		if n.name() == job.notifier {
+			return []notifier{n}
+		}
+	}
+	slog.Warn("dropping message for disabled notifier", "notifier", job.notifier, "monitor_name", job.monitorName)
+	return nil
+}
+
+// send makes a single, logged delivery attempt of job to n.
+func (d *dispatcher) send(ctx context.Context, n notifier, job delivery) (sentMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.requestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	sent, err := n.send(ctx, job)
+	telegram, isTelegram := n.(*telegramNotifier)
+	if isTelegram && err != nil && isMissingRightsError(err) {
+		client := telegram.client()
+		chatID := job.chatID
+		if chatID == "" {
+			chatID = client.chatID
+		}
+		if d.fallbackChatID == "" || chatID == d.fallbackChatID {
+			slog.Warn("bot may not send to chat; add the bot to the chat and allow it to send messages, or set TELEGRAM_FALLBACK_CHAT_ID", "chat_id", chatID)
+		} else {
+			slog.Warn("bot may not send to chat, using TELEGRAM_FALLBACK_CHAT_ID; add the bot to the chat and allow it to send messages",
+				"chat_id", chatID, "fallback_chat_id", d.fallbackChatID, "error", err)
+			job.chatID, job.threadID = d.fallbackChatID, 0
+			sent, err = client.send(ctx, job)
+		}
+	}
+	elapsed := time.Since(start)
+	latency := elapsed.Milliseconds()
+	d.stats.timing(n.name()+".latency", elapsed)
+	if err != nil {
+		d.stats.count(n.name()+".failed", 1)
+		slog.Error("failed to send message", "request_id", job.requestID, "notifier", n.name(), "error", err, "monitor_name", job.monitorName, "status", job.status, "latency_ms", latency)
+		return sentMessage{}, err
+	}
+
+	d.stats.count(n.name()+".sent", 1)
+	slog.Info("message sent", "request_id", job.requestID, "notifier", n.name(), "monitor_name", job.monitorName, "status", job.status, "latency_ms", latency, "message_id", sent.MessageID)
+	if isTelegram && d.pins != nil {
+		d.pins.observe(ctx, job, sent)
+	}
+	return sent, nil
+}
+
+// deadLetter records a delivery that failed for good: it is appended to the
+// dead-letter file when one is configured, and spooled for a later retry
+// when the error may be temporary. Rejected messages, such as those to a
+// chat that doesn't exist, are not spooled since resending can't succeed.
+func (d *dispatcher) deadLetter(job delivery, sendErr error) {
+	switch {
+	case d.atMostOnce && mayHaveBeenDelivered(sendErr):
+		slog.Warn("not retrying message that timed out, it may already have been delivered", "notifier", job.notifier, "monitor_name", job.monitorName)
+	case d.spool != nil && d.retryable(sendErr):
+		if err := d.spool.write(job); err != nil {
+			slog.Error("failed to spool message", "error", err)
+		}
+	}
+	if d.deadLetters == nil {
+		return
+	}
+	if err := d.deadLetters.write(job.raw, sendErr); err != nil {
+		slog.Error("failed to write dead letter", "error", err)
+	}
+}
+
+// deliveryQueue decouples webhook requests from notifier latency: requests
+// enqueue deliveries and a fixed pool of workers drains the bounded buffer.
+type deliveryQueue struct {
+	jobs       chan delivery
+	dispatcher *dispatcher
+	retries    int           // extra attempts after a retryable failure
+	backoff    time.Duration // delay before the first retry, doubled after each
+	timeout    time.Duration // total time for a delivery and its retries; 0 is unlimited
+	wg         sync.WaitGroup
+}
+
+func newDeliveryQueue(d *dispatcher, size, workers, retries int, backoff, timeout time.Duration) *deliveryQueue {
+	q := &deliveryQueue{jobs: make(chan delivery, size), dispatcher: d, retries: retries, backoff: backoff, timeout: timeout}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *deliveryQueue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.deliver(job)
+	}
+}
+
+// deliver sends job to each of its notifiers, retrying retryable failures
+// with exponential backoff until the retries or the queue's timeout run out.
+// Only the final failure is dead-lettered.
+func (q *deliveryQueue) deliver(job delivery) {
+	for _, n := range q.dispatcher.targets(job) {
+		target := job
+		target.notifier = n.name()
+		q.deliverTo(n, target)
+	}
+}
+
+func (q *deliveryQueue) deliverTo(n notifier, job delivery) {
+	ctx := context.Background()
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+	delay := q.backoff
+	for attempt := 0; ; attempt++ {
+		_, err := q.dispatcher.send(ctx, n, job)
+		if err == nil {
+			return
+		}
+		deadline, hasDeadline := ctx.Deadline()
+		if attempt >= q.retries || !q.dispatcher.retryable(err) || (hasDeadline && time.Until(deadline) <= delay) {
+			q.dispatcher.deadLetter(job, err)
+			return
+		}
+		slog.Info("retrying message", "request_id", job.requestID, "notifier", n.name(), "monitor_name", job.monitorName, "attempt", attempt+2, "delay", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retryable reports whether a failed send may succeed when repeated:
+// network errors, rate limiting and server errors are, rejected requests are
+// not. With at-most-once delivery timeouts are not retried either.
+func (d *dispatcher) retryable(err error) bool {
+	if d.atMostOnce && mayHaveBeenDelivered(err) {
+		return false
+	}
+	var statusCode int
+	var apiErr *telegramAPIError
+	var slackErr *slackAPIError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.statusCode
+	case errors.As(err, &slackErr):
+		statusCode = slackErr.statusCode
+	default:
+		return true
+	}
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// mayHaveBeenDelivered reports whether err is a timeout, after which the
+// notifier may have accepted the message even though no response arrived.
+func mayHaveBeenDelivered(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// enqueue adds job without blocking and reports whether there was room.
+func (q *deliveryQueue) enqueue(job delivery) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting work and waits until every queued delivery has been
+// attempted.
+func (q *deliveryQueue) close() {
+	close(q.jobs)
+	q.wg.Wait()
+}
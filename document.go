@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"strconv"
+)
+
+// compactDataFilename is the name of the attachment used when the compact
+// data section is too long to inline.
+const compactDataFilename = "core-data.json"
+
+// document is a file uploaded alongside a message.
+type document struct {
+	name    string
+	content []byte
+}
+
+// sendDocument uploads doc as a reply to replyTo (0 sends it standalone).
+func (c *telegramClient) sendDocument(ctx context.Context, doc document, replyTo int64) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	fields := map[string]string{"chat_id": c.chatID}
+	if c.threadID != 0 {
+		fields["message_thread_id"] = strconv.FormatInt(c.threadID, 10)
+	}
+	if replyTo != 0 {
+		replyParameters, err := json.Marshal(map[string]any{"message_id": replyTo, "allow_sending_without_reply": true})
+		if err != nil {
+			return fmt.Errorf("marshal reply parameters: %w", err)
+		}
+		fields["reply_parameters"] = string(replyParameters)
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return fmt.Errorf("build telegram request: %w", err)
+		}
+	}
+
+	part, err := form.CreateFormFile("document", doc.name)
+	if err != nil {
+		return fmt.Errorf("build telegram request: %w", err)
+	}
+	if _, err := part.Write(doc.content); err != nil {
+		return fmt.Errorf("build telegram request: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("build telegram request: %w", err)
+	}
+
+	return c.doAPI(ctx, "sendDocument", form.FormDataContentType(), body.Bytes(), nil)
+}
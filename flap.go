@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// flapEvent is the flap detector's verdict on a heartbeat.
+type flapEvent int
+
+const (
+	flapNone    flapEvent = iota // forward the alert as usual
+	flapStarted                  // the monitor just started flapping; send a flapping notice instead
+	flapOngoing                  // the monitor is flapping; drop the alert
+)
+
+// flapSummary describes a monitor that stopped flapping.
+type flapSummary struct {
+	monitorID   string
+	monitorName string
+	status      string // heartbeat.status of the last state change
+	changes     int    // state changes seen while flapping
+}
+
+// flapDetector stops individual alerts for monitors that change state more
+// than threshold times within window. Once a flapping monitor has not changed
+// state for cooldown, onStable is called with a summary.
+type flapDetector struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	onStable  func(flapSummary)
+
+	mu       sync.Mutex
+	monitors map[string]*flapState
+}
+
+type flapState struct {
+	name       string
+	lastStatus string
+	changes    []time.Time // state changes within the window
+	flapping   bool
+	total      int // state changes since flapping started
+	timer      *time.Timer
+}
+
+func newFlapDetector(threshold int, window, cooldown time.Duration, onStable func(flapSummary)) *flapDetector {
+	return &flapDetector{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		onStable:  onStable,
+		monitors:  make(map[string]*flapState),
+	}
+}
+
+// observe records the payload's status and reports how it should be handled.
+// changes is the number of state changes within the window.
+func (d *flapDetector) observe(payload kumaPayload, monitorName string, now time.Time) (event flapEvent, changes int) {
+	key := payload.monitorKey()
+	status := payload.statusCode()
+	if key == "" || status == "" {
+		return flapNone, 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, ok := d.monitors[key]
+	if !ok {
+		state = &flapState{}
+		d.monitors[key] = state
+	}
+	state.name = monitorName
+
+	changed := state.lastStatus != "" && state.lastStatus != status
+	state.lastStatus = status
+	if !changed {
+		if state.flapping {
+			return flapOngoing, len(state.changes)
+		}
+		return flapNone, len(state.changes)
+	}
+
+	kept := state.changes[:0]
+	for _, changedAt := range state.changes {
+		if now.Sub(changedAt) < d.window {
+			kept = append(kept, changedAt)
+		}
+	}
+	state.changes = append(kept, now)
+
+	if state.flapping {
+		state.total++
+		state.timer.Reset(d.cooldown)
+		return flapOngoing, len(state.changes)
+	}
+	if len(state.changes) <= d.threshold {
+		return flapNone, len(state.changes)
+	}
+
+	state.flapping = true
+	state.total = len(state.changes)
+	state.timer = time.AfterFunc(d.cooldown, func() { d.stabilize(key) })
+	return flapStarted, len(state.changes)
+}
+
+// stabilize ends the flapping period of key and reports it.
+func (d *flapDetector) stabilize(key string) {
+	d.mu.Lock()
+	state, ok := d.monitors[key]
+	if !ok || !state.flapping {
+		d.mu.Unlock()
+		return
+	}
+	summary := flapSummary{monitorID: key, monitorName: state.name, status: state.lastStatus, changes: state.total}
+	state.flapping = false
+	state.total = 0
+	state.changes = nil
+	state.timer = nil
+	d.mu.Unlock()
+
+	if d.onStable != nil {
+		d.onStable(summary)
+	}
+}
+
+// noticeJob builds a delivery for a message generated by the service itself
+// rather than rendered from a webhook payload.
+func noticeJob(cfg config, monitorID, monitorName, status string, render func(f formatter) string) delivery {
+	job := delivery{
+		message: outgoingMessage{
+			text:      render(formatter{parseMode: cfg.parseMode}),
+			plainText: render(formatter{}),
+		},
+		monitorID:   monitorID,
+		monitorName: monitorName,
+		status:      status,
+		chatID:      cfg.telegramChatID,
+		threadID:    cfg.telegramThreadID,
+	}
+	if slices.Contains(cfg.notifiers, notifierSlack) {
+		job.message.slackText = render(formatter{parseMode: parseModeSlack})
+	}
+	if route, ok := routeFor(cfg.routingRules, monitorName); ok && route.chatID != "" {
+		job.chatID, job.threadID = route.chatID, route.ThreadID
+	}
+	return job
+}
+
+// buildFlappingMessage renders the notice sent when a monitor starts flapping.
+func buildFlappingMessage(monitorName string, changes int, window time.Duration, f formatter, l messageLabels) string {
+	return "⚠️ " + f.escape(fmt.Sprintf(l.flapping, monitorName, changes, formatDuration(window)))
+}
+
+// buildStabilizedMessage renders the summary sent when a monitor stops
+// flapping.
+func buildStabilizedMessage(summary flapSummary, f formatter, l messageLabels) string {
+	emoji, status := statusLabel(summary.status, l)
+	return emoji + " " + f.escape(fmt.Sprintf(l.stabilized, summary.monitorName, summary.changes, status))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlapDetector(t *testing.T) {
+	stable := make(chan flapSummary, 1)
+	d := newFlapDetector(2, time.Minute, 50*time.Millisecond, func(summary flapSummary) { stable <- summary })
+	now := time.Now()
+	tests := []struct {
+		body        string
+		wantEvent   flapEvent
+		wantChanges int
+	}{
+		{body: testDown, wantEvent: flapNone},
+		{body: testUp, wantEvent: flapNone, wantChanges: 1},
+		{body: testDown, wantEvent: flapNone, wantChanges: 2},
+		{body: testUp, wantEvent: flapStarted, wantChanges: 3},
+		{body: testUp, wantEvent: flapOngoing, wantChanges: 3},
+		{body: testDown, wantEvent: flapOngoing, wantChanges: 4},
+	}
+	for i, tt := range tests {
+		event, changes := d.observe(testPayload(t, tt.body), "db", now.Add(time.Duration(i)*time.Second))
+		if event != tt.wantEvent || changes != tt.wantChanges {
+			t.Fatalf("heartbeat %d: event %d with %d changes, want %d with %d", i+1, event, changes, tt.wantEvent, tt.wantChanges)
+		}
+	}
+
+	select {
+	case summary := <-stable:
+		want := flapSummary{monitorID: "7", monitorName: "db", status: "0", changes: 4}
+		if summary != want {
+			t.Errorf("summary = %+v, want %+v", summary, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the monitor was not reported stable after the cooldown")
+	}
+	if event, _ := d.observe(testPayload(t, testUp), "db", now.Add(10*time.Second)); event != flapNone {
+		t.Errorf("after the cooldown: event %d, want alerts to flow again", event)
+	}
+}
+
+func TestFlapWindow(t *testing.T) {
+	d := newFlapDetector(2, time.Minute, time.Minute, nil)
+	now := time.Now()
+	// Three changes, but never more than two within a minute.
+	for i, body := range []string{testDown, testUp, testDown, testUp} {
+		if event, _ := d.observe(testPayload(t, body), "db", now.Add(time.Duration(i)*40*time.Second)); event != flapNone {
+			t.Fatalf("heartbeat %d: event %d, want none for changes spread over more than the window", i+1, event)
+		}
+	}
+}
+
+func TestFlapMessages(t *testing.T) {
+	l := messageLanguages["en"]
+	if got, want := buildFlappingMessage("db", 3, 10*time.Minute, formatter{}, l), "⚠️ db is flapping (3 state changes in 10m), individual alerts paused"; got != want {
+		t.Errorf("flapping message = %q, want %q", got, want)
+	}
+	got := buildStabilizedMessage(flapSummary{monitorName: "db", status: "1", changes: 6}, formatter{}, l)
+	if want := "✅ db has stabilized after 6 state changes; current status: UP"; got != want {
+		t.Errorf("stabilized message = %q, want %q", got, want)
+	}
+}
+
+func TestFlappingWebhook(t *testing.T) {
+	s := newWebhookServer(t, map[string]string{"FLAP_THRESHOLD": "2", "MESSAGE_LANGUAGE": "en"})
+	s.flaps = newFlapDetector(s.cfg.flapThreshold, s.cfg.flapWindow, s.cfg.flapCooldown, nil)
+	for _, body := range []string{testDown, testUp, testDown, testUp, testDown} {
+		if rec := s.post(body); rec.Code != http.StatusAccepted {
+			t.Fatalf("status %d %s", rec.Code, rec.Body)
+		}
+	}
+	texts := s.notifier.texts()
+	if len(texts) != 4 || !strings.Contains(texts[3], "is flapping") {
+		t.Errorf("sent %q, want three alerts and the flapping notice", texts)
+	}
+}
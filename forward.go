@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// forwarder mirrors received payloads to FORWARD_URL. Forwarding happens in
+// the background and never affects Telegram delivery.
+type forwarder struct {
+	url        string
+	userAgent  string
+	timeout    time.Duration
+	httpClient *http.Client
+	wg         sync.WaitGroup
+}
+
+func newForwarder(url, userAgent string, timeout time.Duration) *forwarder {
+	return &forwarder{url: url, userAgent: userAgent, timeout: timeout, httpClient: &http.Client{Timeout: timeout}}
+}
+
+// forward POSTs body to the forward URL with the original content type.
+// Failures are only logged.
+func (f *forwarder) forward(body []byte, contentType string) {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := f.post(body, contentType); err != nil {
+			slog.Error("failed to forward payload", "error", err)
+		}
+	}()
+}
+
+func (f *forwarder) post(body []byte, contentType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create forward request: %w", err)
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", f.userAgent)
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("forward request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("forward target returned %s", resp.Status)
+	}
+	return nil
+}
+
+// close waits for forwards that are still in flight.
+func (f *forwarder) close() {
+	f.wg.Wait()
+}
@@ -1,3 +1,3 @@
 module uptimekuma-webhook-tgbot
 
-go 1.23.4
+go 1.24.0
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// historySize is how many recent status changes are kept for trends.
+	historySize = 1000
+	// trendWindow is the period the trend line covers.
+	trendWindow = time.Hour
+)
+
+type historyEntry struct {
+	monitorID string
+	status    string
+	at        time.Time
+}
+
+// alertHistory is a fixed-size ring buffer of recent status changes. Repeated
+// heartbeats with an unchanged status, such as the DOWNs Uptime Kuma resends
+// during one outage, are recorded once.
+type alertHistory struct {
+	mu      sync.Mutex
+	entries []historyEntry
+	next    int
+	last    map[string]string // status last seen by monitor
+}
+
+func newAlertHistory(size int) *alertHistory {
+	return &alertHistory{entries: make([]historyEntry, 0, size), last: make(map[string]string)}
+}
+
+// record adds the payload's heartbeat if it changes the monitor's status,
+// overwriting the oldest entry once the buffer is full.
+func (h *alertHistory) record(payload kumaPayload, now time.Time) {
+	entry := historyEntry{
+		monitorID: payload.monitorKey(),
+		status:    payload.statusCode(),
+		at:        now,
+	}
+	if entry.monitorID == "" || entry.status == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last[entry.monitorID] == entry.status {
+		return
+	}
+	h.last[entry.monitorID] = entry.status
+	if len(h.entries) < cap(h.entries) {
+		h.entries = append(h.entries, entry)
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// count returns how many times monitorID changed to status at or after since.
+func (h *alertHistory) count(monitorID, status string, since time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, entry := range h.entries {
+		if entry.monitorID == monitorID && entry.status == status && !entry.at.Before(since) {
+			n++
+		}
+	}
+	return n
+}
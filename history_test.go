@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertHistory(t *testing.T) {
+	const (
+		down      = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":0}}`
+		up        = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":1}}`
+		otherDown = `{"monitor":{"id":2,"name":"api"},"heartbeat":{"status":0}}`
+	)
+	h := newAlertHistory(historySize)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	// Two outages of db, the first reported by three DOWN heartbeats.
+	for i, body := range []string{down, down, down, up, otherDown, down} {
+		h.record(testPayload(t, body), start.Add(time.Duration(i)*10*time.Minute))
+	}
+
+	tests := []struct {
+		monitorID string
+		status    string
+		since     time.Time
+		want      int
+	}{
+		{monitorID: "1", status: "0", since: start, want: 2},
+		{monitorID: "1", status: "1", since: start, want: 1},
+		{monitorID: "2", status: "0", since: start, want: 1},
+		{monitorID: "1", status: "0", since: start.Add(time.Minute), want: 1},
+		{monitorID: "3", status: "0", since: start, want: 0},
+	}
+	for _, tt := range tests {
+		if got := h.count(tt.monitorID, tt.status, tt.since); got != tt.want {
+			t.Errorf("count(%s, %s, %s) = %d, want %d", tt.monitorID, tt.status, tt.since.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestAlertHistoryWraps(t *testing.T) {
+	h := newAlertHistory(2)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, body := range []string{
+		`{"monitor":{"id":1},"heartbeat":{"status":0}}`,
+		`{"monitor":{"id":1},"heartbeat":{"status":1}}`,
+		`{"monitor":{"id":1},"heartbeat":{"status":0}}`,
+	} {
+		h.record(testPayload(t, body), now)
+	}
+	if got := h.count("1", "0", now); got != 1 {
+		t.Errorf("count = %d, want the oldest DOWN overwritten", got)
+	}
+}
+
+func TestTrendLine(t *testing.T) {
+	const (
+		down = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":0},"msg":"down"}`
+		up   = `{"monitor":{"id":1,"name":"db"},"heartbeat":{"status":1},"msg":"up"}`
+	)
+	s := newWebhookServer(t, map[string]string{"SHOW_TREND": "true", "MESSAGE_LANGUAGE": "en"})
+	s.history = newAlertHistory(historySize)
+	steps := []struct {
+		body string
+		want string // trend line; empty means none
+	}{
+		{body: down},
+		{body: down}, // the same outage again
+		{body: up},
+		{body: down, want: "📈 2 failures in the last hour"},
+	}
+	for i, step := range steps {
+		if rec := s.post(step.body); rec.Code != http.StatusAccepted {
+			t.Fatalf("step %d: status %d %s", i+1, rec.Code, rec.Body)
+		}
+		texts := s.notifier.texts()
+		got := ""
+		for _, line := range strings.Split(texts[len(texts)-1], "\n") {
+			if strings.HasPrefix(line, "📈") {
+				got = line
+			}
+		}
+		if got != step.want {
+			t.Errorf("step %d: trend line %q, want %q", i+1, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultMessageLanguage = "zh"
+
+// messageLabels holds every static string used in built-in messages.
+type messageLabels struct {
+	emojiDown string
+	emojiUp   string
+	emojiTest string
+
+	testTitle         string
+	testSuffix        string // appended to a custom MESSAGE_TITLE for test notifications
+	monitorTitle      string
+	notificationTitle string
+	maintenanceTitle  string
+	certExpiryTitle   string
+
+	monitorName       string
+	group             string
+	host              string
+	url               string
+	message           string
+	responseTime      string
+	time              string
+	maintenanceName   string
+	description       string
+	maintenanceWindow string
+	downtime          string
+	certificate       string
+	certExpiresIn     string // days until the certificate expires
+
+	rawData       string
+	notObject     string // explains why a payload is shown as raw data
+	coreData      string
+	seeAttachment string // replaces data that was sent as a file, e.g. "见附件 %[1]s"
+
+	openDashboard string
+
+	acknowledge      string // Acknowledge button text
+	acknowledged     string // confirmation shown to the user who pressed it
+	acknowledgedBy   string // appended to an acked alert, e.g. "✅ 已由 %[1]s 确认"
+	alreadyRecovered string // shown when Acknowledge is pressed after the outage ended
+
+	quietDigestTitle string // number of events held back during quiet hours
+	wasDownFor       string // duration of an outage that ended during quiet hours
+	moreEvents       string // number of digest lines left out
+
+	batchTitle    string // number of notifications combined into one message
+	recoveryTitle string // number of monitors in a recovery digest
+	trend         string // number of failures within the trend window
+	logs          string // text of the LOG_URL_TEMPLATE link
+
+	flapping   string // monitor name, state changes, window
+	stabilized string // monitor name, state changes, status
+
+	relativeWrap string // wraps the relative time, e.g. "（%s）"
+	justNow      string
+	minutesAgo   string
+	hoursAgo     string
+	daysAgo      string
+}
+
+// messageLanguages is the translation table for MESSAGE_LANGUAGE.
+var messageLanguages = map[string]messageLabels{
+	"zh": {
+		emojiDown:         "❌",
+		emojiUp:           "✅",
+		emojiTest:         "🧪",
+		testTitle:         "Uptime Kuma 测试通知",
+		testSuffix:        "测试通知",
+		monitorTitle:      "Uptime Kuma 监控通知",
+		notificationTitle: "Uptime Kuma 通知",
+		maintenanceTitle:  "Uptime Kuma 维护通知",
+		certExpiryTitle:   "Uptime Kuma 证书即将过期",
+		monitorName:       "服务名称",
+		group:             "分组",
+		host:              "主机",
+		url:               "链接",
+		message:           "消息",
+		responseTime:      "响应时间",
+		time:              "时间",
+		maintenanceName:   "维护标题",
+		description:       "说明",
+		maintenanceWindow: "维护时段",
+		downtime:          "停机时长",
+		certificate:       "证书",
+		certExpiresIn:     "%[1]d 天后过期",
+		rawData:           "原始数据",
+		notObject:         "负载不是 JSON 对象，无法解析为通知，以下为原始内容",
+		coreData:          "核心数据",
+		seeAttachment:     "见附件 %[1]s",
+		openDashboard:     "在 Uptime Kuma 中查看",
+		acknowledge:       "✋ 确认",
+		acknowledged:      "已确认",
+		acknowledgedBy:    "✅ 已由 %[1]s 确认",
+		alreadyRecovered:  "该故障已恢复，无需确认",
+		quietDigestTitle:  "免打扰期间共 %[1]d 条通知",
+		wasDownFor:        "曾中断 %[1]s，已恢复",
+		moreEvents:        "…… 另有 %[1]d 条",
+		batchTitle:        "%[1]d 条监控通知",
+		recoveryTitle:     "已恢复：%[1]d 个服务",
+		trend:             "近 1 小时 %[1]d 次故障",
+		logs:              "查看日志",
+		flapping:          "%[1]s 状态频繁变化（%[3]s 内 %[2]d 次），暂停单独通知",
+		stabilized:        "%[1]s 已恢复稳定，抖动期间共 %[2]d 次状态变化，当前状态：%[3]s",
+		relativeWrap:      "（%s）",
+		justNow:           "刚刚",
+		minutesAgo:        "%d 分钟前",
+		hoursAgo:          "%d 小时前",
+		daysAgo:           "%d 天前",
+	},
+	"en": {
+		emojiDown:         "❌",
+		emojiUp:           "✅",
+		emojiTest:         "🧪",
+		testTitle:         "Uptime Kuma Test Notification",
+		testSuffix:        "Test Notification",
+		monitorTitle:      "Uptime Kuma Monitor Alert",
+		notificationTitle: "Uptime Kuma Notification",
+		maintenanceTitle:  "Uptime Kuma Maintenance",
+		certExpiryTitle:   "Uptime Kuma Certificate Expiry",
+		monitorName:       "Service",
+		group:             "Group",
+		host:              "Host",
+		url:               "URL",
+		message:           "Message",
+		responseTime:      "Response time",
+		time:              "Time",
+		maintenanceName:   "Title",
+		description:       "Description",
+		maintenanceWindow: "Window",
+		downtime:          "Downtime",
+		certificate:       "Certificate",
+		certExpiresIn:     "expires in %[1]d days",
+		rawData:           "Raw data",
+		notObject:         "The payload is not a JSON object and can't be read as a notification; raw content below",
+		coreData:          "Core data",
+		seeAttachment:     "see attached %[1]s",
+		openDashboard:     "Open in Uptime Kuma",
+		acknowledge:       "✋ Acknowledge",
+		acknowledged:      "Acknowledged",
+		acknowledgedBy:    "✅ Acknowledged by %[1]s",
+		alreadyRecovered:  "Already recovered, nothing to acknowledge",
+		quietDigestTitle:  "%[1]d notifications during quiet hours",
+		wasDownFor:        "was down for %[1]s, recovered",
+		moreEvents:        "… and %[1]d more",
+		batchTitle:        "%[1]d monitor notifications",
+		recoveryTitle:     "Recovered: %[1]d services",
+		trend:             "%[1]d failures in the last hour",
+		logs:              "View logs",
+		flapping:          "%[1]s is flapping (%[2]d state changes in %[3]s), individual alerts paused",
+		stabilized:        "%[1]s has stabilized after %[2]d state changes; current status: %[3]s",
+		relativeWrap:      "(%s)",
+		justNow:           "just now",
+		minutesAgo:        "%d min ago",
+		hoursAgo:          "%d h ago",
+		daysAgo:           "%d d ago",
+	},
+}
+
+// lookupMessageLabels returns the labels for lang or an error naming the
+// supported languages. Two languages joined with "+", e.g. "zh+en", render
+// every label in both.
+func lookupMessageLabels(lang string) (messageLabels, error) {
+	if primary, secondary, ok := strings.Cut(lang, "+"); ok {
+		first, err := lookupMessageLabels(primary)
+		if err != nil {
+			return messageLabels{}, err
+		}
+		second, err := lookupMessageLabels(secondary)
+		if err != nil || primary == secondary {
+			return messageLabels{}, fmt.Errorf("unsupported language %q: must be zh, en, zh+en or en+zh", lang)
+		}
+		return combineLabels(first, second), nil
+	}
+
+	labels, ok := messageLanguages[lang]
+	if !ok {
+		return messageLabels{}, fmt.Errorf("unsupported language %q: must be zh, en, zh+en or en+zh", lang)
+	}
+	return labels, nil
+}
+
+// combineLabels joins the labels of two languages as "primary / secondary".
+// Emojis and the relative time phrases are only shown once, in the primary
+// language, to keep the message short.
+func combineLabels(primary, secondary messageLabels) messageLabels {
+	both := func(a, b string) string { return a + " / " + b }
+
+	combined := primary
+	combined.testTitle = both(primary.testTitle, secondary.testTitle)
+	combined.testSuffix = both(primary.testSuffix, secondary.testSuffix)
+	combined.monitorTitle = both(primary.monitorTitle, secondary.monitorTitle)
+	combined.notificationTitle = both(primary.notificationTitle, secondary.notificationTitle)
+	combined.maintenanceTitle = both(primary.maintenanceTitle, secondary.maintenanceTitle)
+	combined.certExpiryTitle = both(primary.certExpiryTitle, secondary.certExpiryTitle)
+	combined.monitorName = both(primary.monitorName, secondary.monitorName)
+	combined.group = both(primary.group, secondary.group)
+	combined.host = both(primary.host, secondary.host)
+	combined.url = both(primary.url, secondary.url)
+	combined.message = both(primary.message, secondary.message)
+	combined.responseTime = both(primary.responseTime, secondary.responseTime)
+	combined.time = both(primary.time, secondary.time)
+	combined.maintenanceName = both(primary.maintenanceName, secondary.maintenanceName)
+	combined.description = both(primary.description, secondary.description)
+	combined.maintenanceWindow = both(primary.maintenanceWindow, secondary.maintenanceWindow)
+	combined.downtime = both(primary.downtime, secondary.downtime)
+	combined.certificate = both(primary.certificate, secondary.certificate)
+	combined.certExpiresIn = both(primary.certExpiresIn, secondary.certExpiresIn)
+	combined.rawData = both(primary.rawData, secondary.rawData)
+	combined.notObject = both(primary.notObject, secondary.notObject)
+	combined.coreData = both(primary.coreData, secondary.coreData)
+	combined.seeAttachment = both(primary.seeAttachment, secondary.seeAttachment)
+	combined.openDashboard = both(primary.openDashboard, secondary.openDashboard)
+	combined.acknowledge = both(primary.acknowledge, secondary.acknowledge)
+	combined.acknowledged = both(primary.acknowledged, secondary.acknowledged)
+	combined.acknowledgedBy = both(primary.acknowledgedBy, secondary.acknowledgedBy)
+	combined.alreadyRecovered = both(primary.alreadyRecovered, secondary.alreadyRecovered)
+	combined.quietDigestTitle = both(primary.quietDigestTitle, secondary.quietDigestTitle)
+	combined.wasDownFor = both(primary.wasDownFor, secondary.wasDownFor)
+	combined.moreEvents = both(primary.moreEvents, secondary.moreEvents)
+	combined.batchTitle = both(primary.batchTitle, secondary.batchTitle)
+	combined.recoveryTitle = both(primary.recoveryTitle, secondary.recoveryTitle)
+	combined.trend = both(primary.trend, secondary.trend)
+	combined.logs = both(primary.logs, secondary.logs)
+	combined.flapping = both(primary.flapping, secondary.flapping)
+	combined.stabilized = both(primary.stabilized, secondary.stabilized)
+	return combined
+}
+
+// withSource prefixes the message titles with "[source]" so recipients can
+// tell which Uptime Kuma instance sent an alert.
+func (l messageLabels) withSource(source string) messageLabels {
+	prefix := "[" + source + "] "
+	l.testTitle = prefix + l.testTitle
+	l.monitorTitle = prefix + l.monitorTitle
+	l.notificationTitle = prefix + l.notificationTitle
+	l.maintenanceTitle = prefix + l.maintenanceTitle
+	l.certExpiryTitle = prefix + l.certExpiryTitle
+	return l
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupMessageLabels(t *testing.T) {
+	tests := []struct {
+		lang      string
+		wantTitle string
+		wantErr   bool
+	}{
+		{lang: "zh", wantTitle: "Uptime Kuma 监控通知"},
+		{lang: "en", wantTitle: "Uptime Kuma Monitor Alert"},
+		{lang: "zh+en", wantTitle: "Uptime Kuma 监控通知 / Uptime Kuma Monitor Alert"},
+		{lang: "en+zh", wantTitle: "Uptime Kuma Monitor Alert / Uptime Kuma 监控通知"},
+		{lang: "en+en", wantErr: true},
+		{lang: "fr", wantErr: true},
+		{lang: "zh+fr", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			labels, err := lookupMessageLabels(tt.lang)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if labels.monitorTitle != tt.wantTitle {
+				t.Errorf("monitorTitle = %q, want %q", labels.monitorTitle, tt.wantTitle)
+			}
+		})
+	}
+}
+
+// Combined labels repeat their format verbs, which must refer to the
+// arguments by index to be filled in twice.
+func TestCombinedLabelsFormat(t *testing.T) {
+	l, err := lookupMessageLabels("zh+en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, formatted := range []string{
+		fmt.Sprintf(l.certExpiresIn, 7),
+		fmt.Sprintf(l.seeAttachment, compactDataFilename),
+		fmt.Sprintf(l.acknowledgedBy, "@alice"),
+		fmt.Sprintf(l.wasDownFor, "5m"),
+		fmt.Sprintf(l.moreEvents, 3),
+		fmt.Sprintf(l.trend, 4),
+		fmt.Sprintf(l.flapping, "db", 6, "10m"),
+		fmt.Sprintf(l.stabilized, "db", 6, "UP"),
+	} {
+		if strings.Contains(formatted, "%!") || !strings.Contains(formatted, " / ") {
+			t.Errorf("badly combined label %q", formatted)
+		}
+	}
+	// Relative times are shown in the primary language only.
+	if got, _ := relativeTime(time.Now().Add(-2*time.Minute), time.Now(), l); got != "2 分钟前" {
+		t.Errorf("relative time = %q, want the primary language only", got)
+	}
+}
+
+func TestBilingualMessage(t *testing.T) {
+	raw := `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"timeout"}`
+	labels, err := lookupMessageLabels("en+zh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), messageOptions{labels: labels})
+	for _, want := range []string{"Uptime Kuma Monitor Alert / Uptime Kuma 监控通知", "Service / 服务名称: db", "Message / 消息: timeout"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("message does not contain %q:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixSocketPrefix marks a LISTEN_ADDR that names a Unix domain socket, e.g.
+// "unix:/run/uptimekuma-webhook-tgbot.sock".
+const unixSocketPrefix = "unix:"
+
+// listen opens the listener for addr: a Unix domain socket with the given
+// file mode when addr starts with "unix:", otherwise a TCP socket.
+func listen(addr string, socketMode fs.FileMode) (net.Listener, error) {
+	socketPath, ok := strings.CutPrefix(addr, unixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// A socket left behind by an unclean exit would make Listen fail. Only
+	// sockets are removed so a mistyped path can't delete a regular file.
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, socketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	// The socket file is removed when the listener is closed on shutdown.
+	return listener, nil
+}
@@ -3,263 +3,2041 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
 const (
-	maxPayloadBytes       = 1 << 20 // 1 MiB
-	defaultTelegramAPIURL = "https://api.telegram.org"
-	defaultListenAddr     = ":8080"
+	defaultMaxPayloadBytes = 1 << 20 // 1 MiB
+	maxRawRunes            = 3900
+	maxFieldRunes          = 1024
+	defaultQueueSize       = 100
+	defaultQueueWorkers    = 1
+	defaultQueueRetries    = 3
+	defaultTelegramAPIURL  = "https://api.telegram.org"
+	defaultListenAddr      = ":8080"
+	defaultWebhookPath     = "/uptimekuma-webhook"
+	defaultCallbackPath    = "/telegram-callback"
+
+	parseModeMarkdownV2 = "MarkdownV2"
+	parseModeHTML       = "HTML"
+
+	logFormatText = "text"
+	logFormatJSON = "json"
+
+	authModeAny   = "any"   // a token or a signature
+	authModeToken = "token" // a token only
+	authModeHMAC  = "hmac"  // a signature only
+	authModeBoth  = "both"  // a token and a signature
+	authModeMTLS  = "mtls"  // a verified client certificate only
 )
 
-var defaultRequestTimeout = 10 * time.Second
+var (
+	defaultRequestTimeout    = 10 * time.Second
+	shutdownTimeout          = 15 * time.Second
+	defaultFlapWindow        = 5 * time.Minute
+	defaultQueueRetryBackoff = time.Second
+	defaultSpoolInterval     = time.Minute
+	defaultSpoolMaxAge       = 24 * time.Hour
+)
+
+// version is the build version, injected with -ldflags "-X main.version=...";
+// see also commit.
+var version = "dev"
+
+const (
+	serviceName = "uptimekuma-webhook-tgbot"
+	healthPath  = "/healthz"
+	statusPath  = "/status"
+	docsURL     = "https://github.com/zcp1997/uptimekuma-webhook-tgbot"
+)
 
 type config struct {
-	listenAddr       string
-	webhookToken     string
-	telegramBotToken string
-	telegramChatID   string
-	telegramBaseURL  string
-	requestTimeout   time.Duration
+	listenAddr             string
+	unixSocketMode         fs.FileMode
+	logFormat              string
+	logLevel               slog.Level
+	webhookPath            string
+	webhookEndpoints       []webhookEndpoint
+	webhookToken           string
+	webhookTokens          []webhookToken
+	authMode               string
+	authAllowHeader        bool
+	authAllowQuery         bool
+	webhookHMACKey         string
+	logRawPayload          bool
+	telegramBotToken       string
+	telegramChatID         string
+	telegramFallbackChatID string
+	telegramThreadID       int64
+	telegramBaseURL        string
+	telegramProxyURL       *url.URL
+	telegramCAs            *x509.CertPool
+	parseMode              string
+	requestTimeout         time.Duration
+	userAgent              string
+	linkPreview            bool
+	uptimeKumaURL          string
+	logURLTemplate         string
+	verboseTest            bool
+	echoMode               bool
+	importantOnly          bool
+	suppressOrphanRecovery bool
+	suppressRepeatRecovery bool
+	pinDownMessages        bool
+	stateFile              string
+	routingRules           []routeRule
+	compactDataMaxInline   int
+	ackMuteTimeout         time.Duration
+	flapThreshold          int
+	flapWindow             time.Duration
+	flapCooldown           time.Duration
+	displayLocation        *time.Location
+	timeFormat             string
+	showPortForHTTP        bool
+	terseWhenMinimal       bool
+	notifiers              []string
+	slackWebhookURL        string
+	maxTelegramConcurrency int
+	ackButton              bool
+	callbackPath           string
+	telegramWebhookSecret  string
+	quietHours             *quietHours
+	batchInterval          time.Duration
+	digestWindow           time.Duration
+	recoveryDigestWindow   time.Duration
+	forwardURL             string
+	statsdAddr             string
+	statsdPrefix           string
+	strictPayload          bool
+	maxPayloadBytes        int
+	tlsCertFile            string
+	tlsKeyFile             string
+	tlsClientCAs           *x509.CertPool
+	tlsAllowedClientNames  []string
+	showTrend              bool
+	queueRetries           int
+	queueRetryBackoff      time.Duration
+	queueDeliveryTimeout   time.Duration // total time for one queued delivery and its retries; 0 is unlimited
+	spoolDir               string
+	spoolInterval          time.Duration
+	spoolMaxAge            time.Duration
+	defaultMonitorName     string
+	atMostOnce             bool
+	rateLimitRPS           float64
+	rateLimitBurst         int
+	rateLimitGlobal        bool
+	trustedProxies         []*net.IPNet
+	allowedSources         []*net.IPNet
+	showRelativeTime       bool
+	showUnmeasuredPing     bool
+	messageLabels          messageLabels
+	messageTemplate        *template.Template
+	dedupWindow            time.Duration
+	dedupKeyFields         []string
+	deadLetterPath         string
+	asyncDelivery          bool
+	queueSize              int
+	queueWorkers           int
+
+	// warnings are problems found while loading that don't prevent
+	// starting; main logs them once logging is set up.
+	warnings []string
+	// settings are the values of configSettings the configuration was
+	// loaded from, compared on reload to report what changed.
+	settings settings
+}
+
+// sentMessage is the subset of Telegram's Message object returned by sendMessage.
+type sentMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID       int64  `json:"id"`
+		Title    string `json:"title,omitempty"`
+		Username string `json:"username,omitempty"`
+	} `json:"chat"`
 }
 
 type telegramClient struct {
 	baseURL        string
 	botToken       string
 	chatID         string
+	threadID       int64
+	parseMode      string
+	userAgent      string
+	linkPreview    bool
 	httpClient     *http.Client
 	requestTimeout time.Duration
+	chatLocks      *chatLocks
+	// inflight caps concurrent Bot API requests across all chats; nil means
+	// unlimited.
+	inflight chan struct{}
 }
 
 func main() {
-	if err := loadDotEnv(".env"); err != nil {
-		log.Printf("warning: %v", err)
+	env := environSettings(os.Environ())
+	if err := env.loadDotEnv(".env"); err != nil {
+		slog.Warn("failed to load .env", "error", err)
+	}
+
+	replay := flag.String("replay", "", "render the Uptime Kuma payload in `file` to stdout and exit, without contacting Telegram")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	check := flag.Bool("check", false, "validate the configuration, verify the bot token with Telegram and exit")
+	registerEnvFlags(flag.CommandLine)
+	flag.Parse()
+
+	if *showVersion {
+		printVersion(os.Stdout)
+		return
 	}
+	applyEnvFlags(flag.CommandLine, env)
 
-	cfg, err := loadConfig()
+	cfg, err := loadConfig(env)
 	if err != nil {
 		log.Fatalf("configuration error: %v", err)
 	}
 
-	client := &telegramClient{
-		baseURL:        strings.TrimSuffix(cfg.telegramBaseURL, "/"),
-		botToken:       cfg.telegramBotToken,
-		chatID:         cfg.telegramChatID,
-		requestTimeout: cfg.requestTimeout,
-		httpClient:     &http.Client{Timeout: cfg.requestTimeout},
+	if *check {
+		if err := checkConfig(cfg, os.Stdout); err != nil {
+			log.Fatalf("check failed: %v", err)
+		}
+		return
+	}
+
+	if *replay != "" {
+		if err := replayPayload(cfg, *replay, os.Stdout); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		return
+	}
+
+	live := new(atomic.Pointer[config])
+	live.Store(&cfg)
+
+	logOutput := &redactingWriter{w: os.Stderr, secrets: func() []string {
+		return configSecrets(*live.Load())
+	}}
+	if cfg.logFormat == logFormatJSON {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logOutput, &slog.HandlerOptions{Level: cfg.logLevel})))
+	} else {
+		log.SetOutput(logOutput)
+		slog.SetLogLoggerLevel(cfg.logLevel)
+	}
+	for _, warning := range cfg.warnings {
+		slog.Warn(warning)
+	}
+
+	telegram := newTelegramNotifier(cfg)
+
+	mux := http.NewServeMux()
+	var dedup *deduplicator
+	if cfg.dedupWindow > 0 {
+		dedup = newDeduplicator(cfg.dedupWindow, cfg.dedupKeyFields)
+	}
+
+	d := &dispatcher{requestTimeout: cfg.requestTimeout, fallbackChatID: cfg.telegramFallbackChatID, atMostOnce: cfg.atMostOnce}
+	if cfg.statsdAddr != "" {
+		d.stats, err = newStatsdClient(cfg.statsdAddr, cfg.statsdPrefix)
+		if err != nil {
+			log.Fatalf("configuration error: invalid STATSD_ADDR: %v", err)
+		}
+	}
+	for _, name := range cfg.notifiers {
+		switch name {
+		case notifierTelegram:
+			d.notifiers = append(d.notifiers, telegram)
+		case notifierSlack:
+			d.notifiers = append(d.notifiers, &slackClient{
+				webhookURL: cfg.slackWebhookURL,
+				userAgent:  cfg.userAgent,
+				httpClient: &http.Client{Timeout: cfg.requestTimeout},
+			})
+		}
+	}
+	if cfg.deadLetterPath != "" {
+		d.deadLetters = newDeadLetterWriter(cfg.deadLetterPath)
+	}
+
+	var store stateStore = newMemoryStateStore()
+	if cfg.stateFile != "" {
+		store = newFileStateStore(cfg.stateFile)
+	}
+	states := newMonitorStates(store)
+
+	if cfg.pinDownMessages {
+		d.pins = newPinTracker(telegram, states)
+	}
+
+	if cfg.spoolDir != "" {
+		spooled, err := newSpool(cfg.spoolDir, cfg.spoolMaxAge, func(ctx context.Context, job delivery) error {
+			for _, n := range d.targets(job) {
+				if _, err := d.send(ctx, n, job); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, d.retryable, d.deadLetters)
+		if err != nil {
+			log.Fatalf("configuration error: invalid SPOOL_DIR: %v", err)
+		}
+		spooled.start(cfg.spoolInterval)
+		d.spool = spooled
+	}
+
+	var queue *deliveryQueue
+	if cfg.asyncDelivery {
+		queue = newDeliveryQueue(d, cfg.queueSize, cfg.queueWorkers, cfg.queueRetries, cfg.queueRetryBackoff, cfg.queueDeliveryTimeout)
+	}
+
+	var flaps *flapDetector
+	if cfg.flapThreshold > 0 {
+		flaps = newFlapDetector(cfg.flapThreshold, cfg.flapWindow, cfg.flapCooldown, func(summary flapSummary) {
+			current := *live.Load()
+			job := noticeJob(current, summary.monitorID, summary.monitorName, summary.status, func(f formatter) string {
+				return buildStabilizedMessage(summary, f, current.messageLabels)
+			})
+			// Runs on the detector's timer goroutine, so the summary is
+			// sent directly instead of through the queue.
+			_, _ = d.deliver(context.Background(), job)
+		})
+	}
+
+	var quiet *quietBuffer
+	if cfg.quietHours != nil {
+		quiet = newQuietBuffer(cfg.quietHours, func(events []quietEvent) {
+			current := *live.Load()
+			job := noticeJob(current, "", "", "", func(f formatter) string {
+				return buildQuietDigest(events, f, current.messageLabels, cfg.quietHours.location)
+			})
+			_, _ = d.deliver(context.Background(), job)
+		})
+	}
+
+	sendBatched := func(job delivery) {
+		_, _ = d.deliver(context.Background(), job)
+	}
+	combineBatch := func(jobs []delivery) delivery {
+		current := *live.Load()
+		job := noticeJob(current, "", "", "", func(f formatter) string {
+			return buildBatchMessage(jobs, f, current.messageLabels)
+		})
+		job.chatID, job.threadID = jobs[0].chatID, jobs[0].threadID
+		return job
+	}
+	var batch *batcher
+	switch {
+	case cfg.batchInterval > 0:
+		batch = newBatcher(cfg.batchInterval, sendBatched, combineBatch)
+	case cfg.digestWindow > 0:
+		batch = newWindowBatcher(cfg.digestWindow, sendBatched, combineBatch)
+	}
+
+	var recoveries *batcher
+	if cfg.recoveryDigestWindow > 0 {
+		recoveries = newWindowBatcher(cfg.recoveryDigestWindow, sendBatched, func(jobs []delivery) delivery {
+			// The digest replaces the individual UP messages, so their
+			// pinned DOWN alerts are released here.
+			if d.pins != nil {
+				for _, job := range jobs {
+					d.pins.observe(context.Background(), job, sentMessage{})
+				}
+			}
+			current := *live.Load()
+			job := noticeJob(current, "", "", "", func(f formatter) string {
+				return buildRecoveryDigest(jobs, f, current.messageLabels)
+			})
+			job.chatID, job.threadID = jobs[0].chatID, jobs[0].threadID
+			return job
+		})
+	}
+
+	var forward *forwarder
+	if cfg.forwardURL != "" {
+		forward = newForwarder(cfg.forwardURL, cfg.userAgent, cfg.requestTimeout)
+	}
+
+	var history *alertHistory
+	if cfg.showTrend {
+		history = newAlertHistory(historySize)
+	}
+
+	down := newDownTracker(states)
+	var webhookPaths []string
+	for _, endpoint := range cfg.webhookEndpoints {
+		mux.Handle(endpoint.path, withRequestID(webhookHandler(live, endpoint.name, d, dedup, down, history, flaps, quiet, batch, recoveries, queue, forward)))
+		webhookPaths = append(webhookPaths, endpoint.path)
+	}
+	if cfg.ackButton {
+		mux.HandleFunc(cfg.callbackPath, callbackHandler(live, telegram, down))
+	}
+	reloader := newConfigReloader(live, telegram)
+	mux.HandleFunc(healthPath, healthHandler)
+	mux.HandleFunc(statusPath, statusHandler(live, reloader))
+	mux.HandleFunc("/", rootHandler)
+
+	server := &http.Server{
+		Addr:              cfg.listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	if cfg.tlsCertFile != "" {
+		certs, err := newCertReloader(cfg.tlsCertFile, cfg.tlsKeyFile)
+		if err != nil {
+			log.Fatalf("failed to load TLS certificate: %v", err)
+		}
+		certs.watchSIGHUP()
+		server.TLSConfig = certs.tlsConfig()
+		if cfg.tlsClientCAs != nil {
+			requireClientCertificates(server.TLSConfig, cfg.tlsClientCAs, cfg.tlsAllowedClientNames)
+		}
+	}
+
+	reloader.watchSIGHUP()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("starting", "service", serviceName, "version", version, "commit", commit, "build_date", buildDate)
+	if cfg.echoMode {
+		slog.Warn("ECHO_MODE is enabled: notifications are rendered and echoed back but NOT sent to Telegram")
+	}
+
+	listener, err := listen(cfg.listenAddr, cfg.unixSocketMode)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", cfg.listenAddr, err)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			slog.Info("listening", "addr", cfg.listenAddr, "tls", true, "webhook_paths", strings.Join(webhookPaths, ", "))
+			serverErr <- server.ServeTLS(listener, "", "")
+			return
+		}
+		slog.Info("listening", "addr", cfg.listenAddr, "webhook_paths", strings.Join(webhookPaths, ", "))
+		serverErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown failed", "error", err)
+	}
+	if forward != nil {
+		forward.close()
+	}
+	if quiet != nil {
+		// Send the events held back so far rather than losing them.
+		quiet.flush()
+	}
+	if batch != nil {
+		batch.close()
+	}
+	if recoveries != nil {
+		recoveries.close()
+	}
+	if queue != nil {
+		// Flush whatever is still queued before exiting.
+		queue.close()
+	}
+	if d.spool != nil {
+		d.spool.close()
+	}
+	d.stats.close()
+	if err := states.flush(); err != nil {
+		slog.Error("failed to save state", "error", err)
+	}
+}
+
+// loadConfig reads the configuration from env, completed by CONFIG_FILE,
+// with the profile PROFILE selects, when one is set. env itself is left
+// unchanged.
+func loadConfig(env settings) (config, error) {
+	path := strings.TrimSpace(env.get("CONFIG_FILE"))
+	profile := strings.TrimSpace(env.get("PROFILE"))
+	if path == "" {
+		if profile != "" {
+			return config{}, errors.New("PROFILE requires CONFIG_FILE")
+		}
+		cfg, err := loadEnvConfig(env)
+		cfg.settings = env.known()
+		return cfg, err
+	}
+	file, err := loadConfigFile(path)
+	if err != nil {
+		return config{}, fmt.Errorf("invalid CONFIG_FILE: %w", err)
+	}
+	if err := file.selectProfile(profile); err != nil {
+		return config{}, fmt.Errorf("invalid PROFILE: %w", err)
+	}
+	env = maps.Clone(env)
+	file.apply(env)
+
+	cfg, err := loadEnvConfig(env)
+	if err != nil {
+		return config{}, file.annotate(err)
+	}
+	cfg.settings = env.known()
+	// ROUTING_CONFIG_PATH takes precedence like any other variable.
+	if env.getEnv("ROUTING_CONFIG_PATH", "") == "" && len(file.routingRules) > 0 {
+		location := time.Local
+		if cfg.displayLocation != nil {
+			location = cfg.displayLocation
+		}
+		cfg.routingRules, err = file.rules(location)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid CONFIG_FILE: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+func loadEnvConfig(env settings) (config, error) {
+	cfg := config{
+		listenAddr:      env.getEnv("LISTEN_ADDR", defaultListenAddr),
+		logFormat:       strings.ToLower(env.getEnv("LOG_FORMAT", logFormatText)),
+		webhookPath:     env.getEnv("WEBHOOK_PATH", defaultWebhookPath),
+		telegramBaseURL: env.getEnv("TELEGRAM_API_BASE_URL", defaultTelegramAPIURL),
+		userAgent:       env.getEnv("OUTBOUND_USER_AGENT", env.getEnv("HTTP_USER_AGENT", serviceName+"/"+version)),
+		requestTimeout:  defaultRequestTimeout,
+	}
+
+	cfg.webhookToken = strings.TrimSpace(env.get("WEBHOOK_AUTH_TOKEN"))
+	cfg.webhookHMACKey = strings.TrimSpace(env.get("WEBHOOK_HMAC_SECRET"))
+	cfg.telegramBotToken = strings.TrimSpace(env.get("TELEGRAM_BOT_TOKEN"))
+	cfg.telegramChatID = strings.TrimSpace(env.get("TELEGRAM_CHAT_ID"))
+	cfg.telegramFallbackChatID = strings.TrimSpace(env.get("TELEGRAM_FALLBACK_CHAT_ID"))
+	cfg.deadLetterPath = strings.TrimSpace(env.get("DEAD_LETTER_PATH"))
+
+	if cfg.webhookToken != "" {
+		cfg.webhookTokens = append(cfg.webhookTokens, webhookToken{token: cfg.webhookToken})
+	}
+	tokens, err := parseWebhookTokens(env.getEnv("WEBHOOK_AUTH_TOKENS", ""))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid WEBHOOK_AUTH_TOKENS: %w", err)
+	}
+	for _, token := range tokens {
+		if token.token == cfg.webhookToken {
+			return config{}, errors.New("invalid WEBHOOK_AUTH_TOKENS: token repeats WEBHOOK_AUTH_TOKEN")
+		}
+	}
+	cfg.webhookTokens = append(cfg.webhookTokens, tokens...)
+	if len(cfg.webhookTokens) == 0 && cfg.webhookHMACKey == "" {
+		return config{}, errors.New("WEBHOOK_AUTH_TOKEN, WEBHOOK_AUTH_TOKENS or WEBHOOK_HMAC_SECRET is required")
+	}
+	cfg.authMode = strings.ToLower(env.getEnv("AUTH_MODE", authModeAny))
+	switch cfg.authMode {
+	case authModeAny:
+	case authModeToken:
+		if len(cfg.webhookTokens) == 0 {
+			return config{}, errors.New("AUTH_MODE=token requires WEBHOOK_AUTH_TOKEN or WEBHOOK_AUTH_TOKENS")
+		}
+	case authModeHMAC:
+		if cfg.webhookHMACKey == "" {
+			return config{}, errors.New("AUTH_MODE=hmac requires WEBHOOK_HMAC_SECRET")
+		}
+	case authModeBoth:
+		if len(cfg.webhookTokens) == 0 || cfg.webhookHMACKey == "" {
+			return config{}, errors.New("AUTH_MODE=both requires a webhook token and WEBHOOK_HMAC_SECRET")
+		}
+	case authModeMTLS:
+		// Checked once TLS_CLIENT_CA_FILE has been read.
+	default:
+		return config{}, fmt.Errorf("invalid AUTH_MODE %q: must be any, token, hmac, both or mtls", cfg.authMode)
+	}
+
+	cfg.authAllowHeader = true
+	if headerStr := strings.TrimSpace(env.get("AUTH_ALLOW_HEADER")); headerStr != "" {
+		allow, err := strconv.ParseBool(headerStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid AUTH_ALLOW_HEADER: %w", err)
+		}
+		cfg.authAllowHeader = allow
+	}
+	if queryStr := strings.TrimSpace(env.get("AUTH_ALLOW_QUERY")); queryStr != "" {
+		allow, err := strconv.ParseBool(queryStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid AUTH_ALLOW_QUERY: %w", err)
+		}
+		cfg.authAllowQuery = allow
+	}
+	cfg.notifiers, err = parseNotifiers(env.getEnv("NOTIFIER", notifierTelegram))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid NOTIFIER: %w", err)
+	}
+	if slices.Contains(cfg.notifiers, notifierTelegram) {
+		if cfg.telegramBotToken == "" {
+			return config{}, errors.New("TELEGRAM_BOT_TOKEN is required")
+		}
+		if cfg.telegramChatID == "" {
+			return config{}, errors.New("TELEGRAM_CHAT_ID is required")
+		}
+	}
+	if slices.Contains(cfg.notifiers, notifierSlack) {
+		cfg.slackWebhookURL = strings.TrimSpace(env.get("SLACK_WEBHOOK_URL"))
+		if cfg.slackWebhookURL == "" {
+			return config{}, errors.New("SLACK_WEBHOOK_URL is required when NOTIFIER includes slack")
+		}
+		if err := validateSlackWebhookURL(cfg.slackWebhookURL); err != nil {
+			return config{}, fmt.Errorf("invalid SLACK_WEBHOOK_URL: %w", err)
+		}
+	}
+
+	// TELEGRAM_THREAD_ID is accepted as a shorter alias.
+	if threadStr := env.getEnv("TELEGRAM_MESSAGE_THREAD_ID", strings.TrimSpace(env.get("TELEGRAM_THREAD_ID"))); threadStr != "" {
+		threadID, err := strconv.ParseInt(threadStr, 10, 64)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid TELEGRAM_MESSAGE_THREAD_ID: %w", err)
+		}
+		if threadID <= 0 {
+			return config{}, fmt.Errorf("invalid TELEGRAM_MESSAGE_THREAD_ID: must be a positive integer")
+		}
+		cfg.telegramThreadID = threadID
+	}
+
+	if trendStr := strings.TrimSpace(env.get("SHOW_TREND")); trendStr != "" {
+		showTrend, err := strconv.ParseBool(trendStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SHOW_TREND: %w", err)
+		}
+		cfg.showTrend = showTrend
+	}
+
+	if showPortStr := strings.TrimSpace(env.get("SHOW_PORT_FOR_HTTP")); showPortStr != "" {
+		showPort, err := strconv.ParseBool(showPortStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SHOW_PORT_FOR_HTTP: %w", err)
+		}
+		cfg.showPortForHTTP = showPort
+	}
+
+	if terseStr := strings.TrimSpace(env.get("TERSE_WHEN_MINIMAL")); terseStr != "" {
+		terse, err := strconv.ParseBool(terseStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid TERSE_WHEN_MINIMAL: %w", err)
+		}
+		cfg.terseWhenMinimal = terse
+	}
+
+	if orphanStr := strings.TrimSpace(env.get("SUPPRESS_ORPHAN_RECOVERY")); orphanStr != "" {
+		suppress, err := strconv.ParseBool(orphanStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SUPPRESS_ORPHAN_RECOVERY: %w", err)
+		}
+		cfg.suppressOrphanRecovery = suppress
+	}
+
+	if repeatStr := strings.TrimSpace(env.get("SUPPRESS_REPEATED_RECOVERY")); repeatStr != "" {
+		suppress, err := strconv.ParseBool(repeatStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SUPPRESS_REPEATED_RECOVERY: %w", err)
+		}
+		cfg.suppressRepeatRecovery = suppress
+	}
+
+	cfg.stateFile = env.getEnv("STATE_FILE", "")
+
+	if zone := env.getEnv("DISPLAY_TIMEZONE", ""); zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid DISPLAY_TIMEZONE: %w", err)
+		}
+		cfg.displayLocation = location
+	}
+	cfg.timeFormat = env.getEnv("TIME_FORMAT", displayTimeLayout)
+	// A layout without any date or time element formats every time as itself.
+	if probe := time.Date(1999, time.December, 31, 23, 59, 58, 0, time.UTC); probe.Format(cfg.timeFormat) == cfg.timeFormat {
+		return config{}, fmt.Errorf("invalid TIME_FORMAT %q: must be a Go time layout such as %s", cfg.timeFormat, displayTimeLayout)
+	}
+
+	if ackStr := strings.TrimSpace(env.get("ACK_MUTE_TIMEOUT")); ackStr != "" {
+		timeout, err := time.ParseDuration(ackStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid ACK_MUTE_TIMEOUT: %w", err)
+		}
+		if timeout < 0 {
+			return config{}, errors.New("ACK_MUTE_TIMEOUT must not be negative")
+		}
+		cfg.ackMuteTimeout = timeout
+	}
+
+	if maxInlineStr := strings.TrimSpace(env.get("COMPACT_DATA_MAX_INLINE")); maxInlineStr != "" {
+		maxInline, err := strconv.Atoi(maxInlineStr)
+		if err != nil || maxInline < 0 {
+			return config{}, fmt.Errorf("invalid COMPACT_DATA_MAX_INLINE: must be a non-negative integer")
+		}
+		cfg.compactDataMaxInline = maxInline
+	}
+
+	if routingPath := env.getEnv("ROUTING_CONFIG_PATH", ""); routingPath != "" {
+		location := time.Local
+		if cfg.displayLocation != nil {
+			location = cfg.displayLocation
+		}
+		rules, err := loadRoutingRules(routingPath, location)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid ROUTING_CONFIG_PATH: %w", err)
+		}
+		cfg.routingRules = rules
+	}
+
+	if pinStr := strings.TrimSpace(env.get("PIN_DOWN_MESSAGES")); pinStr != "" {
+		pin, err := strconv.ParseBool(pinStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid PIN_DOWN_MESSAGES: %w", err)
+		}
+		cfg.pinDownMessages = pin
+	}
+	if cfg.pinDownMessages && !slices.Contains(cfg.notifiers, notifierTelegram) {
+		return config{}, errors.New("PIN_DOWN_MESSAGES requires the telegram notifier")
+	}
+
+	if importantStr := strings.TrimSpace(env.get("IMPORTANT_ONLY")); importantStr != "" {
+		importantOnly, err := strconv.ParseBool(importantStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid IMPORTANT_ONLY: %w", err)
+		}
+		cfg.importantOnly = importantOnly
+	}
+
+	if echoStr := strings.TrimSpace(env.get("ECHO_MODE")); echoStr != "" {
+		echo, err := strconv.ParseBool(echoStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid ECHO_MODE: %w", err)
+		}
+		cfg.echoMode = echo
+	}
+
+	if verboseStr := strings.TrimSpace(env.get("VERBOSE_TEST_RESPONSE")); verboseStr != "" {
+		verbose, err := strconv.ParseBool(verboseStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid VERBOSE_TEST_RESPONSE: %w", err)
+		}
+		cfg.verboseTest = verbose
+	}
+
+	// A typo here would otherwise only surface as a confusing error on the
+	// first send.
+	if parsed, err := url.Parse(cfg.telegramBaseURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") ||
+		parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return config{}, fmt.Errorf("invalid TELEGRAM_API_BASE_URL %q: must be an http(s) URL such as %s", cfg.telegramBaseURL, defaultTelegramAPIURL)
+	}
+
+	if proxyURL := strings.TrimSpace(env.get("TELEGRAM_PROXY_URL")); proxyURL != "" {
+		cfg.telegramProxyURL, err = parseProxyURL(proxyURL)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid TELEGRAM_PROXY_URL: %w", err)
+		}
+	}
+	if caFile := strings.TrimSpace(env.get("TELEGRAM_CA_FILE")); caFile != "" {
+		cfg.telegramCAs, err = loadCAFile(caFile)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid TELEGRAM_CA_FILE: %w", err)
+		}
+	}
+
+	cfg.maxPayloadBytes, err = env.positiveIntEnv("MAX_PAYLOAD_BYTES", defaultMaxPayloadBytes)
+	if err != nil {
+		return config{}, err
+	}
+
+	if strictStr := strings.TrimSpace(env.get("STRICT_PAYLOAD")); strictStr != "" {
+		strict, err := strconv.ParseBool(strictStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid STRICT_PAYLOAD: %w", err)
+		}
+		cfg.strictPayload = strict
+	}
+
+	cfg.tlsCertFile = strings.TrimSpace(env.get("TLS_CERT_FILE"))
+	cfg.tlsKeyFile = strings.TrimSpace(env.get("TLS_KEY_FILE"))
+	if (cfg.tlsCertFile == "") != (cfg.tlsKeyFile == "") {
+		return config{}, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.tlsCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.tlsCertFile, cfg.tlsKeyFile); err != nil {
+			return config{}, fmt.Errorf("invalid TLS_CERT_FILE/TLS_KEY_FILE: %w", err)
+		}
+	}
+	if caFile := strings.TrimSpace(env.get("TLS_CLIENT_CA_FILE")); caFile != "" {
+		if cfg.tlsCertFile == "" {
+			return config{}, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		content, err := os.ReadFile(caFile)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid TLS_CLIENT_CA_FILE: %w", err)
+		}
+		cfg.tlsClientCAs = x509.NewCertPool()
+		if !cfg.tlsClientCAs.AppendCertsFromPEM(content) {
+			return config{}, fmt.Errorf("invalid TLS_CLIENT_CA_FILE: no PEM certificates in %s", caFile)
+		}
+		for _, name := range strings.Split(env.getEnv("TLS_ALLOWED_CLIENT_CNS", ""), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.tlsAllowedClientNames = append(cfg.tlsAllowedClientNames, name)
+			}
+		}
+	} else if env.getEnv("TLS_ALLOWED_CLIENT_CNS", "") != "" {
+		return config{}, errors.New("TLS_ALLOWED_CLIENT_CNS requires TLS_CLIENT_CA_FILE")
+	}
+	if cfg.authMode == authModeMTLS && cfg.tlsClientCAs == nil {
+		return config{}, errors.New("AUTH_MODE=mtls requires TLS_CLIENT_CA_FILE")
+	}
+
+	if forwardURL := strings.TrimSpace(env.get("FORWARD_URL")); forwardURL != "" {
+		parsed, err := url.Parse(forwardURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return config{}, fmt.Errorf("invalid FORWARD_URL %q: must be an http(s) URL", forwardURL)
+		}
+		cfg.forwardURL = forwardURL
+	}
+
+	if statsdAddr := strings.TrimSpace(env.get("STATSD_ADDR")); statsdAddr != "" {
+		if _, _, err := net.SplitHostPort(statsdAddr); err != nil {
+			return config{}, fmt.Errorf("invalid STATSD_ADDR: %w", err)
+		}
+		cfg.statsdAddr = statsdAddr
+		cfg.statsdPrefix = env.getEnv("STATSD_PREFIX", defaultStatsdPrefix)
+	}
+
+	if kumaURL := strings.TrimSpace(env.get("UPTIME_KUMA_BASE_URL")); kumaURL != "" {
+		parsed, err := url.Parse(kumaURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return config{}, fmt.Errorf("invalid UPTIME_KUMA_BASE_URL %q: must be an http(s) URL", kumaURL)
+		}
+		cfg.uptimeKumaURL = strings.TrimSuffix(kumaURL, "/")
+	}
+
+	if rawStr := strings.TrimSpace(env.get("LOG_RAW_PAYLOAD")); rawStr != "" {
+		raw, err := strconv.ParseBool(rawStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid LOG_RAW_PAYLOAD: %w", err)
+		}
+		cfg.logRawPayload = raw
+	}
+
+	if logURL := strings.TrimSpace(env.get("LOG_URL_TEMPLATE")); logURL != "" {
+		if err := validateLogURLTemplate(logURL); err != nil {
+			return config{}, fmt.Errorf("invalid LOG_URL_TEMPLATE: %w", err)
+		}
+		cfg.logURLTemplate = logURL
+	}
+
+	if previewStr := strings.TrimSpace(env.get("LINK_PREVIEW")); previewStr != "" {
+		preview, err := strconv.ParseBool(previewStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid LINK_PREVIEW: %w", err)
+		}
+		cfg.linkPreview = preview
+	}
+
+	if pingStr := strings.TrimSpace(env.get("SHOW_UNMEASURED_PING")); pingStr != "" {
+		showPing, err := strconv.ParseBool(pingStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SHOW_UNMEASURED_PING: %w", err)
+		}
+		cfg.showUnmeasuredPing = showPing
+	}
+
+	if relativeStr := strings.TrimSpace(env.get("SHOW_RELATIVE_TIME")); relativeStr != "" {
+		showRelative, err := strconv.ParseBool(relativeStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SHOW_RELATIVE_TIME: %w", err)
+		}
+		cfg.showRelativeTime = showRelative
+	}
+
+	// MESSAGE_LANG and LOCALE are accepted as aliases of MESSAGE_LANGUAGE.
+	language := env.getEnv("MESSAGE_LANGUAGE", env.getEnv("MESSAGE_LANG", env.getEnv("LOCALE", defaultMessageLanguage)))
+	labels, err := lookupMessageLabels(strings.ToLower(language))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid MESSAGE_LANGUAGE: %w", err)
+	}
+	if title := env.getEnv("MESSAGE_TITLE", ""); title != "" {
+		labels.monitorTitle = title
+		labels.testTitle = title + " " + labels.testSuffix
+	}
+	cfg.defaultMonitorName = strings.TrimSpace(env.get("DEFAULT_MONITOR_NAME"))
+	labels.emojiDown = env.getEnv("EMOJI_DOWN", labels.emojiDown)
+	labels.emojiUp = env.getEnv("EMOJI_UP", labels.emojiUp)
+	labels.emojiTest = env.getEnv("EMOJI_TEST", labels.emojiTest)
+	cfg.messageLabels = labels
+
+	switch parseMode := env.getEnv("TELEGRAM_PARSE_MODE", parseModeMarkdownV2); {
+	case strings.EqualFold(parseMode, parseModeMarkdownV2):
+		cfg.parseMode = parseModeMarkdownV2
+	case strings.EqualFold(parseMode, parseModeHTML):
+		cfg.parseMode = parseModeHTML
+	default:
+		return config{}, fmt.Errorf("invalid TELEGRAM_PARSE_MODE %q: must be MarkdownV2 or HTML", parseMode)
+	}
+
+	// TEMPLATE_PATH is the original name of MESSAGE_TEMPLATE_FILE.
+	templatePath := env.getEnv("MESSAGE_TEMPLATE_FILE", strings.TrimSpace(env.get("TEMPLATE_PATH")))
+	if templatePath != "" {
+		tmpl, err := loadMessageTemplate(templatePath)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid MESSAGE_TEMPLATE_FILE: %w", err)
+		}
+		cfg.messageTemplate = tmpl
+	}
+
+	if cfg.logFormat != logFormatText && cfg.logFormat != logFormatJSON {
+		return config{}, fmt.Errorf("invalid LOG_FORMAT %q: must be text or json", cfg.logFormat)
+	}
+	if levelStr := strings.TrimSpace(env.get("LOG_LEVEL")); levelStr != "" {
+		if err := cfg.logLevel.UnmarshalText([]byte(levelStr)); err != nil {
+			return config{}, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", levelStr)
+		}
+	}
+
+	if windowStr := strings.TrimSpace(env.get("DEDUP_WINDOW")); windowStr != "" {
+		window, err := time.ParseDuration(windowStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid DEDUP_WINDOW: %w", err)
+		}
+		if window < 0 {
+			return config{}, errors.New("DEDUP_WINDOW must not be negative")
+		}
+		cfg.dedupWindow = window
+	}
+	cfg.dedupKeyFields = defaultDedupKeyFields
+	if fieldsStr := strings.TrimSpace(env.get("DEDUP_KEY_FIELDS")); fieldsStr != "" {
+		fields, err := parseDedupKeyFields(fieldsStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid DEDUP_KEY_FIELDS: %w", err)
+		}
+		cfg.dedupKeyFields = fields
+	}
+
+	if asyncStr := strings.TrimSpace(env.get("ASYNC_DELIVERY")); asyncStr != "" {
+		async, err := strconv.ParseBool(asyncStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid ASYNC_DELIVERY: %w", err)
+		}
+		cfg.asyncDelivery = async
+	}
+	cfg.queueSize, err = env.positiveIntEnv("QUEUE_SIZE", defaultQueueSize)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.queueWorkers, err = env.positiveIntEnv("QUEUE_WORKERS", defaultQueueWorkers)
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg.queueRetries = defaultQueueRetries
+	if retriesStr := strings.TrimSpace(env.get("QUEUE_MAX_RETRIES")); retriesStr != "" {
+		retries, err := strconv.Atoi(retriesStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid QUEUE_MAX_RETRIES: %w", err)
+		}
+		if retries < 0 {
+			return config{}, errors.New("QUEUE_MAX_RETRIES must not be negative")
+		}
+		cfg.queueRetries = retries
+	}
+	cfg.queueRetryBackoff, err = env.positiveDurationEnv("QUEUE_RETRY_BACKOFF", defaultQueueRetryBackoff)
+	if err != nil {
+		return config{}, err
+	}
+	// Synchronous sends are attempted once, so retry settings would
+	// otherwise be ignored without a trace.
+	if !cfg.asyncDelivery && (env.get("QUEUE_MAX_RETRIES") != "" || env.get("QUEUE_RETRY_BACKOFF") != "") {
+		cfg.warnings = append(cfg.warnings, "QUEUE_MAX_RETRIES and QUEUE_RETRY_BACKOFF only apply with ASYNC_DELIVERY=true; failed sends will not be retried")
+	}
+
+	switch semantics := strings.ToLower(env.getEnv("DELIVERY_SEMANTICS", "at-least-once")); semantics {
+	case "at-least-once":
+	case "at-most-once":
+		cfg.atMostOnce = true
+	default:
+		return config{}, fmt.Errorf("invalid DELIVERY_SEMANTICS %q: must be at-least-once or at-most-once", semantics)
+	}
+
+	if rpsStr := strings.TrimSpace(env.get("RATE_LIMIT_RPS")); rpsStr != "" {
+		rps, err := strconv.ParseFloat(rpsStr, 64)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid RATE_LIMIT_RPS: %w", err)
+		}
+		if rps <= 0 || math.IsInf(rps, 0) || math.IsNaN(rps) {
+			return config{}, errors.New("RATE_LIMIT_RPS must be positive")
+		}
+		cfg.rateLimitRPS = rps
+	}
+	if perMinuteStr := strings.TrimSpace(env.get("RATE_LIMIT_PER_MINUTE")); perMinuteStr != "" {
+		if cfg.rateLimitRPS > 0 {
+			return config{}, errors.New("RATE_LIMIT_RPS and RATE_LIMIT_PER_MINUTE cannot be used together")
+		}
+		perMinute, err := strconv.Atoi(perMinuteStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid RATE_LIMIT_PER_MINUTE: %w", err)
+		}
+		if perMinute <= 0 {
+			return config{}, errors.New("RATE_LIMIT_PER_MINUTE must be positive")
+		}
+		cfg.rateLimitRPS = float64(perMinute) / 60
+	}
+	cfg.rateLimitBurst, err = env.positiveIntEnv("RATE_LIMIT_BURST", max(1, int(math.Ceil(cfg.rateLimitRPS))))
+	if err != nil {
+		return config{}, err
+	}
+	switch scope := strings.ToLower(env.getEnv("RATE_LIMIT_SCOPE", "ip")); scope {
+	case "ip":
+	case "global":
+		cfg.rateLimitGlobal = true
+	default:
+		return config{}, fmt.Errorf("invalid RATE_LIMIT_SCOPE %q: must be ip or global", scope)
+	}
+	cfg.trustedProxies, err = parseNetworks(env.getEnv("TRUSTED_PROXY_CIDRS", ""))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid TRUSTED_PROXY_CIDRS: %w", err)
+	}
+	cfg.allowedSources, err = parseNetworks(env.getEnv("ALLOWED_SOURCE_CIDRS", ""))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid ALLOWED_SOURCE_CIDRS: %w", err)
+	}
+
+	cfg.spoolDir = env.getEnv("SPOOL_DIR", "")
+	cfg.spoolInterval, err = env.positiveDurationEnv("SPOOL_RETRY_INTERVAL", defaultSpoolInterval)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.spoolMaxAge, err = env.positiveDurationEnv("SPOOL_MAX_AGE", defaultSpoolMaxAge)
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg.maxTelegramConcurrency, err = env.positiveIntEnv("MAX_TELEGRAM_CONCURRENCY", 0)
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg.batchInterval, err = env.positiveDurationEnv("BATCH_INTERVAL", 0)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.digestWindow, err = env.positiveDurationEnv("DIGEST_WINDOW", 0)
+	if err != nil {
+		return config{}, err
+	}
+	if cfg.batchInterval > 0 && cfg.digestWindow > 0 {
+		return config{}, errors.New("BATCH_INTERVAL and DIGEST_WINDOW cannot be used together")
+	}
+	cfg.recoveryDigestWindow, err = env.positiveDurationEnv("RECOVERY_DIGEST_WINDOW", 0)
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg.flapThreshold, err = env.positiveIntEnv("FLAP_THRESHOLD", 0)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.flapWindow, err = env.positiveDurationEnv("FLAP_WINDOW", defaultFlapWindow)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.flapCooldown, err = env.positiveDurationEnv("FLAP_COOLDOWN", cfg.flapWindow)
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg.unixSocketMode = 0o660
+	if modeStr := strings.TrimSpace(env.get("UNIX_SOCKET_MODE")); modeStr != "" {
+		mode, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil || mode > 0o777 {
+			return config{}, fmt.Errorf("invalid UNIX_SOCKET_MODE %q: must be an octal file mode such as 0660", modeStr)
+		}
+		cfg.unixSocketMode = fs.FileMode(mode)
+	}
+
+	if !strings.HasPrefix(cfg.webhookPath, "/") {
+		return config{}, errors.New("WEBHOOK_PATH must start with /")
+	}
+	cfg.webhookEndpoints = []webhookEndpoint{{path: cfg.webhookPath}}
+	if pathsStr := strings.TrimSpace(env.get("WEBHOOK_PATHS")); pathsStr != "" {
+		endpoints, err := parseWebhookEndpoints(pathsStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid WEBHOOK_PATHS: %w", err)
+		}
+		cfg.webhookEndpoints = endpoints
+	}
+	for _, endpoint := range cfg.webhookEndpoints {
+		if endpoint.path == healthPath || endpoint.path == statusPath {
+			return config{}, fmt.Errorf("webhook path %s is reserved", endpoint.path)
+		}
+	}
+
+	if quietStr := env.getEnv("QUIET_HOURS", ""); quietStr != "" {
+		location := time.Local
+		if cfg.displayLocation != nil {
+			location = cfg.displayLocation
+		}
+		if zone := env.getEnv("QUIET_HOURS_TZ", ""); zone != "" {
+			location, err = time.LoadLocation(zone)
+			if err != nil {
+				return config{}, fmt.Errorf("invalid QUIET_HOURS_TZ: %w", err)
+			}
+		}
+		cfg.quietHours, err = parseQuietHours(quietStr, location)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid QUIET_HOURS: %w", err)
+		}
+		for _, name := range strings.Split(env.getEnv("QUIET_HOURS_BREAKTHROUGH", ""), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if _, err := path.Match(name, ""); err != nil {
+					return config{}, fmt.Errorf("invalid QUIET_HOURS_BREAKTHROUGH pattern %q: %w", name, err)
+				}
+				cfg.quietHours.breakthrough = append(cfg.quietHours.breakthrough, name)
+			}
+		}
+	}
+
+	if ackStr := strings.TrimSpace(env.get("ENABLE_ACK_BUTTON")); ackStr != "" {
+		ack, err := strconv.ParseBool(ackStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid ENABLE_ACK_BUTTON: %w", err)
+		}
+		cfg.ackButton = ack
+	}
+	if cfg.ackButton && !slices.Contains(cfg.notifiers, notifierTelegram) {
+		return config{}, errors.New("ENABLE_ACK_BUTTON requires the telegram notifier")
+	}
+	if cfg.ackButton && cfg.tlsClientCAs != nil {
+		// Telegram can't present a client certificate for button presses.
+		return config{}, errors.New("ENABLE_ACK_BUTTON cannot be used with TLS_CLIENT_CA_FILE")
+	}
+	if cfg.ackButton {
+		cfg.callbackPath = env.getEnv("TELEGRAM_CALLBACK_PATH", defaultCallbackPath)
+		if !strings.HasPrefix(cfg.callbackPath, "/") {
+			return config{}, errors.New("TELEGRAM_CALLBACK_PATH must start with /")
+		}
+		if cfg.callbackPath == healthPath || cfg.callbackPath == statusPath {
+			return config{}, fmt.Errorf("TELEGRAM_CALLBACK_PATH %s is reserved", cfg.callbackPath)
+		}
+		for _, endpoint := range cfg.webhookEndpoints {
+			if cfg.callbackPath == endpoint.path {
+				return config{}, errors.New("TELEGRAM_CALLBACK_PATH must differ from WEBHOOK_PATH and WEBHOOK_PATHS")
+			}
+		}
+		// Without the secret anyone could acknowledge alerts.
+		cfg.telegramWebhookSecret = env.getEnv("TELEGRAM_WEBHOOK_SECRET", "")
+		if cfg.telegramWebhookSecret == "" {
+			return config{}, errors.New("TELEGRAM_WEBHOOK_SECRET is required when ENABLE_ACK_BUTTON is set")
+		}
+	}
+
+	if timeoutStr := strings.TrimSpace(env.get("REQUEST_TIMEOUT")); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid REQUEST_TIMEOUT: %w", err)
+		}
+		if timeout <= 0 {
+			return config{}, errors.New("REQUEST_TIMEOUT must be positive")
+		}
+		cfg.requestTimeout = timeout
+	}
+
+	if err := loadQueueDeliveryTimeout(&cfg, env); err != nil {
+		return config{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadQueueDeliveryTimeout reads QUEUE_DELIVERY_TIMEOUT, the time a queued
+// notification may take including its retries. When it can't fit a single
+// retry, i.e. a failed attempt, the backoff and another attempt, the retry
+// settings would have no effect: the timeout is then raised to fit one with
+// QUEUE_DELIVERY_TIMEOUT_EXTEND=true, and a warning is recorded otherwise.
+func loadQueueDeliveryTimeout(cfg *config, env settings) error {
+	if timeoutStr := strings.TrimSpace(env.get("QUEUE_DELIVERY_TIMEOUT")); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return fmt.Errorf("invalid QUEUE_DELIVERY_TIMEOUT: %w", err)
+		}
+		if timeout < 0 {
+			return errors.New("QUEUE_DELIVERY_TIMEOUT must not be negative")
+		}
+		cfg.queueDeliveryTimeout = timeout
+	}
+	extend := false
+	if extendStr := strings.TrimSpace(env.get("QUEUE_DELIVERY_TIMEOUT_EXTEND")); extendStr != "" {
+		var err error
+		if extend, err = strconv.ParseBool(extendStr); err != nil {
+			return fmt.Errorf("invalid QUEUE_DELIVERY_TIMEOUT_EXTEND: %w", err)
+		}
+	}
+
+	needed := 2*cfg.requestTimeout + cfg.queueRetryBackoff
+	if !cfg.asyncDelivery || cfg.queueRetries == 0 || cfg.queueDeliveryTimeout == 0 || cfg.queueDeliveryTimeout >= needed {
+		return nil
+	}
+	if extend {
+		cfg.warnings = append(cfg.warnings, fmt.Sprintf("QUEUE_DELIVERY_TIMEOUT raised from %s to %s to fit one retry (two REQUEST_TIMEOUT attempts and QUEUE_RETRY_BACKOFF)", cfg.queueDeliveryTimeout, needed))
+		cfg.queueDeliveryTimeout = needed
+		return nil
+	}
+	cfg.warnings = append(cfg.warnings, fmt.Sprintf("QUEUE_DELIVERY_TIMEOUT %s is too short for a retry, which needs %s (two REQUEST_TIMEOUT attempts and QUEUE_RETRY_BACKOFF); failed sends will not be retried. Raise it or set QUEUE_DELIVERY_TIMEOUT_EXTEND=true", cfg.queueDeliveryTimeout, needed))
+	return nil
+}
+
+func webhookHandler(live *atomic.Pointer[config], instance string, d *dispatcher, dedup *deduplicator, states *downTracker, history *alertHistory, flaps *flapDetector, quiet *quietBuffer, batch, recoveries *batcher, queue *deliveryQueue, forward *forwarder) http.HandlerFunc {
+	var limiters atomic.Pointer[rateLimiter]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Read once per request so a reload doesn't change the settings
+		// halfway through.
+		cfg := *live.Load()
+		id := requestIDFrom(r.Context())
+		logger := slog.With("request_id", id)
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if len(cfg.allowedSources) > 0 {
+			client := clientIP(r, cfg.trustedProxies)
+			if ip := net.ParseIP(client); ip == nil || !containsIP(cfg.allowedSources, ip) {
+				logger.Warn("webhook from disallowed source rejected", "client", client)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		if limiter := currentLimiter(&limiters, cfg); limiter != nil {
+			key := "global"
+			if !cfg.rateLimitGlobal {
+				key = clientIP(r, cfg.trustedProxies)
+			}
+			if ok, wait := limiter.allow(key, time.Now()); !ok {
+				logger.Warn("webhook rate limited", "client", key)
+				writeRateLimited(w, wait)
+				return
+			}
+		}
+
+		// The body is read before authorizing so the HMAC signature can be
+		// verified against the exact bytes that were sent (after
+		// decompression, for gzip encoded bodies).
+		defer r.Body.Close()
+		body, err := readWebhookBody(r, cfg.maxPayloadBytes)
+		if errors.Is(err, errPayloadTooLarge) {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			logger.Warn("failed to read request body", "error", err)
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		source, tokenOK := matchToken(cfg, r)
+		signature := r.Header.Get("X-Signature-256")
+		if signature == "" {
+			signature = r.Header.Get("X-Signature")
+		}
+		signatureOK := cfg.webhookHMACKey != "" && validSignature(cfg.webhookHMACKey, body, signature)
+		var authorized bool
+		switch cfg.authMode {
+		case authModeToken:
+			authorized = tokenOK
+		case authModeHMAC:
+			authorized = signatureOK
+		case authModeBoth:
+			authorized = tokenOK && signatureOK
+		case authModeMTLS:
+			// The TLS handshake already required and verified the certificate.
+			authorized = r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+		default:
+			authorized = tokenOK || signatureOK
+		}
+		if !authorized {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if len(body) == 0 {
+			http.Error(w, "empty body", http.StatusBadRequest)
+			return
+		}
+
+		// Arrays and scalars can't be read as a notification. They are sent
+		// as raw data with a note, or rejected in strict mode.
+		nonObject := isNonObjectJSON(body)
+		if nonObject && cfg.strictPayload {
+			http.Error(w, "payload must be a JSON object", http.StatusUnprocessableEntity)
+			return
+		}
+
+		// The body is decoded once; everything below works on payload.
+		payload, err := decodePayload(body)
+		if nonObject {
+			logger.Info("payload is JSON but not an object, forwarding it as raw data")
+		} else if err != nil {
+			logger.Warn("invalid JSON payload", "error", err)
+		}
+
+		monitorName := payload.displayName(cfg.defaultMonitorName)
+		status := payload.statusCode()
+		logger.Info("webhook received", "remote_ip", clientIP(r, cfg.trustedProxies), "monitor_name", monitorName, "status", status)
+		d.stats.count("webhook.received", 1)
+		// The payload is user data, such as internal hostnames, kept out of
+		// the operational log unless asked for or debugging.
+		if cfg.logRawPayload {
+			logger.Info("webhook payload", "body", string(body))
+		} else {
+			logger.Debug("webhook payload", "body", string(body))
+		}
+
+		if forward != nil {
+			forward.forward(body, r.Header.Get("Content-Type"))
+		}
+
+		if cfg.importantOnly && !payload.isImportant() {
+			logger.Info("non-important heartbeat skipped", "monitor_name", monitorName, "status", status)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if dedup != nil && !cfg.echoMode && !payload.isTest() && dedup.duplicate(payload, time.Now()) {
+			logger.Info("duplicate notification dropped", "monitor_name", monitorName, "status", status)
+			writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "duplicate": true})
+			return
+		}
+
+		var downFor time.Duration
+		var recentFailures int
+		if !cfg.echoMode && !payload.isTest() {
+			now := time.Now()
+			if history != nil {
+				// The trend is shown on DOWN alerts of a monitor that already
+				// failed within the window; a first failure has no trend yet.
+				history.record(payload, now)
+				if failures := history.count(payload.monitorKey(), "0", now.Add(-trendWindow)); status == "0" && failures > 1 {
+					recentFailures = failures
+				}
+			}
+			since, wasDown, wasUp := states.observe(payload, now)
+			if cfg.suppressRepeatRecovery && status == "1" && wasUp {
+				logger.Info("repeated recovery skipped, monitor is already UP", "monitor_name", monitorName)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if cfg.suppressOrphanRecovery && status == "1" && !wasDown {
+				logger.Info("recovery without a prior DOWN skipped", "monitor_name", monitorName)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if status == "0" && states.muted(payload, now, cfg.ackMuteTimeout) {
+				logger.Info("DOWN notification muted by acknowledgement", "monitor_name", monitorName)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			downFor = downtime(payload, since, now)
+		}
+
+		opts := newMessageOptions(cfg)
+		if source.label != "" {
+			opts.labels = opts.labels.withSource(source.label)
+		}
+		if instance != "" {
+			opts.labels = opts.labels.withSource(instance)
+		}
+		// Without a tracked DOWN, e.g. after a restart, fall back to the
+		// duration Uptime Kuma reports for the recovery.
+		if downFor == 0 && !payload.isTest() {
+			downFor = reportedDowntime(payload)
+		}
+		opts.downtime = downFor
+		opts.recentFailures = recentFailures
+		if cfg.logURLTemplate != "" {
+			opts.logURL = expandLogURL(cfg.logURLTemplate, id, monitorName, payload.monitorKey())
+		}
+		text, attachment := buildTelegramMessage(payload, body, opts)
+		message := outgoingMessage{text: text, document: attachment}
+		opts.format = formatter{}
+		message.plainText, _ = buildTelegramMessage(payload, body, opts)
+		if slices.Contains(cfg.notifiers, notifierSlack) {
+			// Incoming webhooks can't attach files, so the data stays inline.
+			opts.format, opts.compactDataMaxInline = formatter{parseMode: parseModeSlack}, 0
+			message.slackText, _ = buildTelegramMessage(payload, body, opts)
+		}
+		if button, ok := dashboardButton(cfg.uptimeKumaURL, payload, cfg.messageLabels); ok {
+			message.keyboard = append(message.keyboard, []inlineKeyboardButton{button})
+		}
+		if cfg.ackButton && status == "0" && !payload.isTest() {
+			if button, ok := ackButton(payload.monitorKey(), states.downSince(payload.monitorKey()), cfg.messageLabels); ok {
+				message.keyboard = append(message.keyboard, []inlineKeyboardButton{button})
+			}
+		}
+
+		// Echo mode is a debugging aid: show what would be sent and stop.
+		if cfg.echoMode {
+			echo := map[string]any{
+				"ok":         true,
+				"echo":       true,
+				"alert":      newTemplateData(payload, body, cfg.messageLabels, cfg.defaultMonitorName),
+				"message":    message.text,
+				"plain_text": message.plainText,
+				"keyboard":   message.keyboard,
+			}
+			if message.slackText != "" {
+				echo["slack_text"] = message.slackText
+			}
+			writeJSON(w, http.StatusOK, echo)
+			return
+		}
+
+		job := delivery{message: message, raw: body, monitorID: payload.monitorKey(), monitorName: monitorName, status: status,
+			chatID: cfg.telegramChatID, threadID: cfg.telegramThreadID, requestID: id}
+		if source.chatID != "" {
+			job.chatID, job.threadID = source.chatID, 0
+		}
+		if route, ok := routeFor(cfg.routingRules, monitorName); ok {
+			if !payload.isTest() && !route.active(time.Now()) {
+				logger.Info("alert outside the monitor's active hours dropped", "monitor_name", monitorName, "status", status)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if route.chatID != "" {
+				job.chatID, job.threadID = route.chatID, route.ThreadID
+			}
+		}
+
+		if flaps != nil && !payload.isTest() {
+			switch event, changes := flaps.observe(payload, monitorName, time.Now()); event {
+			case flapOngoing:
+				logger.Info("flapping monitor alert suppressed", "monitor_name", monitorName, "status", status, "changes", changes)
+				writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "flapping": true})
+				return
+			case flapStarted:
+				logger.Info("monitor started flapping", "monitor_name", monitorName, "changes", changes)
+				notice := noticeJob(cfg, job.monitorID, monitorName, status, func(f formatter) string {
+					return buildFlappingMessage(monitorName, changes, cfg.flapWindow, f, cfg.messageLabels)
+				})
+				notice.raw = body
+				job = notice
+			}
+		}
+
+		// Test notifications always go through so the setup can be verified.
+		if quiet != nil && !payload.isTest() && quiet.hold(payload, monitorName, time.Now()) {
+			logger.Info("notification held for quiet hours digest", "monitor_name", monitorName, "status", status)
+			writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "quiet": true})
+			return
+		}
+
+		// Verbose test responses need the delivery result, so they are
+		// always sent synchronously.
+		verbose := cfg.verboseTest && payload.isTest()
+		if recoveries != nil && !payload.isTest() && status == "1" {
+			recoveries.add(job)
+			writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "batched": true})
+			return
+		}
+		if batch != nil && !verbose {
+			batch.add(job)
+			writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "batched": true})
+			return
+		}
+		if queue != nil && !verbose {
+			if !queue.enqueue(job) {
+				queueErr := errors.New("delivery queue is full")
+				logger.Error("dropping notification", "error", queueErr, "monitor_name", monitorName, "status", status)
+				d.deadLetter(job, queueErr)
+				http.Error(w, "delivery queue is full", http.StatusServiceUnavailable)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "queued": true})
+			return
+		}
+
+		sent, err := d.deliver(r.Context(), job)
+		if err != nil {
+			if verbose {
+				writeJSON(w, http.StatusBadGateway, map[string]any{"ok": false, "error": err.Error()})
+				return
+			}
+			http.Error(w, "failed to forward notification", http.StatusBadGateway)
+			return
+		}
+
+		if verbose {
+			writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "message_id": sent.MessageID, "chat": sent.Chat})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}
+}
+
+// errPayloadTooLarge is returned by readWebhookBody for bodies over the
+// size limit.
+var errPayloadTooLarge = errors.New("payload too large")
+
+// readWebhookBody reads at most limit bytes of the request body,
+// transparently decompressing it when it is sent with Content-Encoding: gzip.
+// For gzip the limit applies to the decompressed size, so a small compressed
+// body can't expand without bound.
+func readWebhookBody(r *http.Request, limit int) ([]byte, error) {
+	if r.ContentLength > int64(limit) {
+		return nil, errPayloadTooLarge
+	}
+
+	reader := io.Reader(r.Body)
+	if strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompress body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	// Reading one byte past the limit tells a body of exactly limit bytes
+	// apart from a longer one that was cut off.
+	body, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if len(body) > limit {
+		return nil, errPayloadTooLarge
+	}
+	return body, nil
+}
+
+// secureCompare compares two secrets in constant time. Both values are hashed
+// first so the comparison does not return early when their lengths differ.
+func secureCompare(provided, expected string) bool {
+	providedSum := sha256.Sum256([]byte(provided))
+	expectedSum := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(providedSum[:], expectedSum[:]) == 1
+}
+
+// webhookToken is an accepted webhook token. Tokens from WEBHOOK_AUTH_TOKENS
+// also name the chat their alerts go to and a label for the message header.
+type webhookToken struct {
+	token  string
+	chatID string
+	label  string
+}
+
+// parseWebhookTokens parses comma separated token:chatID[:label] entries.
+func parseWebhookTokens(value string) ([]webhookToken, error) {
+	var tokens []webhookToken
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.New("entries must look like token:chatID[:label]")
+		}
+		token := webhookToken{token: strings.TrimSpace(parts[0]), chatID: strings.TrimSpace(parts[1])}
+		if len(parts) == 3 {
+			token.label = strings.TrimSpace(parts[2])
+		}
+		if seen[token.token] {
+			return nil, errors.New("duplicate token")
+		}
+		seen[token.token] = true
+		tokens = append(tokens, token)
 	}
+	return tokens, nil
+}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/uptimekuma-webhook", webhookHandler(cfg, client))
+// webhookEndpoint is a path webhooks are accepted on. Alerts received on a
+// named endpoint carry the name in their message header.
+type webhookEndpoint struct {
+	name string
+	path string
+}
 
-	server := &http.Server{
-		Addr:              cfg.listenAddr,
-		Handler:           mux,
-		ReadHeaderTimeout: 5 * time.Second,
+// parseWebhookEndpoints parses comma separated name:/path entries.
+func parseWebhookEndpoints(value string) ([]webhookEndpoint, error) {
+	var endpoints []webhookEndpoint
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, urlPath, ok := strings.Cut(entry, ":")
+		endpoint := webhookEndpoint{name: strings.TrimSpace(name), path: strings.TrimSpace(urlPath)}
+		if !ok || endpoint.name == "" || !strings.HasPrefix(endpoint.path, "/") {
+			return nil, errors.New("entries must look like name:/path")
+		}
+		if endpoint.path == "/" {
+			return nil, errors.New("path / is reserved")
+		}
+		if seen[endpoint.path] {
+			return nil, fmt.Errorf("duplicate path %s", endpoint.path)
+		}
+		seen[endpoint.path] = true
+		endpoints = append(endpoints, endpoint)
 	}
-
-	log.Printf("listening on %s", cfg.listenAddr)
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("server error: %v", err)
+	if len(endpoints) == 0 {
+		return nil, errors.New("no paths given")
 	}
+	return endpoints, nil
 }
 
-func loadConfig() (config, error) {
-	cfg := config{
-		listenAddr:      getEnv("LISTEN_ADDR", defaultListenAddr),
-		telegramBaseURL: getEnv("TELEGRAM_API_BASE_URL", defaultTelegramAPIURL),
-		requestTimeout:  defaultRequestTimeout,
+// matchToken returns the configured token r authenticates with. Every
+// candidate is compared, without stopping at the first match, so the time
+// taken does not reveal which one matched.
+func matchToken(cfg config, r *http.Request) (webhookToken, bool) {
+	var matched webhookToken
+	found := false
+	for _, candidate := range cfg.webhookTokens {
+		if validToken(cfg, r, candidate.token) && !found {
+			matched, found = candidate, true
+		}
 	}
+	return matched, found
+}
 
-	cfg.webhookToken = strings.TrimSpace(os.Getenv("WEBHOOK_AUTH_TOKEN"))
-	cfg.telegramBotToken = strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
-	cfg.telegramChatID = strings.TrimSpace(os.Getenv("TELEGRAM_CHAT_ID"))
-
-	if cfg.webhookToken == "" {
-		return config{}, errors.New("WEBHOOK_AUTH_TOKEN is required")
+// validToken reports whether r carries token, either as a Bearer
+// Authorization header or, when enabled, in the X-Webhook-Token header or the
+// token query parameter. Every enabled source is compared so the time taken
+// does not reveal which one matched.
+func validToken(cfg config, r *http.Request, token string) bool {
+	ok := secureCompare(r.Header.Get("Authorization"), "Bearer "+token)
+	if cfg.authAllowHeader {
+		ok = secureCompare(r.Header.Get("X-Webhook-Token"), token) || ok
 	}
-	if cfg.telegramBotToken == "" {
-		return config{}, errors.New("TELEGRAM_BOT_TOKEN is required")
-	}
-	if cfg.telegramChatID == "" {
-		return config{}, errors.New("TELEGRAM_CHAT_ID is required")
+	if cfg.authAllowQuery {
+		ok = secureCompare(r.URL.Query().Get("token"), token) || ok
 	}
+	return ok
+}
 
-	if timeoutStr := strings.TrimSpace(os.Getenv("REQUEST_TIMEOUT")); timeoutStr != "" {
-		timeout, err := time.ParseDuration(timeoutStr)
-		if err != nil {
-			return config{}, fmt.Errorf("invalid REQUEST_TIMEOUT: %w", err)
-		}
-		if timeout <= 0 {
-			return config{}, errors.New("REQUEST_TIMEOUT must be positive")
-		}
-		cfg.requestTimeout = timeout
+// validSignature checks that signature is the hex encoded HMAC-SHA256 of body
+// under secret. An optional "sha256=" prefix is accepted.
+func validSignature(secret string, body []byte, signature string) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	provided, err := hex.DecodeString(signature)
+	if err != nil || len(provided) == 0 {
+		return false
 	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(provided, mac.Sum(nil))
+}
 
-	return cfg, nil
+// rootHandler describes the service on GET / and answers every other
+// unregistered path with a JSON 404.
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": "not found"})
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"ok": false, "error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"service": serviceName,
+		"version": version,
+		"docs":    docsURL,
+	})
 }
 
-func webhookHandler(cfg config, client *telegramClient) http.HandlerFunc {
-	expectedAuthHeader := "Bearer " + cfg.webhookToken
+// healthHandler reports that the service is up and which build is running.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"ok": false, "error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":         true,
+		"version":    version,
+		"commit":     commit,
+		"build_date": buildDate,
+	})
+}
 
+// statusHandler reports the running configuration's state: the notifiers,
+// when the configuration was loaded and how the last reload went. Reload
+// errors can describe the configuration, so like the webhook it requires a
+// token (or, with AUTH_MODE=mtls, a client certificate) and honours
+// ALLOWED_SOURCE_CIDRS. ok is false while the last reload has failed.
+func statusHandler(live *atomic.Pointer[config], reloader *configReloader) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			w.Header().Set("Allow", http.MethodPost)
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		cfg := *live.Load()
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"ok": false, "error": "method not allowed"})
 			return
 		}
-
-		if r.Header.Get("Authorization") != expectedAuthHeader {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
+		if len(cfg.allowedSources) > 0 {
+			if ip := net.ParseIP(clientIP(r, cfg.trustedProxies)); ip == nil || !containsIP(cfg.allowedSources, ip) {
+				writeJSON(w, http.StatusForbidden, map[string]any{"ok": false, "error": "forbidden"})
+				return
+			}
 		}
-
-		defer r.Body.Close()
-		body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadBytes))
-		if err != nil {
-			log.Printf("failed to read request body: %v", err)
-			http.Error(w, "failed to read body", http.StatusBadRequest)
-			return
+		_, authorized := matchToken(cfg, r)
+		if cfg.authMode == authModeMTLS {
+			authorized = r.TLS != nil && len(r.TLS.VerifiedChains) > 0
 		}
-		if len(body) == 0 {
-			http.Error(w, "empty body", http.StatusBadRequest)
+		if !authorized {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"ok": false, "error": "unauthorized"})
 			return
 		}
 
-		payload := map[string]any{}
-		decoder := json.NewDecoder(bytes.NewReader(body))
-		decoder.UseNumber()
-		if err := decoder.Decode(&payload); err != nil {
-			log.Printf("invalid JSON payload: %v", err)
+		status := reloader.status()
+		response := map[string]any{
+			"ok":               status.lastErr == nil,
+			"version":          version,
+			"notifiers":        cfg.notifiers,
+			"config_loaded_at": status.loadedAt.UTC().Format(time.RFC3339),
 		}
+		if !status.lastAttempt.IsZero() {
+			lastReload := map[string]any{"at": status.lastAttempt.UTC().Format(time.RFC3339), "ok": status.lastErr == nil}
+			if status.lastErr != nil {
+				lastReload["error"] = status.lastErr.Error()
+			}
+			response["last_reload"] = lastReload
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
 
-		log.Printf("body raw json: %v", string(body))
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
 
-		message := buildTelegramMessage(payload, body)
-		ctx, cancel := context.WithTimeout(r.Context(), client.requestTimeout)
-		defer cancel()
+// messageOptions controls how buildTelegramMessage renders a notification.
+type messageOptions struct {
+	format               formatter
+	template             *template.Template
+	labels               messageLabels
+	showRelativeTime     bool
+	showUnmeasuredPing   bool
+	downtime             time.Duration  // how long a recovered monitor was down; zero omits the line
+	compactDataMaxInline int            // compact data longer than this many runes is attached; 0 means always inline
+	location             *time.Location // zone heartbeat.time is shown in; nil shows localDateTime as sent
+	timeFormat           string         // layout of converted times; empty means displayTimeLayout
+	showPortForHTTP      bool           // keep the port next to the host for HTTP monitors whose URL already has it
+	defaultMonitorName   string         // subject of payloads the monitor name can't be derived from
+	terseWhenMinimal     bool           // render payloads with nothing but a name and status as a one-liner
+	recentFailures       int            // outages of the monitor begun within trendWindow; zero omits the trend line
+	logURL               string         // link to the request's logs; empty omits the line
+	now                  time.Time      // reference for relative times; zero means time.Now()
+}
 
-		if err := client.sendMessage(ctx, message); err != nil {
-			log.Printf("failed to send telegram message: %v", err)
-			http.Error(w, "failed to forward notification", http.StatusBadGateway)
-			return
+// newMessageOptions returns the rendering options configured by cfg. Fields
+// that depend on monitor state are left for the caller.
+func newMessageOptions(cfg config) messageOptions {
+	return messageOptions{
+		format:               formatter{parseMode: cfg.parseMode},
+		template:             cfg.messageTemplate,
+		labels:               cfg.messageLabels,
+		showRelativeTime:     cfg.showRelativeTime,
+		showUnmeasuredPing:   cfg.showUnmeasuredPing,
+		compactDataMaxInline: cfg.compactDataMaxInline,
+		location:             cfg.displayLocation,
+		timeFormat:           cfg.timeFormat,
+		showPortForHTTP:      cfg.showPortForHTTP,
+		defaultMonitorName:   cfg.defaultMonitorName,
+		terseWhenMinimal:     cfg.terseWhenMinimal,
+	}
+}
+
+// buildTelegramMessage renders the notification text. When the compact data
+// section exceeds opts.compactDataMaxInline it is replaced by a note and its
+// content is returned as document to be attached instead. payload is raw
+// decoded by decodePayload, zero when raw isn't a JSON object.
+func buildTelegramMessage(payload kumaPayload, raw []byte, opts messageOptions) (string, *document) {
+	f, l := opts.format, opts.labels
+
+	if opts.template != nil {
+		text, err := renderTemplate(opts.template, payload, raw, f, l, opts.defaultMonitorName)
+		if err == nil && text != "" {
+			return text, nil
+		}
+		if err != nil {
+			slog.Warn("failed to execute message template, using built-in layout", "error", err)
 		}
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusAccepted)
-		_, _ = w.Write([]byte(`{"ok":true}`))
+	if payload.Maintenance != nil {
+		return buildMaintenanceMessage(*payload.Maintenance, f, l), nil
+	}
+	if cert, ok := parseCertExpiry(payload); ok {
+		return buildCertExpiryMessage(cert, f, l), nil
+	}
+	if isNonObjectJSON(raw) {
+		section, attachment := buildCompactRawData(raw, f, l, opts.compactDataMaxInline)
+		return "📋 " + f.bold(l.notificationTitle) + "\n\n⚠️ " + f.escape(l.notObject) + "\n\n" + section, attachment
+	}
+
+	if !json.Valid(raw) {
+		// Bodies that aren't JSON are shown as they came
+		section, attachment := buildCompactRawData(raw, f, l, opts.compactDataMaxInline)
+		return "📋 " + f.bold(l.notificationTitle) + "\n\n" + section, attachment
 	}
+	return buildMonitorMessage(payload, raw, opts)
 }
 
-func buildTelegramMessage(payload map[string]any, raw []byte) string {
+// buildMonitorMessage renders the built-in layout for a monitor event.
+func buildMonitorMessage(p kumaPayload, raw []byte, opts messageOptions) (string, *document) {
+	f, l := opts.format, opts.labels
+
 	var builder strings.Builder
 
 	// Check if this is a test message
-	msg := stringFromMap(payload, "msg")
-	isTest := strings.Contains(strings.ToLower(msg), "testing") || strings.Contains(strings.ToLower(msg), "test")
+	isTest := p.isTest()
 
-	// Get heartbeat status (0=Down, 1=Up)
-	heartbeatStatus := nestedString(payload, "heartbeat", "status")
+	if opts.terseWhenMinimal && !isTest && isMinimalPayload(p, opts) {
+		statusEmoji, statusText := p.status(l)
+		return statusEmoji + " " + f.code(p.displayName(opts.defaultMonitorName)) + " " + f.bold(statusText), nil
+	}
 
 	// Header with title and status emoji
-	var statusEmoji string
-	var statusText string
-
 	if isTest {
-		builder.WriteString("🧪 *Uptime Kuma 测试通知*\n\n")
+		builder.WriteString(l.emojiTest + " " + f.bold(l.testTitle) + "\n\n")
 	} else {
-		switch heartbeatStatus {
-		case "0":
-			statusEmoji = "❌"
-			statusText = "DOWN"
-		case "1":
-			statusEmoji = "✅"
-			statusText = "UP"
-		default:
-			statusEmoji = "ℹ️"
-			statusText = "UNKNOWN"
-		}
-		builder.WriteString(fmt.Sprintf("%s *Uptime Kuma 监控通知* \\- *%s*\n\n", statusEmoji, statusText))
+		statusEmoji, statusText := p.status(l)
+		builder.WriteString(fmt.Sprintf("%s %s %s %s\n\n", statusEmoji, f.bold(l.monitorTitle), f.escape("-"), f.bold(statusText)))
+	}
+
+	// Group of the monitor, from monitor.pathName or monitor.parent
+	if group := p.group(); group != "" {
+		builder.WriteString("📁 " + f.bold(l.group) + ": ")
+		builder.WriteString(f.code(group))
+		builder.WriteByte('\n')
 	}
 
 	// Monitor name
-	monitorName := nestedString(payload, "monitor", "name")
+	monitorName := p.displayName(opts.defaultMonitorName)
 	if monitorName != "" {
-		builder.WriteString("📊 *服务名称*: `")
-		builder.WriteString(escapeMarkdown(monitorName))
-		builder.WriteString("`\n")
+		builder.WriteString("📊 " + f.bold(l.monitorName) + ": ")
+		builder.WriteString(f.code(monitorName))
+		builder.WriteByte('\n')
 	}
 
 	// Host and Port
-	hostname := nestedString(payload, "monitor", "hostname")
-	port := nestedString(payload, "monitor", "port")
+	hostname := string(p.monitor().Hostname)
+	port := string(p.monitor().Port)
 	if hostname != "" {
-		builder.WriteString("🖥️ *主机*: `")
-		builder.WriteString(escapeMarkdown(hostname))
-		if port != "" && port != "0" {
-			builder.WriteString(":")
-			builder.WriteString(escapeMarkdown(port))
+		host := hostname
+		if port != "" && port != "0" && (opts.showPortForHTTP || !p.isHTTP()) {
+			host += ":" + port
 		}
-		builder.WriteString("`\n")
+		builder.WriteString("🖥️ " + f.bold(l.host) + ": ")
+		builder.WriteString(f.code(host))
+		builder.WriteByte('\n')
 	}
 
-	// Message - prefer main msg, fallback to heartbeat.msg
-	heartbeatMsg := nestedString(payload, "heartbeat", "msg")
-	var displayMsg string
-
-	if msg != "" {
-		displayMsg = msg
-	} else if heartbeatMsg != "" && heartbeatMsg != "N/A" {
-		displayMsg = heartbeatMsg
+	// Monitor URL, skipping the "https://" placeholder of non-HTTP monitors.
+	// Telegram rejects links it can't open, so other values are shown as
+	// text.
+	if link := p.url(); link != "" {
+		builder.WriteString("🔗 " + f.bold(l.url) + ": ")
+		if isLinkableURL(link) {
+			builder.WriteString(f.link(link, link))
+		} else {
+			builder.WriteString(f.code(link))
+		}
+		builder.WriteByte('\n')
 	}
 
+	// Message - prefer main msg, fallback to heartbeat.msg
+	displayMsg := p.message()
 	if displayMsg != "" {
-		builder.WriteString("💬 *消息*: ")
-		builder.WriteString(escapeMarkdown(displayMsg))
+		builder.WriteString("💬 " + f.bold(l.message) + ": ")
+		builder.WriteString(f.escape(truncateText(displayMsg, maxFieldRunes)))
 		builder.WriteByte('\n')
 	}
 
-	// Ping/Response time
-	ping := nestedString(payload, "heartbeat", "ping")
-	if ping != "" {
-		builder.WriteString("⚡ *响应时间*: `")
-		builder.WriteString(escapeMarkdown(ping))
-		builder.WriteString(" ms`\n")
+	// Ping/Response time; 0, null and empty mean the monitor didn't measure it
+	if ping, ok := p.ping(); ok {
+		builder.WriteString("⚡ " + f.bold(l.responseTime) + ": ")
+		builder.WriteString(f.code(ping + " ms"))
+		builder.WriteByte('\n')
+	} else if opts.showUnmeasuredPing && !isTest {
+		builder.WriteString("⚡ " + f.bold(l.responseTime) + ": ")
+		builder.WriteString(f.code("N/A"))
+		builder.WriteByte('\n')
 	}
 
-	// Timestamp from heartbeat
-	timestamp := nestedString(payload, "heartbeat", "localDateTime")
+	// Timestamp from heartbeat, converted to DISPLAY_TIMEZONE when set
+	timestamp := p.displayTime(opts.location, opts.timeFormat)
 	if timestamp != "" {
-		builder.WriteString("🕐 *时间*: `")
-		builder.WriteString(escapeMarkdown(timestamp))
-		builder.WriteString("`\n")
+		builder.WriteString("🕐 " + f.bold(l.time) + ": ")
+		builder.WriteString(f.code(timestamp))
+		if opts.showRelativeTime {
+			if relative, ok := p.relativeTime(opts.now, l); ok {
+				builder.WriteString(" " + f.escape(fmt.Sprintf(l.relativeWrap, relative)))
+			}
+		}
+		builder.WriteByte('\n')
+	}
+
+	// Downtime of a recovered monitor, known only when its DOWN was seen
+	if opts.downtime > 0 {
+		builder.WriteString("⏱️ " + f.bold(l.downtime) + ": ")
+		builder.WriteString(f.code(formatDowntime(opts.downtime)))
+		builder.WriteByte('\n')
+	}
+
+	// Stability trend from recent history
+	if opts.recentFailures > 0 {
+		builder.WriteString("📈 " + f.escape(fmt.Sprintf(l.trend, opts.recentFailures)))
+		builder.WriteByte('\n')
+	}
+
+	// Log query for the webhook request, from LOG_URL_TEMPLATE
+	if opts.logURL != "" {
+		builder.WriteString("🔎 " + f.link(l.logs, opts.logURL))
+		builder.WriteByte('\n')
 	}
 
 	text := strings.TrimSpace(builder.String())
 	if text == "" {
 		// Fallback for completely empty payload
 		builder.Reset()
-		builder.WriteString("📋 *Uptime Kuma 通知*\n\n")
-		builder.WriteString(buildCompactRawData(raw))
-		return builder.String()
+		builder.WriteString("📋 " + f.bold(l.notificationTitle) + "\n\n")
+		section, attachment := buildCompactRawData(raw, f, l, opts.compactDataMaxInline)
+		builder.WriteString(section)
+		return builder.String(), attachment
 	}
 
 	// Add compact raw data section for debugging (optional)
 	if isTest {
-		text = text + "\n\n" + buildCompactRawData(raw)
+		section, attachment := buildCompactRawData(raw, f, l, opts.compactDataMaxInline)
+		return text + "\n\n" + section, attachment
+	}
+
+	return text, nil
+}
+
+// isMinimalPayload reports whether a monitor payload carries nothing worth a
+// multi-line layout: a name and status but no host, URL, message, response
+// time, downtime or trend.
+func isMinimalPayload(p kumaPayload, opts messageOptions) bool {
+	if p.displayName(opts.defaultMonitorName) == "" || !p.heartbeat().Status.valid {
+		return false
+	}
+	_, measured := p.ping()
+	return p.monitor().Hostname == "" &&
+		p.url() == "" &&
+		p.message() == "" &&
+		!measured &&
+		opts.downtime == 0 && opts.recentFailures == 0 && opts.logURL == ""
+}
+
+// buildMaintenanceMessage renders a maintenance schedule notification with its
+// title, description and scheduled window.
+func buildMaintenanceMessage(maintenance kumaMaintenance, f formatter, l messageLabels) string {
+	var builder strings.Builder
+	builder.WriteString("🛠️ " + f.bold(l.maintenanceTitle) + "\n\n")
+
+	if title := string(maintenance.Title); title != "" {
+		builder.WriteString("📌 " + f.bold(l.maintenanceName) + ": " + f.code(title) + "\n")
+	}
+	if description := string(maintenance.Description); description != "" {
+		builder.WriteString("📝 " + f.bold(l.description) + ": " + f.escape(truncateText(description, maxFieldRunes)) + "\n")
+	}
+	if start, end := maintenanceWindow(maintenance); start != "" || end != "" {
+		builder.WriteString("🕐 " + f.bold(l.maintenanceWindow) + ": " + f.code(start+" ~ "+end) + "\n")
+	}
+
+	return strings.TrimSpace(builder.String())
+}
+
+// maintenanceWindow returns the start and end of the maintenance schedule,
+// reading either flat start/end fields or the first entry of timeslotList.
+func maintenanceWindow(maintenance kumaMaintenance) (start, end string) {
+	for _, window := range [][2]flexString{{maintenance.Start, maintenance.End}, {maintenance.StartDate, maintenance.EndDate}} {
+		if window[0] != "" || window[1] != "" {
+			return string(window[0]), string(window[1])
+		}
+	}
+	if len(maintenance.TimeslotList) > 0 {
+		slot := maintenance.TimeslotList[0]
+		return string(slot.StartDate), string(slot.EndDate)
+	}
+	return "", ""
+}
+
+// dashboardButton links to the monitor's page in the Uptime Kuma dashboard.
+// It returns false when no base URL is configured or the payload carries no
+// monitor ID, so a broken link is never sent.
+func dashboardButton(baseURL string, payload kumaPayload, l messageLabels) (inlineKeyboardButton, bool) {
+	monitorID := string(payload.monitor().ID)
+	if baseURL == "" || monitorID == "" {
+		return inlineKeyboardButton{}, false
 	}
+	return inlineKeyboardButton{
+		Text: l.openDashboard,
+		URL:  baseURL + "/dashboard/" + url.PathEscape(monitorID),
+	}, true
+}
+
+// httpMonitorTypes are the monitor types whose URL already names the port.
+var httpMonitorTypes = map[string]bool{"http": true, "keyword": true, "json-query": true}
 
-	return text
+// isLinkableURL reports whether value is an absolute http(s) URL that can be
+// rendered as a link.
+func isLinkableURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// isNonObjectJSON reports whether body is valid JSON whose top-level value is
+// an array, string, number, boolean or null rather than an object.
+func isNonObjectJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && trimmed[0] != '{' && json.Valid(trimmed)
 }
 
 func fallbackRaw(raw []byte) string {
@@ -267,18 +2045,28 @@ func fallbackRaw(raw []byte) string {
 	if trimmed == "" {
 		return ""
 	}
-	const maxRaw = 3900
-	if len(trimmed) > maxRaw {
-		return trimmed[:maxRaw] + "..."
+	return truncateText(trimmed, maxRawRunes)
+}
+
+// truncateText shortens text to at most maxRunes runes, appending "..." when
+// anything was cut. It must be applied before escaping so the cut can never
+// land inside an escape sequence or split a multi-byte character.
+func truncateText(text string, maxRunes int) string {
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
 	}
-	return trimmed
+	runes := []rune(text)
+	return string(runes[:maxRunes]) + "..."
 }
 
-// buildCompactRawData creates a compact version of raw data with only essential fields
-func buildCompactRawData(raw []byte) string {
+// buildCompactRawData creates a compact version of raw data with only essential
+// fields. Compact JSON longer than maxInline runes (0 means no limit) is
+// returned as a document and only referenced in the section.
+func buildCompactRawData(raw []byte, f formatter, l messageLabels, maxInline int) (string, *document) {
 	var payload map[string]any
-	if err := json.Unmarshal(raw, &payload); err != nil {
-		return "📄 *原始数据*:\n```\n" + fallbackRaw(raw) + "\n```"
+	// A null body decodes without error into a nil map.
+	if err := json.Unmarshal(raw, &payload); err != nil || payload == nil {
+		return "📄 " + f.bold(l.rawData) + ":\n" + f.pre("", fallbackRaw(raw)), nil
 	}
 
 	// Create compact JSON with only essential fields
@@ -317,124 +2105,374 @@ func buildCompactRawData(raw []byte) string {
 
 	compactJSON, err := json.MarshalIndent(compact, "", "  ")
 	if err != nil {
-		return "📄 *原始数据*:\n```\n" + fallbackRaw(raw) + "\n```"
+		return "📄 " + f.bold(l.rawData) + ":\n" + f.pre("", fallbackRaw(raw)), nil
 	}
 
-	return "📄 *核心数据*:\n```json\n" + string(compactJSON) + "\n```"
+	if maxInline > 0 && utf8.RuneCount(compactJSON) > maxInline {
+		attachment := &document{name: compactDataFilename, content: compactJSON}
+		return "📄 " + f.bold(l.coreData) + ": " + f.escape(fmt.Sprintf(l.seeAttachment, attachment.name)), attachment
+	}
+	return "📄 " + f.bold(l.coreData) + ":\n" + f.pre("json", string(compactJSON)), nil
 }
 
-// escapeMarkdown escapes special characters for Telegram MarkdownV2
-func escapeMarkdown(text string) string {
-	// For MarkdownV2, we need to escape: _ * [ ] ( ) ~ ` > # + - = | { } . !
-	// But we'll use a simpler approach and escape the most common problematic characters
+// formatter renders message fragments for the configured Telegram parse mode.
+// The zero value produces unformatted plain text.
+type formatter struct {
+	parseMode string
+}
+
+// escape makes text safe to embed as plain text in the message.
+func (f formatter) escape(text string) string {
+	switch f.parseMode {
+	case parseModeHTML:
+		return escapeHTML(text)
+	case parseModeMarkdownV2:
+		return escapeMarkdown(text)
+	case parseModeSlack:
+		return slackEscaper.Replace(text)
+	default:
+		return text
+	}
+}
+
+// bold renders text in bold.
+func (f formatter) bold(text string) string {
+	switch f.parseMode {
+	case parseModeHTML:
+		return "<b>" + escapeHTML(text) + "</b>"
+	case parseModeMarkdownV2:
+		return "*" + escapeMarkdown(text) + "*"
+	case parseModeSlack:
+		return "*" + slackEscaper.Replace(text) + "*"
+	default:
+		return text
+	}
+}
+
+// code renders text as inline code.
+func (f formatter) code(text string) string {
+	switch f.parseMode {
+	case parseModeHTML:
+		return "<code>" + escapeHTML(text) + "</code>"
+	case parseModeMarkdownV2:
+		return "`" + escapeMarkdown(text) + "`"
+	case parseModeSlack:
+		return "`" + slackEscaper.Replace(text) + "`"
+	default:
+		return text
+	}
+}
+
+// link renders text as a hyperlink to target. URLs follow different escaping
+// rules than text: in MarkdownV2 only ")" and "\" are escaped inside the
+// link target.
+func (f formatter) link(text, target string) string {
+	switch f.parseMode {
+	case parseModeHTML:
+		return `<a href="` + escapeHTMLAttribute(target) + `">` + escapeHTML(text) + "</a>"
+	case parseModeMarkdownV2:
+		return "[" + escapeMarkdown(text) + "](" + markdownURLReplacer.Replace(target) + ")"
+	case parseModeSlack:
+		return "<" + slackEscaper.Replace(target) + "|" + slackEscaper.Replace(text) + ">"
+	default:
+		if text == target {
+			return target
+		}
+		return text + " (" + target + ")"
+	}
+}
+
+// pre renders text as a preformatted block, optionally tagged with a language.
+func (f formatter) pre(language, text string) string {
+	switch f.parseMode {
+	case parseModeHTML:
+		if language != "" {
+			return `<pre><code class="language-` + language + `">` + escapeHTML(text) + "</code></pre>"
+		}
+		return "<pre>" + escapeHTML(text) + "</pre>"
+	case parseModeMarkdownV2:
+		return "```" + language + "\n" + markdownCodeReplacer.Replace(text) + "\n```"
+	case parseModeSlack:
+		return "```\n" + slackEscaper.Replace(text) + "\n```"
+	default:
+		return text
+	}
+}
+
+// markdownURLReplacer escapes the characters MarkdownV2 reserves inside the
+// (...) part of an inline link.
+var markdownURLReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	")", "\\)",
+)
+
+// markdownCodeReplacer escapes the only characters MarkdownV2 reserves inside
+// pre blocks, so JSON with backticks can't close the block early and a
+// trailing backslash can't escape the closing delimiter.
+var markdownCodeReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	"`", "\\`",
+)
+
+// escapeHTMLAttribute escapes text for use inside a double-quoted attribute.
+func escapeHTMLAttribute(text string) string {
+	return strings.ReplaceAll(escapeHTML(text), `"`, "&quot;")
+}
+
+// escapeHTML escapes the characters Telegram's HTML parse mode treats as markup
+func escapeHTML(text string) string {
 	replacer := strings.NewReplacer(
-		"*", "\\*",
-		"_", "\\_",
-		"`", "\\`",
-		"[", "\\[",
-		"]", "\\]",
-		"(", "\\(",
-		")", "\\)",
-		"~", "\\~",
-		">", "\\>",
-		"#", "\\#",
-		"+", "\\+",
-		"-", "\\-",
-		"=", "\\=",
-		"|", "\\|",
-		"{", "\\{",
-		"}", "\\}",
-		".", "\\.",
-		"!", "\\!",
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
 	)
 	return replacer.Replace(text)
 }
 
-func nestedString(payload map[string]any, keys ...string) string {
-	current := any(payload)
-	for _, key := range keys {
-		m, ok := current.(map[string]any)
-		if !ok {
-			return ""
-		}
-		current, ok = m[key]
-		if !ok {
-			return ""
-		}
+// markdownReplacer escapes every character MarkdownV2 reserves, including the
+// backslash itself so a trailing "\" can never swallow a closing delimiter.
+var markdownReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	"*", "\\*",
+	"_", "\\_",
+	"`", "\\`",
+	"[", "\\[",
+	"]", "\\]",
+	"(", "\\(",
+	")", "\\)",
+	"~", "\\~",
+	">", "\\>",
+	"#", "\\#",
+	"+", "\\+",
+	"-", "\\-",
+	"=", "\\=",
+	"|", "\\|",
+	"{", "\\{",
+	"}", "\\}",
+	".", "\\.",
+	"!", "\\!",
+)
+
+// escapeMarkdown escapes special characters for Telegram MarkdownV2. Every
+// literal and dynamic piece of a MarkdownV2 message must pass through it
+// (usually via formatter) so nothing is escaped twice or not at all.
+func escapeMarkdown(text string) string {
+	return markdownReplacer.Replace(text)
+}
+
+// outgoingMessage is a rendered notification ready to be sent to Telegram.
+type outgoingMessage struct {
+	text      string                   // formatted for the client's parse mode
+	plainText string                   // unformatted fallback used if Telegram rejects text
+	slackText string                   // Slack mrkdwn rendering, set when the Slack notifier is enabled
+	keyboard  [][]inlineKeyboardButton // optional inline keyboard rows
+	document  *document                // optional file sent as a reply to the message
+}
+
+// inlineKeyboardButton is a Telegram InlineKeyboardButton.
+type inlineKeyboardButton struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+// telegramAPIError is returned when the Bot API answers with an error status.
+type telegramAPIError struct {
+	statusCode  int
+	description string
+}
+
+func (e *telegramAPIError) Error() string {
+	return fmt.Sprintf("telegram API returned status %d: %s", e.statusCode, e.description)
+}
+
+// newTelegramClient returns a client for the Telegram settings in cfg.
+func newTelegramClient(cfg config) *telegramClient {
+	client := &telegramClient{
+		baseURL:        strings.TrimSuffix(cfg.telegramBaseURL, "/"),
+		botToken:       cfg.telegramBotToken,
+		chatID:         cfg.telegramChatID,
+		threadID:       cfg.telegramThreadID,
+		parseMode:      cfg.parseMode,
+		userAgent:      cfg.userAgent,
+		linkPreview:    cfg.linkPreview,
+		requestTimeout: cfg.requestTimeout,
+		httpClient:     &http.Client{Timeout: cfg.requestTimeout, Transport: telegramTransport(cfg)},
+		chatLocks:      newChatLocks(),
 	}
+	if cfg.maxTelegramConcurrency > 0 {
+		client.inflight = make(chan struct{}, cfg.maxTelegramConcurrency)
+	}
+	return client
+}
 
-	switch v := current.(type) {
-	case string:
-		return strings.TrimSpace(v)
-	case json.Number:
-		return v.String()
-	case float64:
-		return strings.TrimSpace(fmt.Sprintf("%.0f", v))
-	default:
-		return ""
+// forChat returns a client that sends to chatID and threadID instead of the
+// configured chat. An empty chatID returns c itself.
+func (c *telegramClient) forChat(chatID string, threadID int64) *telegramClient {
+	if chatID == "" {
+		return c
 	}
+	routed := *c
+	routed.chatID = chatID
+	routed.threadID = threadID
+	return &routed
 }
 
-func stringFromMap(payload map[string]any, key string) string {
-	if payload == nil {
-		return ""
+func (c *telegramClient) name() string { return notifierTelegram }
+
+// send delivers job to its routed chat, or the configured one.
+func (c *telegramClient) send(ctx context.Context, job delivery) (sentMessage, error) {
+	return c.forChat(job.chatID, job.threadID).sendMessage(ctx, job.message)
+}
+
+// sendMessage delivers msg, retrying once as plain text if Telegram cannot
+// parse the formatted entities. Sends to the same chat are serialized so
+// alerts arrive in the order they were received.
+func (c *telegramClient) sendMessage(ctx context.Context, msg outgoingMessage) (sentMessage, error) {
+	unlock, err := c.chatLocks.lock(ctx, c.chatID)
+	if err != nil {
+		return sentMessage{}, fmt.Errorf("wait for chat %s: %w", c.chatID, err)
 	}
-	value, ok := payload[key]
-	if !ok {
-		return ""
+	defer unlock()
+
+	sent, err := c.postMessage(ctx, msg.text, c.parseMode, msg.keyboard)
+	if err != nil && msg.plainText != "" && isEntityParseError(err) {
+		sent, err = c.sendPlainFallback(ctx, msg, err)
+	}
+	if err != nil {
+		return sentMessage{}, err
 	}
 
-	switch v := value.(type) {
-	case string:
-		return strings.TrimSpace(v)
-	case json.Number:
-		return v.String()
-	case float64:
-		return strings.TrimSpace(fmt.Sprintf("%.0f", v))
-	default:
-		return ""
+	// The alert itself has been delivered, so a failed attachment is only
+	// logged.
+	if msg.document != nil {
+		if err := c.sendDocument(ctx, *msg.document, sent.MessageID); err != nil {
+			slog.Error("failed to send attachment", "name", msg.document.name, "error", err)
+		}
 	}
+	return sent, nil
 }
 
-func (c *telegramClient) sendMessage(ctx context.Context, text string) error {
+// sendPlainFallback resends msg without formatting after Telegram rejected its
+// entities with err.
+func (c *telegramClient) sendPlainFallback(ctx context.Context, msg outgoingMessage, err error) (sentMessage, error) {
+	slog.Warn("telegram rejected formatted message, retrying as plain text", "error", err)
+	sent, plainErr := c.postMessage(ctx, msg.plainText, "", msg.keyboard)
+	if plainErr != nil {
+		slog.Error("plain text fallback failed", "error", plainErr)
+		return sentMessage{}, fmt.Errorf("%w (plain text fallback failed: %v)", err, plainErr)
+	}
+	slog.Info("plain text fallback delivered message", "message_id", sent.MessageID)
+	return sent, nil
+}
+
+func (c *telegramClient) postMessage(ctx context.Context, text, parseMode string, keyboard [][]inlineKeyboardButton) (sentMessage, error) {
 	if strings.TrimSpace(text) == "" {
-		return errors.New("telegram message is empty")
+		return sentMessage{}, errors.New("telegram message is empty")
 	}
 
-	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", c.baseURL, c.botToken)
 	payload := map[string]any{
 		"chat_id":                  c.chatID,
 		"text":                     text,
-		"parse_mode":               "MarkdownV2",
-		"disable_web_page_preview": true,
+		"disable_web_page_preview": !c.linkPreview,
+	}
+	if parseMode != "" {
+		payload["parse_mode"] = parseMode
+	}
+	if c.threadID != 0 {
+		payload["message_thread_id"] = c.threadID
+	}
+	if len(keyboard) > 0 {
+		payload["reply_markup"] = map[string]any{"inline_keyboard": keyboard}
+	}
+
+	var sent sentMessage
+	if err := c.callAPI(ctx, "sendMessage", payload, &sent); err != nil {
+		var apiErr *telegramAPIError
+		if errors.As(err, &apiErr) && isTopicError(apiErr.description) {
+			return sentMessage{}, fmt.Errorf("telegram topic %d is unavailable; check TELEGRAM_MESSAGE_THREAD_ID: %w", c.threadID, err)
+		}
+		return sentMessage{}, err
+	}
+	return sent, nil
+}
+
+// telegramBot is the bot account reported by getMe.
+type telegramBot struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// getMe returns the bot the client's token belongs to, confirming that the
+// token is valid and the Bot API is reachable.
+func (c *telegramClient) getMe(ctx context.Context) (telegramBot, error) {
+	var bot telegramBot
+	if err := c.callAPI(ctx, "getMe", map[string]any{}, &bot); err != nil {
+		return telegramBot{}, fmt.Errorf("getMe: %w", err)
 	}
+	return bot, nil
+}
 
+// callAPI invokes a Bot API method with a JSON payload and decodes the
+// response's result field into result, which may be nil.
+func (c *telegramClient) callAPI(ctx context.Context, method string, payload map[string]any, result any) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal telegram request: %w", err)
 	}
+	return c.doAPI(ctx, method, "application/json", body, result)
+}
+
+// doAPI posts body with the given content type to a Bot API method and decodes
+// the response's result field into result, which may be nil.
+func (c *telegramClient) doAPI(ctx context.Context, method, contentType string, body []byte, result any) error {
+	endpoint := fmt.Sprintf("%s/bot%s/%s", c.baseURL, c.botToken, method)
+
+	if c.inflight != nil {
+		select {
+		case c.inflight <- struct{}{}:
+			defer func() { <-c.inflight }()
+		case <-ctx.Done():
+			return fmt.Errorf("wait for telegram request slot: %w", ctx.Err())
+		}
+	}
+
+	// The endpoint embeds the bot token, so it is only ever logged redacted.
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		attrs := []any{"endpoint", redactTelegramURL(endpoint, c.botToken), "bytes", len(body)}
+		if contentType == "application/json" {
+			attrs = append(attrs, "body", truncateText(string(body), maxFieldRunes))
+		}
+		slog.Debug("telegram request", attrs...)
+	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("create telegram request: %w", err)
+		return fmt.Errorf("create telegram request: %w", redactError(err, c.botToken))
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", c.userAgent)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("telegram request failed: %w", err)
+		return fmt.Errorf("telegram request failed: %w", redactError(err, c.botToken))
 	}
 	defer resp.Body.Close()
 
+	var response struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
 	if resp.StatusCode >= http.StatusMultipleChoices {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-		return fmt.Errorf("telegram API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		apiErr := &telegramAPIError{statusCode: resp.StatusCode, description: strings.TrimSpace(string(body))}
+		if err := json.Unmarshal(body, &response); err == nil && response.Description != "" {
+			apiErr.description = response.Description
+		}
+		return apiErr
 	}
 
-	var response struct {
-		OK          bool   `json:"ok"`
-		Description string `json:"description"`
-	}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return fmt.Errorf("decode telegram response: %w", err)
 	}
@@ -445,10 +2483,85 @@ func (c *telegramClient) sendMessage(ctx context.Context, text string) error {
 		return fmt.Errorf("telegram API error: %s", response.Description)
 	}
 
+	if result != nil && len(response.Result) > 0 {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("decode telegram %s result: %w", method, err)
+		}
+	}
 	return nil
 }
 
-func loadDotEnv(path string) error {
+// isEntityParseError reports whether Telegram rejected a message because its
+// MarkdownV2/HTML entities could not be parsed.
+func isEntityParseError(err error) bool {
+	var apiErr *telegramAPIError
+	if !errors.As(err, &apiErr) || apiErr.statusCode != http.StatusBadRequest {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.description), "can't parse entities")
+}
+
+// isTopicError reports whether a Telegram error description refers to a
+// missing, closed or otherwise unusable forum topic.
+func isTopicError(description string) bool {
+	lower := strings.ToLower(description)
+	return strings.Contains(lower, "message thread not found") ||
+		strings.Contains(lower, "topic_closed") ||
+		strings.Contains(lower, "topic_deleted") ||
+		strings.Contains(lower, "topic closed")
+}
+
+// isMissingRightsError reports whether Telegram refused an action because the
+// bot lacks the required chat permission ("not enough rights to ..."). Other
+// 403s, such as a bot that was blocked or kicked, are not permission errors.
+func isMissingRightsError(err error) bool {
+	var apiErr *telegramAPIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.description), "not enough rights")
+}
+
+// settings are configuration values keyed by environment variable name.
+// loadConfig reads them instead of the process environment, so a reload can
+// assemble the next configuration without modifying the environment.
+type settings map[string]string
+
+// environSettings returns the variables in environ, as listed by
+// os.Environ.
+func environSettings(environ []string) settings {
+	env := make(settings, len(environ))
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+func (env settings) lookup(key string) (string, bool) {
+	value, ok := env[key]
+	return value, ok
+}
+
+func (env settings) get(key string) string {
+	return env[key]
+}
+
+// known returns the values of the settings in configSettings.
+func (env settings) known() settings {
+	known := make(settings)
+	for name := range configSettings {
+		if value, ok := env[name]; ok {
+			known[name] = value
+		}
+	}
+	return known
+}
+
+// loadDotEnv adds the variables defined in the .env file at path to env,
+// keeping those env already has. A missing file is not an error.
+func (env settings) loadDotEnv(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -487,13 +2600,10 @@ func loadDotEnv(path string) error {
 			}
 		}
 
-		if _, exists := os.LookupEnv(key); exists {
+		if _, exists := env[key]; exists {
 			continue
 		}
-
-		if err := os.Setenv(key, value); err != nil {
-			return fmt.Errorf("set %s: %w", key, err)
-		}
+		env[key] = value
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -502,8 +2612,42 @@ func loadDotEnv(path string) error {
 
 	return nil
 }
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
+
+// positiveDurationEnv reads key as a positive time.Duration such as "30s",
+// returning fallback when unset.
+func (env settings) positiveDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	valueStr := strings.TrimSpace(env.get(key))
+	if valueStr == "" {
+		return fallback, nil
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("%s must be positive", key)
+	}
+	return value, nil
+}
+
+// positiveIntEnv reads key as a positive integer, returning fallback when unset.
+func (env settings) positiveIntEnv(key string, fallback int) (int, error) {
+	valueStr := strings.TrimSpace(env.get(key))
+	if valueStr == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("%s must be positive", key)
+	}
+	return value, nil
+}
+
+func (env settings) getEnv(key, fallback string) string {
+	if value, ok := env.lookup(key); ok {
 		value = strings.TrimSpace(value)
 		if value != "" {
 			return value
@@ -0,0 +1,1162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testBotToken     = "123456:test-token"
+	testWebhookToken = "long-enough-secret"
+)
+
+// telegramCall is a Bot API request received by fakeTelegram.
+type telegramCall struct {
+	method string
+	header http.Header
+	body   map[string]any // decoded JSON body; nil for multipart uploads
+}
+
+// fakeTelegram is a Bot API server that records the calls it receives. It
+// answers with respond when set, and with a successful result otherwise.
+type fakeTelegram struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	calls   []telegramCall
+	respond func(call telegramCall) (status int, response string)
+}
+
+func newFakeTelegram(t *testing.T) *fakeTelegram {
+	t.Helper()
+	fake := &fakeTelegram{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (f *fakeTelegram) serve(w http.ResponseWriter, r *http.Request) {
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+testBotToken+"/")
+	if !ok {
+		http.Error(w, `{"ok":false,"description":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	call := telegramCall{method: method, header: r.Header}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &call.body)
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	messageID := len(f.calls)
+	respond := f.respond
+	f.mu.Unlock()
+
+	if respond != nil {
+		status, response := respond(call)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, response)
+		return
+	}
+	fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"chat":{"id":1}}}`, messageID)
+}
+
+// sent returns the calls of method received so far.
+func (f *fakeTelegram) sent(method string) []telegramCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []telegramCall
+	for _, call := range f.calls {
+		if call.method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// testConfig returns a valid configuration that talks to fake.
+func testConfig(fake *fakeTelegram) config {
+	return config{
+		telegramBaseURL:  fake.URL,
+		telegramBotToken: testBotToken,
+		telegramChatID:   "1",
+		parseMode:        parseModeMarkdownV2,
+		requestTimeout:   5 * time.Second,
+		messageLabels:    messageLanguages[defaultMessageLanguage],
+	}
+}
+
+// liveConfig returns cfg as the running configuration.
+func liveConfig(cfg config) *atomic.Pointer[config] {
+	live := new(atomic.Pointer[config])
+	live.Store(&cfg)
+	return live
+}
+
+// testSettings returns the settings loadConfig can't start without,
+// together with extra.
+func testSettings(extra map[string]string) settings {
+	env := settings{
+		"TELEGRAM_BOT_TOKEN": testBotToken,
+		"TELEGRAM_CHAT_ID":   "1",
+		"WEBHOOK_AUTH_TOKEN": testWebhookToken,
+	}
+	maps.Copy(env, extra)
+	return env
+}
+
+// webhookServer runs the webhook handler for a configuration loaded from
+// testSettings, delivering to a fakeNotifier. The optional stages are off
+// unless a test sets them before the first request.
+type webhookServer struct {
+	cfg      config
+	notifier *fakeNotifier
+	down     *downTracker
+	dedup    *deduplicator
+	history  *alertHistory
+	flaps    *flapDetector
+	quiet    *quietBuffer
+	batch    *batcher
+	handler  http.HandlerFunc
+}
+
+func newWebhookServer(t *testing.T, extra map[string]string) *webhookServer {
+	t.Helper()
+	cfg, err := loadConfig(testSettings(extra))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &webhookServer{
+		cfg:      cfg,
+		notifier: &fakeNotifier{id: notifierTelegram},
+		down:     newDownTracker(newMonitorStates(newMemoryStateStore())),
+	}
+}
+
+// post sends body to the webhook with the test token.
+func (s *webhookServer) post(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+	return s.serve(req)
+}
+
+// webhook returns the webhook handler, built on first use.
+func (s *webhookServer) webhook() http.HandlerFunc {
+	if s.handler == nil {
+		d := &dispatcher{notifiers: []notifier{s.notifier}, requestTimeout: time.Second}
+		s.handler = withRequestID(webhookHandler(liveConfig(s.cfg), "", d, s.dedup, s.down, s.history, s.flaps, s.quiet, s.batch, nil, nil, nil)).ServeHTTP
+	}
+	return s.handler
+}
+
+func (s *webhookServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.webhook()(rec, req)
+	return rec
+}
+
+func TestRootAndUnknownPaths(t *testing.T) {
+	s := newWebhookServer(t, nil)
+	// The routes main registers besides the status and callback endpoints.
+	mux := http.NewServeMux()
+	mux.Handle(defaultWebhookPath, s.webhook())
+	mux.HandleFunc(healthPath, healthHandler)
+	mux.HandleFunc("/", rootHandler)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "root", method: http.MethodGet, path: "/", wantCode: http.StatusOK, want: `"docs":"` + docsURL + `"`},
+		{name: "root with POST", method: http.MethodPost, path: "/", wantCode: http.StatusMethodNotAllowed, want: `"error":"method not allowed"`},
+		{name: "unknown path", method: http.MethodGet, path: "/admin", wantCode: http.StatusNotFound, want: `{"error":"not found","ok":false}`},
+		{name: "unknown path with POST", method: http.MethodPost, path: "/uptimekuma-webhook/extra", wantCode: http.StatusNotFound, want: `"not found"`},
+		{name: "health", method: http.MethodGet, path: healthPath, wantCode: http.StatusOK, want: `"ok":true`},
+		{name: "webhook", method: http.MethodPost, path: defaultWebhookPath, body: `{"msg":"Testing"}`, wantCode: http.StatusAccepted, want: `{"ok":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("%s %s: %d %s, want %d with %s", tt.method, tt.path, rec.Code, rec.Body, tt.wantCode, tt.want)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want JSON", got)
+			}
+			if strings.Contains(rec.Body.String(), testWebhookToken) || strings.Contains(rec.Body.String(), testBotToken) {
+				t.Errorf("response reveals a token: %s", rec.Body)
+			}
+		})
+	}
+	if len(s.notifier.jobs) != 1 {
+		t.Errorf("%d messages sent, want the webhook's only", len(s.notifier.jobs))
+	}
+}
+
+func TestVerboseTestResponse(t *testing.T) {
+	const testNotification = `{"msg":"Testing Telegram notification"}`
+	tests := []struct {
+		name     string
+		verbose  string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{name: "terse", verbose: "false", wantCode: http.StatusAccepted, wantBody: `{"ok":true}`},
+		{name: "verbose", verbose: "true", wantCode: http.StatusAccepted, wantBody: `"message_id":1`},
+		{name: "verbose failure", verbose: "true", err: errChatNotFound, wantCode: http.StatusBadGateway, wantBody: "chat not found"},
+		{name: "terse failure", verbose: "false", err: errChatNotFound, wantCode: http.StatusBadGateway, wantBody: "failed to forward notification"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"VERBOSE_TEST_RESPONSE": tt.verbose})
+			s.notifier.errs = []error{tt.err}
+			rec := s.post(testNotification)
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("response %d %s, want %d containing %s", rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTimeFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: displayTimeLayout},
+		{value: "01-02 15:04 MST", want: "01-02 15:04 MST"},
+		{value: "15:04", want: "15:04"},
+		{value: "bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := loadConfig(testSettings(map[string]string{"TIME_FORMAT": tt.value}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.timeFormat != tt.want {
+				t.Errorf("timeFormat = %q, want %q", cfg.timeFormat, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadQueueDeliveryTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		want        time.Duration
+		wantWarning string
+		wantErr     bool
+	}{
+		{name: "unlimited by default", env: map[string]string{"ASYNC_DELIVERY": "true"}},
+		{name: "fits a retry", env: map[string]string{"ASYNC_DELIVERY": "true", "QUEUE_DELIVERY_TIMEOUT": "30s"}, want: 30 * time.Second},
+		{
+			name:        "too short warns",
+			env:         map[string]string{"ASYNC_DELIVERY": "true", "QUEUE_DELIVERY_TIMEOUT": "12s"},
+			want:        12 * time.Second,
+			wantWarning: "too short for a retry, which needs 21s",
+		},
+		{
+			name:        "too short extended",
+			env:         map[string]string{"ASYNC_DELIVERY": "true", "QUEUE_DELIVERY_TIMEOUT": "12s", "QUEUE_DELIVERY_TIMEOUT_EXTEND": "true"},
+			want:        21 * time.Second,
+			wantWarning: "raised from 12s to 21s",
+		},
+		{
+			name: "short timeout without retries",
+			env:  map[string]string{"ASYNC_DELIVERY": "true", "QUEUE_DELIVERY_TIMEOUT": "5s", "QUEUE_MAX_RETRIES": "0"},
+			want: 5 * time.Second,
+		},
+		{
+			name:        "retries without async delivery",
+			env:         map[string]string{"QUEUE_MAX_RETRIES": "5"},
+			wantWarning: "only apply with ASYNC_DELIVERY=true",
+		},
+		{name: "negative", env: map[string]string{"QUEUE_DELIVERY_TIMEOUT": "-1s"}, wantErr: true},
+		{name: "invalid extend", env: map[string]string{"QUEUE_DELIVERY_TIMEOUT_EXTEND": "sometimes"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(testSettings(tt.env))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.queueDeliveryTimeout != tt.want {
+				t.Errorf("queueDeliveryTimeout = %s, want %s", cfg.queueDeliveryTimeout, tt.want)
+			}
+			warnings := strings.Join(cfg.warnings, "\n")
+			if (tt.wantWarning == "") != (warnings == "") || !strings.Contains(warnings, tt.wantWarning) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxRunes int
+		want     string
+	}{
+		{text: "short", maxRunes: 10, want: "short"},
+		{text: "exactly10!", maxRunes: 10, want: "exactly10!"},
+		{text: "0123456789abc", maxRunes: 10, want: "0123456789..."},
+		{text: "数据库连接超时了", maxRunes: 4, want: "数据库连..."},
+		{text: "🔴🔴🔴", maxRunes: 2, want: "🔴🔴..."},
+	}
+	for _, tt := range tests {
+		if got := truncateText(tt.text, tt.maxRunes); got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.text, tt.maxRunes, got, tt.want)
+		}
+	}
+}
+
+func TestLongMessageTruncatedBeforeEscaping(t *testing.T) {
+	// Every rune of the message needs escaping, so a cut after escaping
+	// would be bound to split a sequence.
+	long := strings.Repeat(`\.`, maxFieldRunes)
+	raw := `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"` + strings.ReplaceAll(long, `\`, `\\`) + `"}`
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseMode: parseModeMarkdownV2, want: escapeMarkdown(long[:maxFieldRunes] + "...")},
+		{parseMode: parseModeHTML, want: long[:maxFieldRunes] + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			opts := messageOptions{format: formatter{parseMode: tt.parseMode}, labels: messageLanguages["en"]}
+			text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+			if !strings.Contains(text+"\n", ": "+tt.want+"\n") {
+				t.Errorf("message does not hold the truncated, then escaped text:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "plain text 123", want: "plain text 123"},
+		{text: `_*[]()~` + "`" + `>#+-=|{}.!`, want: `\_\*\[\]\(\)\~\` + "`" + `\>\#\+\-\=\|\{\}\.\!`},
+		{text: `C:\path\`, want: `C:\\path\\`},
+		{text: "db-01.example.com", want: `db\-01\.example\.com`},
+	}
+	for _, tt := range tests {
+		if got := escapeMarkdown(tt.text); got != tt.want {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFormatter(t *testing.T) {
+	markdown, html, plain := formatter{parseMode: parseModeMarkdownV2}, formatter{parseMode: parseModeHTML}, formatter{}
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "markdown bold", got: markdown.bold("a-b"), want: `*a\-b*`},
+		{name: "markdown code", got: markdown.code("x.y"), want: "`x\\.y`"},
+		{name: "markdown link", got: markdown.link("a.b", "https://x.test/(1)"), want: `[a\.b](https://x.test/(1\))`},
+		{name: "markdown pre", got: markdown.pre("json", "`\\"), want: "```json\n\\`\\\\\n```"},
+		{name: "html bold", got: html.bold("a<b>&c"), want: "<b>a&lt;b&gt;&amp;c</b>"},
+		{name: "html link", got: html.link("x", `https://x.test/?a="1"&b=2`), want: `<a href="https://x.test/?a=&quot;1&quot;&amp;b=2">x</a>`},
+		{name: "html pre", got: html.pre("json", "<1>"), want: `<pre><code class="language-json">&lt;1&gt;</code></pre>`},
+		{name: "plain link", got: plain.link("docs", "https://x.test"), want: "docs (https://x.test)"},
+		{name: "plain escape", got: plain.escape("a-b_c"), want: "a-b_c"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestStatusHeaderEscapedOnce(t *testing.T) {
+	raw := `{"monitor":{"name":"db"},"heartbeat":{"status":0}}`
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseMode: parseModeMarkdownV2, want: `❌ *Uptime Kuma Monitor Alert* \- *DOWN*`},
+		{parseMode: parseModeHTML, want: "❌ <b>Uptime Kuma Monitor Alert</b> - <b>DOWN</b>"},
+		{parseMode: "", want: "❌ Uptime Kuma Monitor Alert - DOWN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parseMode, func(t *testing.T) {
+			opts := messageOptions{format: formatter{parseMode: tt.parseMode}, labels: messageLanguages["en"]}
+			text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+			if header, _, _ := strings.Cut(text, "\n"); header != tt.want {
+				t.Errorf("header = %q, want %q", header, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendPlainFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		formatted   string // error description for formatted messages; empty means success
+		plain       string // error description for plain text messages
+		wantErr     string
+		wantMethods int
+		wantText    string
+	}{
+		{name: "formatted accepted", wantMethods: 1, wantText: "*formatted*"},
+		{name: "entities rejected", formatted: "Bad Request: can't parse entities: unexpected end", wantMethods: 2, wantText: "plain"},
+		{name: "other error", formatted: "Bad Request: chat not found", wantErr: "chat not found", wantMethods: 1},
+		{
+			name:        "fallback rejected too",
+			formatted:   "Bad Request: can't parse entities",
+			plain:       "Bad Request: message is too long",
+			wantErr:     "plain text fallback failed",
+			wantMethods: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTelegram(t)
+			fake.respond = func(call telegramCall) (int, string) {
+				description := tt.plain
+				if call.body["parse_mode"] != nil {
+					description = tt.formatted
+				}
+				if description == "" {
+					return http.StatusOK, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`
+				}
+				return http.StatusBadRequest, fmt.Sprintf(`{"ok":false,"description":%q}`, description)
+			}
+			client := newTelegramClient(testConfig(fake))
+			_, err := client.sendMessage(context.Background(), outgoingMessage{text: "*formatted*", plainText: "plain"})
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			calls := fake.sent("sendMessage")
+			if len(calls) != tt.wantMethods {
+				t.Fatalf("%d sendMessage calls, want %d", len(calls), tt.wantMethods)
+			}
+			if last := calls[len(calls)-1]; tt.wantText != "" && last.body["text"] != tt.wantText {
+				t.Errorf("delivered %q, want %q", last.body["text"], tt.wantText)
+			}
+		})
+	}
+}
+
+// codeBlockContent returns the text of the last code block in a message
+// rendered in parseMode, undoing its escaping. It fails the test when the
+// block is missing or a backtick inside a MarkdownV2 block is not escaped.
+func codeBlockContent(t *testing.T, parseMode, text string) string {
+	t.Helper()
+	if parseMode == parseModeHTML {
+		start := strings.LastIndex(text, "<pre>")
+		end := strings.LastIndex(text, "</pre>")
+		if start < 0 || end < start {
+			t.Fatalf("no <pre> block in:\n%s", text)
+		}
+		content := text[start+len("<pre>") : end]
+		content = strings.TrimSuffix(strings.TrimPrefix(content, `<code class="language-json">`), "</code>")
+		return html.UnescapeString(content)
+	}
+
+	body, ok := strings.CutSuffix(text, "\n```")
+	start := strings.LastIndex(body, "```")
+	if !ok || start < 0 {
+		t.Fatalf("no code block at the end of:\n%s", text)
+	}
+	_, body, _ = strings.Cut(body[start+3:], "\n")
+	var content strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+			if i == len(body) {
+				t.Fatalf("code block ends in a lone backslash:\n%s", text)
+			}
+		case '`':
+			t.Fatalf("unescaped backtick in code block:\n%s", text)
+		}
+		content.WriteByte(body[i])
+	}
+	return content.String()
+}
+
+func TestRawDataCodeBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		compact bool   // render only the compact data of an object
+		want    string // code block content
+	}{
+		{name: "array", raw: "[\"a`b\", \"c\\\\d\", \"```\"]", want: "[\"a`b\", \"c\\\\d\", \"```\"]"},
+		{name: "not JSON", raw: "run `rm -rf \\` now", want: "run `rm -rf \\` now"},
+		{
+			name:    "object",
+			raw:     "{\"msg\":\"`x` at C:\\\\tmp\"}",
+			compact: true,
+			want:    "{\n  \"msg\": \"`x` at C:\\\\tmp\"\n}",
+		},
+	}
+	for _, tt := range tests {
+		for _, parseMode := range []string{parseModeMarkdownV2, parseModeHTML} {
+			t.Run(tt.name+" "+parseMode, func(t *testing.T) {
+				opts := messageOptions{format: formatter{parseMode: parseMode}, labels: messageLanguages["en"]}
+				p, _ := decodePayload([]byte(tt.raw))
+				var text string
+				if tt.compact {
+					text, _ = buildCompactRawData([]byte(tt.raw), opts.format, opts.labels, 0)
+				} else {
+					text, _ = buildTelegramMessage(p, []byte(tt.raw), opts)
+				}
+				if got := codeBlockContent(t, parseMode, text); got != tt.want {
+					t.Errorf("code block holds %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestBuildMaintenanceMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{
+			name: "flat window",
+			raw:  `{"maintenance":{"title":"DB upgrade","description":"v15 -> v16","start":"2024-05-01 22:00","end":"2024-05-01 23:00"}}`,
+			want: []string{"Title: DB upgrade", "Description: v15 -> v16", "Window: 2024-05-01 22:00 ~ 2024-05-01 23:00"},
+		},
+		{
+			name: "date range",
+			raw:  `{"maintenance":{"title":"Weekly","startDate":"2024-05-01","endDate":"2024-06-01"}}`,
+			want: []string{"Window: 2024-05-01 ~ 2024-06-01"},
+		},
+		{
+			name: "first time slot",
+			raw:  `{"maintenance":{"title":"Weekly","timeslotList":[{"startDate":"10:00","endDate":"11:00"},{"startDate":"12:00","endDate":"13:00"}]}}`,
+			want: []string{"Window: 10:00 ~ 11:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, _ := buildTelegramMessage(testPayload(t, tt.raw), []byte(tt.raw), messageOptions{labels: messageLanguages["en"]})
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("message does not contain %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+
+	// Without a window the line is left out rather than rendered as " ~ ".
+	raw := `{"maintenance":{"title":"Unscheduled"}}`
+	if text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), messageOptions{labels: messageLanguages["en"]}); strings.Contains(text, "~") {
+		t.Errorf("message without a window shows one:\n%s", text)
+	}
+}
+
+func TestSecureCompare(t *testing.T) {
+	tests := []struct {
+		provided, expected string
+		want               bool
+	}{
+		{provided: "secret", expected: "secret", want: true},
+		{provided: "secreT", expected: "secret"},
+		{provided: "secret-but-longer", expected: "secret"},
+		{provided: "", expected: "secret"},
+	}
+	for _, tt := range tests {
+		if got := secureCompare(tt.provided, tt.expected); got != tt.want {
+			t.Errorf("secureCompare(%q, %q) = %v, want %v", tt.provided, tt.expected, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookTokenAuth(t *testing.T) {
+	const body = `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"down"}`
+	tests := []struct {
+		name     string
+		env      map[string]string
+		header   [2]string
+		query    string
+		wantCode int
+		wantChat string
+	}{
+		{name: "bearer", header: [2]string{"Authorization", "Bearer " + testWebhookToken}, wantCode: http.StatusAccepted, wantChat: "1"},
+		{name: "wrong bearer", header: [2]string{"Authorization", "Bearer nope"}, wantCode: http.StatusUnauthorized},
+		{name: "bare token", header: [2]string{"Authorization", testWebhookToken}, wantCode: http.StatusUnauthorized},
+		{name: "missing", wantCode: http.StatusUnauthorized},
+		{name: "header", header: [2]string{"X-Webhook-Token", testWebhookToken}, wantCode: http.StatusAccepted, wantChat: "1"},
+		{
+			name:     "header disabled",
+			env:      map[string]string{"AUTH_ALLOW_HEADER": "false"},
+			header:   [2]string{"X-Webhook-Token", testWebhookToken},
+			wantCode: http.StatusUnauthorized,
+		},
+		{name: "query disabled by default", query: "?token=" + testWebhookToken, wantCode: http.StatusUnauthorized},
+		{name: "query", env: map[string]string{"AUTH_ALLOW_QUERY": "true"}, query: "?token=" + testWebhookToken, wantCode: http.StatusAccepted, wantChat: "1"},
+		{
+			name:     "token with its own chat",
+			env:      map[string]string{"WEBHOOK_AUTH_TOKENS": "team-a-secret-token:-100200:Team A"},
+			header:   [2]string{"Authorization", "Bearer team-a-secret-token"},
+			wantCode: http.StatusAccepted,
+			wantChat: "-100200",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, tt.env)
+			req := httptest.NewRequest(http.MethodPost, defaultWebhookPath+tt.query, strings.NewReader(body))
+			if tt.header[0] != "" {
+				req.Header.Set(tt.header[0], tt.header[1])
+			}
+			rec := s.serve(req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantChat == "" {
+				if len(s.notifier.jobs) != 0 {
+					t.Error("an unauthorized webhook was delivered")
+				}
+				return
+			}
+			if len(s.notifier.jobs) != 1 || s.notifier.jobs[0].chatID != tt.wantChat {
+				t.Errorf("deliveries %+v, want one to chat %s", s.notifier.jobs, tt.wantChat)
+			}
+		})
+	}
+}
+
+func TestValidSignature(t *testing.T) {
+	// The example from GitHub's webhook documentation.
+	const (
+		secret = "It's a Secret to Everybody"
+		body   = "Hello, World!"
+		digest = "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	)
+	tests := []struct {
+		name      string
+		secret    string
+		body      string
+		signature string
+		want      bool
+	}{
+		{name: "prefixed", secret: secret, body: body, signature: "sha256=" + digest, want: true},
+		{name: "bare hex", secret: secret, body: body, signature: digest, want: true},
+		{name: "upper case hex", secret: secret, body: body, signature: strings.ToUpper(digest), want: true},
+		{name: "tampered body", secret: secret, body: "Hello, World?", signature: "sha256=" + digest},
+		{name: "wrong secret", secret: "guess", body: body, signature: "sha256=" + digest},
+		{name: "truncated", secret: secret, body: body, signature: "sha256=" + digest[:32]},
+		{name: "not hex", secret: secret, body: body, signature: "sha256=not-hex"},
+		{name: "empty", secret: secret, body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature(tt.secret, []byte(tt.body), tt.signature); got != tt.want {
+				t.Errorf("validSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookAuthMode(t *testing.T) {
+	const (
+		secret = "hmac-secret"
+		body   = `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"down"}`
+	)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	signed := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		mode      string
+		token     bool
+		signature string
+		want      int
+	}{
+		{mode: "any", token: true, want: http.StatusAccepted},
+		{mode: "any", signature: signed, want: http.StatusAccepted},
+		{mode: "any", want: http.StatusUnauthorized},
+		{mode: "token", signature: signed, want: http.StatusUnauthorized},
+		{mode: "hmac", signature: signed, want: http.StatusAccepted},
+		{mode: "hmac", token: true, want: http.StatusUnauthorized},
+		{mode: "hmac", signature: "sha256=" + strings.Repeat("0", 64), want: http.StatusUnauthorized},
+		{mode: "both", token: true, signature: signed, want: http.StatusAccepted},
+		{mode: "both", token: true, want: http.StatusUnauthorized},
+		{mode: "both", signature: signed, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s token=%v signed=%v", tt.mode, tt.token, tt.signature != ""), func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"AUTH_MODE": tt.mode, "WEBHOOK_HMAC_SECRET": secret})
+			req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(body))
+			if tt.token {
+				req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+			}
+			if tt.signature != "" {
+				req.Header.Set("X-Signature-256", tt.signature)
+			}
+			if rec := s.serve(req); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// The signature covers the body as received, so a changed body fails
+	// even with a signature that was valid for the original.
+	s := newWebhookServer(t, map[string]string{"AUTH_MODE": "hmac", "WEBHOOK_HMAC_SECRET": secret})
+	req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(strings.Replace(body, "down", "up", 1)))
+	req.Header.Set("X-Signature-256", signed)
+	if rec := s.serve(req); rec.Code != http.StatusUnauthorized || len(s.notifier.jobs) != 0 {
+		t.Errorf("tampered body: status %d, %d deliveries; want 401 and none", rec.Code, len(s.notifier.jobs))
+	}
+}
+
+func TestOutboundUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "default", want: serviceName + "/" + version},
+		{name: "configured", env: map[string]string{"OUTBOUND_USER_AGENT": "acme-alerts/1.0"}, want: "acme-alerts/1.0"},
+		{name: "alias", env: map[string]string{"HTTP_USER_AGENT": "legacy/2"}, want: "legacy/2"},
+		{name: "both", env: map[string]string{"OUTBOUND_USER_AGENT": "acme-alerts/1.0", "HTTP_USER_AGENT": "legacy/2"}, want: "acme-alerts/1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTelegram(t)
+			env := testSettings(tt.env)
+			env["TELEGRAM_API_BASE_URL"] = fake.URL
+			cfg, err := loadConfig(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newTelegramClient(cfg).sendMessage(context.Background(), outgoingMessage{text: "hi"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.sent("sendMessage")[0].header.Get("User-Agent"); got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmeasuredPing(t *testing.T) {
+	tests := []struct {
+		name string
+		ping string
+		show bool
+		want string // response time line; empty means none
+	}{
+		{name: "measured", ping: `42`, want: "Response time: 42 ms"},
+		{name: "fraction", ping: `"12.5"`, want: "Response time: 12.5 ms"},
+		{name: "null hidden", ping: `null`},
+		{name: "zero hidden", ping: `0`},
+		{name: "empty string hidden", ping: `""`},
+		{name: "null shown", ping: `null`, show: true, want: "Response time: N/A"},
+		{name: "zero shown", ping: `0`, show: true, want: "Response time: N/A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `{"monitor":{"name":"db"},"heartbeat":{"status":1,"ping":` + tt.ping + `}}`
+			opts := messageOptions{labels: messageLanguages["en"], showUnmeasuredPing: tt.show}
+			text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+			got := ""
+			for _, line := range strings.Split(text, "\n") {
+				if _, after, ok := strings.Cut(line, "⚡ "); ok {
+					got = after
+				}
+			}
+			if got != tt.want {
+				t.Errorf("response time line = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Test notifications never carry a measurement, so N/A is left out.
+	raw := `{"msg":"Testing"}`
+	opts := messageOptions{labels: messageLanguages["en"], showUnmeasuredPing: true}
+	if text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts); strings.Contains(text, "N/A") {
+		t.Errorf("test notification shows an unmeasured ping:\n%s", text)
+	}
+}
+
+func TestTerseWhenMinimal(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		terse   bool
+		want    string // whole message for one-liners, else its first line
+		oneLine bool
+	}{
+		{name: "minimal DOWN", raw: `{"monitor":{"name":"db-1"},"heartbeat":{"status":0}}`, terse: true, want: "❌ db-1 DOWN", oneLine: true},
+		{name: "minimal UP", raw: `{"monitor":{"name":"db-1"},"heartbeat":{"status":1,"ping":null}}`, terse: true, want: "✅ db-1 UP", oneLine: true},
+		{name: "minimal with the flag off", raw: `{"monitor":{"name":"db-1"},"heartbeat":{"status":0}}`, want: "❌ Uptime Kuma Monitor Alert - DOWN"},
+		{name: "with a host", raw: `{"monitor":{"name":"db-1","hostname":"db.internal"},"heartbeat":{"status":0}}`, terse: true, want: "❌ Uptime Kuma Monitor Alert - DOWN"},
+		{name: "with a message", raw: `{"monitor":{"name":"db-1"},"heartbeat":{"status":0,"msg":"timeout"}}`, terse: true, want: "❌ Uptime Kuma Monitor Alert - DOWN"},
+		{name: "with a ping", raw: `{"monitor":{"name":"db-1"},"heartbeat":{"status":1,"ping":12}}`, terse: true, want: "✅ Uptime Kuma Monitor Alert - UP"},
+		{name: "without a status", raw: `{"monitor":{"name":"db-1"}}`, terse: true, want: "ℹ️ Uptime Kuma Monitor Alert - UNKNOWN"},
+		{name: "test notification", raw: `{"msg":"Testing"}`, terse: true, want: "🧪 Uptime Kuma Test Notification"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := messageOptions{labels: messageLanguages["en"], terseWhenMinimal: tt.terse}
+			text, _ := buildTelegramMessage(testPayload(t, tt.raw), []byte(tt.raw), opts)
+			got := text
+			if !tt.oneLine {
+				got, _, _ = strings.Cut(text, "\n")
+				if !strings.Contains(text, "\n") {
+					t.Errorf("message is a single line: %q", text)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("message %q, want %q", text, tt.want)
+			}
+		})
+	}
+
+	// A tracked downtime makes a recovery worth the full layout.
+	raw := `{"monitor":{"name":"db-1"},"heartbeat":{"status":1}}`
+	opts := messageOptions{labels: messageLanguages["en"], terseWhenMinimal: true, downtime: 5 * time.Minute}
+	if text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts); !strings.Contains(text, "\n") {
+		t.Errorf("recovery with a downtime rendered as %q", text)
+	}
+}
+
+func TestIsTest(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want bool
+	}{
+		{name: "test button", raw: `{"heartbeat":null,"monitor":null,"msg":"Uptime Kuma Testing"}`, want: true},
+		{name: "msg only", raw: `{"msg":"hello"}`, want: true},
+		{name: "monitor named like a test", raw: `{"monitor":{"name":"latest-api"},"heartbeat":{"status":0},"msg":"[latest-api] [🔴 Down] test failed"}`},
+		{name: "monitor without heartbeat", raw: `{"monitor":{"name":"contest-site"},"msg":"Testing"}`},
+		{name: "maintenance", raw: `{"maintenance":{"title":"Test window"}}`},
+		{name: "certificate expiry", raw: `{"msg":"[test][https://test.example.com] certificate test.example.com will be expired in 7 days"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testPayload(t, tt.raw).isTest(); got != tt.want {
+				t.Errorf("isTest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportantOnly(t *testing.T) {
+	// Real alerts for a monitor whose name and message mention "test".
+	const (
+		routine    = `{"monitor":{"id":1,"name":"latest-api"},"heartbeat":{"status":1,"important":false},"msg":"[latest-api] [✅ Up] contest OK"}`
+		transition = `{"monitor":{"id":1,"name":"latest-api"},"heartbeat":{"status":0,"important":true,"time":"2024-05-01 10:00:00"},"msg":"[latest-api] [🔴 Down] test timeout"}`
+	)
+	s := newWebhookServer(t, map[string]string{"IMPORTANT_ONLY": "true"})
+	s.dedup = newDeduplicator(time.Minute, defaultDedupKeyFields)
+
+	if rec := s.post(routine); rec.Code != http.StatusNoContent {
+		t.Errorf("routine heartbeat: status %d, want 204", rec.Code)
+	}
+	if rec := s.post(transition); rec.Code != http.StatusAccepted {
+		t.Errorf("transition: status %d, want 202", rec.Code)
+	}
+	if rec := s.post(transition); !strings.Contains(rec.Body.String(), `"duplicate":true`) {
+		t.Errorf("repeated transition: %d %s, want it reported as a duplicate", rec.Code, rec.Body)
+	}
+	// The test button's payload has no heartbeat and always gets through.
+	if rec := s.post(`{"msg":"Uptime Kuma Testing"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("test notification: status %d, want 202", rec.Code)
+	}
+	if len(s.notifier.jobs) != 2 {
+		t.Errorf("%d messages sent, want the transition and the test notification", len(s.notifier.jobs))
+	}
+}
+
+func TestEchoMode(t *testing.T) {
+	const body = `{"monitor":{"id":3,"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:00:00"},"msg":"timeout"}`
+	s := newWebhookServer(t, map[string]string{"ECHO_MODE": "true"})
+	s.dedup = newDeduplicator(time.Minute, defaultDedupKeyFields)
+
+	for range 2 {
+		rec := s.post(body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var echo struct {
+			Echo      bool           `json:"echo"`
+			Alert     map[string]any `json:"alert"`
+			Message   string         `json:"message"`
+			PlainText string         `json:"plain_text"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &echo); err != nil {
+			t.Fatal(err)
+		}
+		if !echo.Echo || echo.Alert["MonitorName"] != "db" || !strings.Contains(echo.Message, "`db`") || !strings.Contains(echo.PlainText, "timeout") {
+			t.Errorf("echo = %+v, want the rendered alert for db", echo)
+		}
+	}
+	if len(s.notifier.jobs) != 0 {
+		t.Errorf("echo mode delivered %d messages", len(s.notifier.jobs))
+	}
+	if !s.down.downSince("3").IsZero() {
+		t.Error("echo mode recorded the monitor as DOWN")
+	}
+}
+
+func TestCompactDataAttachment(t *testing.T) {
+	// Test notifications carry the compact data; their msg is shown above it
+	// as well.
+	long := strings.Repeat("x", 200)
+	raw := `{"msg":"` + long + `","password":"not copied"}`
+	tests := []struct {
+		maxInline      int
+		wantAttachment bool
+	}{
+		{maxInline: 0},
+		{maxInline: 1000},
+		{maxInline: 100, wantAttachment: true},
+	}
+	for _, tt := range tests {
+		opts := messageOptions{labels: messageLanguages["en"], compactDataMaxInline: tt.maxInline}
+		text, attachment := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+		if (attachment != nil) != tt.wantAttachment {
+			t.Fatalf("COMPACT_DATA_MAX_INLINE=%d: attachment = %v, want %v", tt.maxInline, attachment != nil, tt.wantAttachment)
+		}
+		if strings.Contains(text, "not copied") || attachment != nil && strings.Contains(string(attachment.content), "not copied") {
+			t.Errorf("COMPACT_DATA_MAX_INLINE=%d: a field outside the core data was included", tt.maxInline)
+		}
+		inline := strings.Count(text, long) == 2
+		if inline == tt.wantAttachment || tt.wantAttachment && !strings.Contains(text, "see attached "+compactDataFilename) {
+			t.Errorf("COMPACT_DATA_MAX_INLINE=%d: message\n%s", tt.maxInline, text)
+		}
+	}
+}
+
+func TestSendMessageWithAttachment(t *testing.T) {
+	fake := newFakeTelegram(t)
+	fake.respond = func(call telegramCall) (int, string) {
+		if call.method == "sendDocument" {
+			return http.StatusRequestEntityTooLarge, `{"ok":false,"description":"Request Entity Too Large"}`
+		}
+		return http.StatusOK, `{"ok":true,"result":{"message_id":9,"chat":{"id":1}}}`
+	}
+	client := newTelegramClient(testConfig(fake))
+	msg := outgoingMessage{text: "alert", document: &document{name: compactDataFilename, content: []byte(`{}`)}}
+	// The alert was delivered, so the failed attachment is not an error.
+	if sent, err := client.sendMessage(context.Background(), msg); err != nil || sent.MessageID != 9 {
+		t.Fatalf("sendMessage = %+v, %v", sent, err)
+	}
+	uploads := fake.sent("sendDocument")
+	if len(uploads) != 1 || !strings.HasPrefix(uploads[0].header.Get("Content-Type"), "multipart/form-data") {
+		t.Errorf("uploads = %v, want one multipart sendDocument", uploads)
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		monitor  string
+		showHTTP bool
+		want     string // host line; empty means none
+	}{
+		{name: "tcp port", monitor: `{"type":"port","hostname":"db.internal","port":5432}`, want: "db.internal:5432"},
+		{name: "zero port", monitor: `{"type":"ping","hostname":"db.internal","port":0}`, want: "db.internal"},
+		{name: "null port", monitor: `{"type":"ping","hostname":"db.internal","port":null}`, want: "db.internal"},
+		{name: "http hides port", monitor: `{"type":"http","hostname":"web","port":443,"url":"https://web.example.com"}`, want: "web"},
+		{name: "http port shown", monitor: `{"type":"http","hostname":"web","port":443,"url":"https://web.example.com"}`, showHTTP: true, want: "web:443"},
+		{name: "http without url keeps port", monitor: `{"type":"http","hostname":"web","port":8080}`, want: "web:8080"},
+		{name: "no hostname", monitor: `{"type":"http","url":"https://web.example.com"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `{"monitor":` + tt.monitor + `,"heartbeat":{"status":0}}`
+			opts := messageOptions{labels: messageLanguages["en"], showPortForHTTP: tt.showHTTP}
+			text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+			got := ""
+			for _, line := range strings.Split(text, "\n") {
+				if host, ok := strings.CutPrefix(line, "🖥️ Host: "); ok {
+					got = host
+				}
+			}
+			if got != tt.want {
+				t.Errorf("host = %q, want %q in\n%s", got, tt.want, text)
+			}
+		})
+	}
+}
+
+func TestMonitorURLLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string // URL line
+	}{
+		{url: "https://web.example.com/health", want: `🔗 <b>URL</b>: <a href="https://web.example.com/health">https://web.example.com/health</a>`},
+		{url: "http://10.0.0.1:8080", want: `🔗 <b>URL</b>: <a href="http://10.0.0.1:8080">http://10.0.0.1:8080</a>`},
+		{url: "ftp://files.example.com", want: "🔗 <b>URL</b>: <code>ftp://files.example.com</code>"},
+		{url: "javascript:alert(1)", want: "🔗 <b>URL</b>: <code>javascript:alert(1)</code>"},
+		{url: "web.example.com", want: "🔗 <b>URL</b>: <code>web.example.com</code>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			raw := `{"monitor":{"name":"web","url":"` + tt.url + `"},"heartbeat":{"status":0}}`
+			opts := messageOptions{labels: messageLanguages["en"], format: formatter{parseMode: parseModeHTML}}
+			text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+			if !slices.Contains(strings.Split(text, "\n"), tt.want) {
+				t.Errorf("message lacks %q:\n%s", tt.want, text)
+			}
+		})
+	}
+}
+
+func TestMaxTelegramConcurrency(t *testing.T) {
+	for _, limit := range []int{1, 2} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			fake := newFakeTelegram(t)
+			var inflight, peak atomic.Int32
+			fake.respond = func(telegramCall) (int, string) {
+				n := inflight.Add(1)
+				defer inflight.Add(-1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				time.Sleep(20 * time.Millisecond)
+				return http.StatusOK, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`
+			}
+			cfg := testConfig(fake)
+			cfg.maxTelegramConcurrency = limit
+			client := newTelegramClient(cfg)
+
+			// Distinct chats, so only the global cap orders the sends.
+			var wg sync.WaitGroup
+			for i := range 6 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := client.send(context.Background(), delivery{message: outgoingMessage{text: "hi"}, chatID: fmt.Sprint(i + 10)}); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := peak.Load(); got != int32(limit) {
+				t.Errorf("peak of %d concurrent requests, want %d", got, limit)
+			}
+		})
+	}
+}
+
+// gzipped compresses s.
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestBodyOverLimit(t *testing.T) {
+	body := func(size int) string {
+		prefix := `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"`
+		return prefix + strings.Repeat("a", size-len(prefix)-2) + `"}`
+	}
+	tests := []struct {
+		name     string
+		body     string
+		chunked  bool
+		wantCode int
+	}{
+		{name: "at the limit", body: body(1024), wantCode: http.StatusAccepted},
+		{name: "at the limit, chunked", body: body(1024), chunked: true, wantCode: http.StatusAccepted},
+		{name: "over the limit", body: body(1025), wantCode: http.StatusRequestEntityTooLarge},
+		{name: "over the limit, chunked", body: body(1025), chunked: true, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "far over the limit, chunked", body: body(64 << 10), chunked: true, wantCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"MAX_PAYLOAD_BYTES": "1024"})
+			req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+			if tt.chunked {
+				// Without a Content-Length only reading tells the size.
+				req.ContentLength = -1
+				req.Body = io.NopCloser(io.MultiReader(strings.NewReader(tt.body)))
+			}
+			rec := s.serve(req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("response %d %s, want %d", rec.Code, rec.Body, tt.wantCode)
+			}
+			if sent := len(s.notifier.jobs) > 0; sent != (tt.wantCode == http.StatusAccepted) {
+				t.Errorf("%d messages sent for response %d", len(s.notifier.jobs), rec.Code)
+			}
+		})
+	}
+}
+
+func TestGzipBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "gzipped payload", body: gzipped(t, `{"monitor":{"name":"gzipdb"},"heartbeat":{"status":0},"msg":"timeout"}`), wantCode: http.StatusAccepted},
+		// Compresses to a few bytes but expands past MAX_PAYLOAD_BYTES.
+		{name: "decompression bomb", body: gzipped(t, `{"msg":"`+strings.Repeat("a", 4096)+`"}`), wantCode: http.StatusRequestEntityTooLarge},
+		{name: "not gzip", body: `{"msg":"plain"}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.body) >= 1024 {
+				t.Fatalf("compressed body is %d bytes, not under the limit", len(tt.body))
+			}
+			s := newWebhookServer(t, map[string]string{"MAX_PAYLOAD_BYTES": "1024"})
+			req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := s.serve(req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("response %d %s, want %d", rec.Code, rec.Body, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusAccepted && (len(s.notifier.jobs) != 1 || !strings.Contains(s.notifier.jobs[0].message.text, "gzipdb")) {
+				t.Errorf("sent %v, want the decompressed alert", s.notifier.texts())
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import "time"
+
+// downTracker remembers which monitors are currently DOWN and since when.
+// Unless STATE_FILE is set the state lives in memory only, so it starts empty
+// after a restart.
+type downTracker struct {
+	states *monitorStates
+}
+
+func newDownTracker(states *monitorStates) *downTracker {
+	return &downTracker{states: states}
+}
+
+// observe records a DOWN heartbeat or clears the state on UP. For UP
+// heartbeats it returns when the monitor went DOWN; ok is false when no
+// matching DOWN was seen, i.e. the recovery is an orphan, and repeated is
+// true when the previous heartbeat was already UP.
+func (t *downTracker) observe(payload kumaPayload, now time.Time) (since time.Time, ok, repeated bool) {
+	key := payload.monitorKey()
+	if key == "" {
+		return time.Time{}, false, false
+	}
+
+	switch payload.statusCode() {
+	case "0":
+		if heartbeatTime, parsed := parseHeartbeatTime(string(payload.heartbeat().Time)); parsed {
+			now = heartbeatTime
+		}
+		t.states.update(key, func(state *monitorState) {
+			if state.DownSince.IsZero() {
+				state.DownSince = now
+			}
+			state.Up = false
+		})
+	case "1":
+		previous := t.states.update(key, func(state *monitorState) {
+			state.DownSince = time.Time{}
+			state.AckedAt = time.Time{}
+			state.Up = true
+		})
+		return previous.DownSince, !previous.DownSince.IsZero(), previous.Up
+	}
+	return time.Time{}, false, false
+}
+
+// downSince returns when the current outage of monitorID began, or zero when
+// it is not DOWN.
+func (t *downTracker) downSince(monitorID string) time.Time {
+	state, _ := t.states.get(monitorID)
+	return state.DownSince
+}
+
+// acknowledge marks the outage of monitorID that began at downSince as
+// acknowledged at now, muting further DOWN notifications until it recovers.
+// It reports false, changing nothing, when the monitor is no longer in that
+// outage.
+func (t *downTracker) acknowledge(monitorID string, downSince, now time.Time) bool {
+	var acked bool
+	t.states.update(monitorID, func(state *monitorState) {
+		if state.DownSince.IsZero() || state.DownSince.Unix() != downSince.Unix() {
+			return
+		}
+		state.AckedAt = now
+		acked = true
+	})
+	return acked
+}
+
+// muted reports whether DOWN notifications for the payload's monitor are
+// muted by an acknowledgement that is younger than timeout (0 means the mute
+// lasts until recovery).
+func (t *downTracker) muted(payload kumaPayload, now time.Time, timeout time.Duration) bool {
+	key := payload.monitorKey()
+	if key == "" {
+		return false
+	}
+	state, _ := t.states.get(key)
+	if state.AckedAt.IsZero() {
+		return false
+	}
+	return timeout <= 0 || now.Sub(state.AckedAt) < timeout
+}
+
+// downtime returns how long a monitor that went DOWN at since was down,
+// measured to the recovery heartbeat's time when it can be parsed. It returns
+// zero when the duration is unknown.
+func downtime(payload kumaPayload, since, now time.Time) time.Duration {
+	if since.IsZero() {
+		return 0
+	}
+	if heartbeatTime, ok := parseHeartbeatTime(string(payload.heartbeat().Time)); ok {
+		now = heartbeatTime
+	}
+	if elapsed := now.Sub(since); elapsed > 0 {
+		return elapsed.Round(time.Second)
+	}
+	return 0
+}
+
+// reportedDowntime returns the heartbeat.duration Uptime Kuma sends with a
+// recovery, in seconds, or zero for other heartbeats and when it is missing.
+func reportedDowntime(payload kumaPayload) time.Duration {
+	duration := payload.heartbeat().Duration
+	if payload.statusCode() != "1" || !duration.valid || duration.value <= 0 {
+		return 0
+	}
+	return time.Duration(duration.value * float64(time.Second)).Round(time.Second)
+}
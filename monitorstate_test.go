@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testDown = `{"monitor":{"id":7,"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:00:00"},"msg":"down"}`
+	testUp   = `{"monitor":{"id":7,"name":"db"},"heartbeat":{"status":1,"time":"2024-05-01 10:05:30"},"msg":"up"}`
+)
+
+func TestDownTrackerObserve(t *testing.T) {
+	down := newDownTracker(newMonitorStates(newMemoryStateStore()))
+	now := time.Now()
+
+	if _, wasDown, _ := down.observe(testPayload(t, testUp), now); wasDown {
+		t.Error("a recovery without a DOWN matched one")
+	}
+	down.observe(testPayload(t, testDown), now)
+	down.observe(testPayload(t, testDown), now.Add(time.Minute)) // the outage began with the first DOWN
+	since, wasDown, wasUp := down.observe(testPayload(t, testUp), now)
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if !wasDown || wasUp || !since.Equal(want) {
+		t.Errorf("observe = %v, %v, %v; want %v, true, false", since, wasDown, wasUp, want)
+	}
+	if got := downtime(testPayload(t, testUp), since, now); got != 5*time.Minute+30*time.Second {
+		t.Errorf("downtime = %s, want 5m30s from the heartbeat times", got)
+	}
+	if _, wasDown, wasUp := down.observe(testPayload(t, testUp), now); wasDown || !wasUp {
+		t.Errorf("second recovery: wasDown %v, wasUp %v; want false, true", wasDown, wasUp)
+	}
+}
+
+func TestOrphanRecovery(t *testing.T) {
+	tests := []struct {
+		suppress string
+		sends    []string
+		want     []int
+	}{
+		{suppress: "false", sends: []string{testUp}, want: []int{http.StatusAccepted}},
+		{suppress: "true", sends: []string{testUp}, want: []int{http.StatusNoContent}},
+		{suppress: "true", sends: []string{testDown, testUp}, want: []int{http.StatusAccepted, http.StatusAccepted}},
+	}
+	for _, tt := range tests {
+		s := newWebhookServer(t, map[string]string{"SUPPRESS_ORPHAN_RECOVERY": tt.suppress})
+		for i, body := range tt.sends {
+			if rec := s.post(body); rec.Code != tt.want[i] {
+				t.Errorf("SUPPRESS_ORPHAN_RECOVERY=%s, send %d: status %d, want %d", tt.suppress, i, rec.Code, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestReportedDowntime(t *testing.T) {
+	tests := []struct {
+		body string
+		want time.Duration
+	}{
+		{body: `{"heartbeat":{"status":1,"duration":90.4}}`, want: 90 * time.Second},
+		{body: `{"heartbeat":{"status":1,"duration":"3600"}}`, want: time.Hour},
+		{body: `{"heartbeat":{"status":0,"duration":90}}`},
+		{body: `{"heartbeat":{"status":1,"duration":0}}`},
+		{body: `{"heartbeat":{"status":1}}`},
+	}
+	for _, tt := range tests {
+		if got := reportedDowntime(testPayload(t, tt.body)); got != tt.want {
+			t.Errorf("reportedDowntime(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+
+	// A recovery without a tracked DOWN, e.g. after a restart, shows the
+	// duration Uptime Kuma reports.
+	s := newWebhookServer(t, map[string]string{"MESSAGE_LANGUAGE": "en"})
+	s.post(`{"monitor":{"id":7,"name":"db"},"heartbeat":{"status":1,"duration":3725},"msg":"up"}`)
+	if len(s.notifier.jobs) != 1 || !strings.Contains(s.notifier.jobs[0].message.text, "1h 2m 5s") {
+		t.Errorf("sent %v, want the reported downtime 1h 2m 5s", s.notifier.jobs)
+	}
+}
+
+func TestRepeatedRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		suppress string
+		sends    []string
+		want     []int
+	}{
+		{name: "second UP sent by default", suppress: "false", sends: []string{testDown, testUp, testUp}, want: []int{http.StatusAccepted, http.StatusAccepted, http.StatusAccepted}},
+		{name: "second UP suppressed", suppress: "true", sends: []string{testDown, testUp, testUp}, want: []int{http.StatusAccepted, http.StatusAccepted, http.StatusNoContent}},
+		{name: "UP after a new outage", suppress: "true", sends: []string{testDown, testUp, testDown, testUp}, want: []int{http.StatusAccepted, http.StatusAccepted, http.StatusAccepted, http.StatusAccepted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"SUPPRESS_REPEATED_RECOVERY": tt.suppress})
+			sent := 0
+			for i, body := range tt.sends {
+				if rec := s.post(body); rec.Code != tt.want[i] {
+					t.Errorf("send %d: status %d, want %d", i, rec.Code, tt.want[i])
+				}
+				if tt.want[i] == http.StatusAccepted {
+					sent++
+				}
+			}
+			if len(s.notifier.jobs) != sent {
+				t.Errorf("%d messages sent, want %d", len(s.notifier.jobs), sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	notifierTelegram = "telegram"
+	notifierSlack    = "slack"
+)
+
+// notifier is a destination alerts are delivered to.
+type notifier interface {
+	// name identifies the notifier in NOTIFIER, the spool and logs.
+	name() string
+	// send makes a single delivery attempt for job.
+	send(ctx context.Context, job delivery) (sentMessage, error)
+}
+
+// parseNotifiers parses the comma-separated NOTIFIER value.
+func parseNotifiers(value string) ([]string, error) {
+	var names []string
+	for _, field := range strings.Split(value, ",") {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if name == "" {
+			continue
+		}
+		if name != notifierTelegram && name != notifierSlack {
+			return nil, fmt.Errorf("unsupported notifier %q: must be telegram or slack", name)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%q names no notifier", value)
+	}
+	return names, nil
+}
+
+// validateSlackWebhookURL checks that value is an absolute http(s) URL.
+func validateSlackWebhookURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%q must be an http or https URL", u.Redacted())
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records the deliveries it is asked to send. Each send fails
+// with the next entry of errs, if any, and succeeds once they are used up.
+type fakeNotifier struct {
+	id string
+
+	mu   sync.Mutex
+	jobs []delivery
+	errs []error
+}
+
+func (f *fakeNotifier) name() string { return f.id }
+
+func (f *fakeNotifier) send(_ context.Context, job delivery) (sentMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs = append(f.jobs, job)
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		if err != nil {
+			return sentMessage{}, err
+		}
+	}
+	sent := sentMessage{MessageID: int64(len(f.jobs))}
+	return sent, nil
+}
+
+// texts returns the text of every message sent so far.
+func (f *fakeNotifier) texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var texts []string
+	for _, job := range f.jobs {
+		texts = append(texts, job.message.text)
+	}
+	return texts
+}
+
+func TestParseNotifiers(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "telegram", want: []string{"telegram"}},
+		{value: " Slack , telegram,slack", want: []string{"slack", "telegram"}},
+		{value: "email", wantErr: true},
+		{value: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseNotifiers(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseNotifiers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	tests := []struct {
+		name       string
+		notifier   string // delivery.notifier; empty means all
+		errs       map[string]error
+		wantSent   map[string]int
+		wantErr    bool
+		wantLetter int
+	}{
+		{name: "every notifier", wantSent: map[string]int{"a": 1, "b": 1}},
+		{name: "single notifier", notifier: "b", wantSent: map[string]int{"b": 1}},
+		{name: "disabled notifier", notifier: "c", wantSent: map[string]int{}},
+		{
+			name:       "failure of one notifier",
+			errs:       map[string]error{"a": errUnavailable},
+			wantSent:   map[string]int{"a": 1, "b": 1},
+			wantErr:    true,
+			wantLetter: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &fakeNotifier{id: "a", errs: []error{tt.errs["a"]}}
+			b := &fakeNotifier{id: "b", errs: []error{tt.errs["b"]}}
+			letters := filepath.Join(t.TempDir(), "dead.jsonl")
+			d := &dispatcher{notifiers: []notifier{a, b}, requestTimeout: time.Second, deadLetters: newDeadLetterWriter(letters)}
+
+			_, err := d.deliver(context.Background(), delivery{message: outgoingMessage{text: "hi"}, notifier: tt.notifier, raw: []byte(`{}`)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deliver error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, n := range []*fakeNotifier{a, b} {
+				if got := len(n.jobs); got != tt.wantSent[n.id] {
+					t.Errorf("notifier %s got %d messages, want %d", n.id, got, tt.wantSent[n.id])
+				}
+			}
+			content, _ := os.ReadFile(letters)
+			if n := strings.Count(string(content), "\n"); n != tt.wantLetter {
+				t.Errorf("%d dead letters, want %d", n, tt.wantLetter)
+			}
+		})
+	}
+}
+
+func TestMissingRightsFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		wantErr  bool
+		wantTo   []string // chat IDs of the sendMessage calls
+	}{
+		{name: "fallback chat", fallback: "9", wantTo: []string{"1", "9"}},
+		{name: "no fallback", wantErr: true, wantTo: []string{"1"}},
+		{name: "fallback is the chat", fallback: "1", wantErr: true, wantTo: []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTelegram(t)
+			fake.respond = func(call telegramCall) (int, string) {
+				if call.body["chat_id"] == "1" {
+					return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: not enough rights to send text messages to the chat"}`
+				}
+				return http.StatusOK, `{"ok":true,"result":{"message_id":5,"chat":{"id":9}}}`
+			}
+			d := &dispatcher{notifiers: []notifier{newTelegramNotifier(testConfig(fake))}, requestTimeout: time.Second, fallbackChatID: tt.fallback}
+
+			_, err := d.deliver(context.Background(), delivery{message: outgoingMessage{text: "hi"}, chatID: "1", threadID: 3})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deliver error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var to []string
+			for _, call := range fake.sent("sendMessage") {
+				to = append(to, call.body["chat_id"].(string))
+			}
+			if !slices.Equal(to, tt.wantTo) {
+				t.Errorf("sent to chats %v, want %v", to, tt.wantTo)
+			}
+			calls := fake.sent("sendMessage")
+			if calls[0].body["message_thread_id"] == nil {
+				t.Errorf("the routed message lost its topic: %v", calls[0].body)
+			}
+			if len(calls) == 2 && calls[1].body["message_thread_id"] != nil {
+				t.Errorf("the fallback message kept the topic: %v", calls[1].body)
+			}
+		})
+	}
+}
+
+func TestDeliveryQueueRetries(t *testing.T) {
+	timeout := &timeoutError{}
+	tests := []struct {
+		name       string
+		atMostOnce bool
+		retries    int
+		errs       []error
+		wantCalls  int
+		wantLetter bool
+	}{
+		{name: "delivered first time", retries: 3, wantCalls: 1},
+		{name: "retryable failure recovers", retries: 3, errs: []error{errUnavailable, errUnavailable}, wantCalls: 3},
+		{name: "retries exhausted", retries: 2, errs: []error{errUnavailable, errUnavailable, errUnavailable}, wantCalls: 3, wantLetter: true},
+		{name: "rejected message not retried", retries: 3, errs: []error{errChatNotFound}, wantCalls: 1, wantLetter: true},
+		{name: "timeout retried at least once", retries: 3, errs: []error{timeout}, wantCalls: 2},
+		{name: "timeout not retried at most once", atMostOnce: true, retries: 3, errs: []error{timeout}, wantCalls: 1, wantLetter: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &fakeNotifier{id: "fake", errs: tt.errs}
+			letters := filepath.Join(t.TempDir(), "dead.jsonl")
+			d := &dispatcher{notifiers: []notifier{n}, requestTimeout: time.Second, atMostOnce: tt.atMostOnce, deadLetters: newDeadLetterWriter(letters)}
+			q := newDeliveryQueue(d, 1, 1, tt.retries, time.Millisecond, 0)
+			if !q.enqueue(delivery{message: outgoingMessage{text: "hi"}}) {
+				t.Fatal("enqueue failed")
+			}
+			q.close()
+
+			if len(n.jobs) != tt.wantCalls {
+				t.Errorf("%d attempts, want %d", len(n.jobs), tt.wantCalls)
+			}
+			if _, err := os.Stat(letters); (err == nil) != tt.wantLetter {
+				t.Errorf("dead-lettered = %v, want %v", err == nil, tt.wantLetter)
+			}
+		})
+	}
+}
+
+func TestTimeoutAfterDelivery(t *testing.T) {
+	tests := []struct {
+		semantics string
+		wantCalls int
+	}{
+		{semantics: "at-least-once", wantCalls: 2},
+		{semantics: "at-most-once", wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.semantics, func(t *testing.T) {
+			cfg, err := loadConfig(testSettings(map[string]string{"DELIVERY_SEMANTICS": tt.semantics}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake := newFakeTelegram(t)
+			var calls atomic.Int32
+			// Telegram takes the first message but answers after the
+			// request has timed out.
+			fake.respond = func(telegramCall) (int, string) {
+				if calls.Add(1) == 1 {
+					time.Sleep(200 * time.Millisecond)
+				}
+				return http.StatusOK, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`
+			}
+			clientCfg := testConfig(fake)
+			clientCfg.requestTimeout = 50 * time.Millisecond
+			d := &dispatcher{notifiers: []notifier{newTelegramNotifier(clientCfg)}, requestTimeout: clientCfg.requestTimeout, atMostOnce: cfg.atMostOnce}
+			q := newDeliveryQueue(d, 1, 1, 2, time.Millisecond, 0)
+			q.enqueue(delivery{message: outgoingMessage{text: "hi"}})
+			q.close()
+
+			if got := len(fake.sent("sendMessage")); got != tt.wantCalls {
+				t.Errorf("Telegram received the message %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+	if _, err := loadConfig(testSettings(map[string]string{"DELIVERY_SEMANTICS": "exactly-once"})); err == nil {
+		t.Error("unknown DELIVERY_SEMANTICS accepted")
+	}
+}
+
+func TestDeliveryQueueFull(t *testing.T) {
+	q := &deliveryQueue{jobs: make(chan delivery, 2)}
+	for i := range 2 {
+		if !q.enqueue(delivery{}) {
+			t.Fatalf("enqueue %d failed with room left", i)
+		}
+	}
+	if q.enqueue(delivery{}) {
+		t.Error("enqueue succeeded on a full queue")
+	}
+}
+
+// timeoutError is a network error that timed out, after which the message
+// may have been delivered.
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+func TestDeliveryQueueTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		wantCalls int
+	}{
+		{name: "unlimited", wantCalls: 3},
+		{name: "room for retries", timeout: time.Minute, wantCalls: 3},
+		{name: "backoff outlasts the timeout", timeout: 50 * time.Millisecond, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &fakeNotifier{id: "fake", errs: []error{errUnavailable, errUnavailable, errUnavailable}}
+			d := &dispatcher{notifiers: []notifier{n}, requestTimeout: time.Second}
+			q := newDeliveryQueue(d, 1, 1, 2, 100*time.Millisecond, tt.timeout)
+			q.enqueue(delivery{message: outgoingMessage{text: "hi"}})
+			q.close()
+			if len(n.jobs) != tt.wantCalls {
+				t.Errorf("%d attempts, want %d", len(n.jobs), tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kumaPayload is the webhook body Uptime Kuma sends for monitor events. Its
+// fields tolerate the encodings seen across Uptime Kuma versions: numbers
+// sent as strings and vice versa, nulls and missing objects all decode, and
+// unknown fields are ignored.
+type kumaPayload struct {
+	Heartbeat   *kumaHeartbeat   `json:"heartbeat"`
+	Monitor     *kumaMonitor     `json:"monitor"`
+	Maintenance *kumaMaintenance `json:"maintenance"` // set for maintenance notifications only
+	Msg         flexString       `json:"msg"`
+}
+
+type kumaHeartbeat struct {
+	Status         flexInt    `json:"status"` // 0 DOWN, 1 UP, 2 PENDING, 3 MAINTENANCE
+	Msg            flexString `json:"msg"`
+	Ping           flexFloat  `json:"ping"` // milliseconds
+	Time           flexString `json:"time"` // UTC, "2006-01-02 15:04:05.000"
+	LocalDateTime  flexString `json:"localDateTime"`
+	Timezone       flexString `json:"timezone"`
+	TimezoneOffset flexString `json:"timezoneOffset"`
+	Important      flexBool   `json:"important"`
+	Duration       flexFloat  `json:"duration"` // seconds since the previous status
+}
+
+type kumaMonitor struct {
+	ID       flexString `json:"id"`
+	Name     flexString `json:"name"`
+	Type     flexString `json:"type"`
+	Hostname flexString `json:"hostname"`
+	Port     flexString `json:"port"`
+	URL      flexString `json:"url"`
+	Tags     []kumaTag  `json:"tags"`
+	Parent   kumaParent `json:"parent"`
+	PathName flexString `json:"pathName"` // "Group / Monitor" for monitors in a group
+}
+
+// kumaParent is the group a monitor belongs to. Uptime Kuma sends the
+// group's monitor ID; a name or an object with id and name is accepted too.
+type kumaParent struct {
+	ID   flexString `json:"id"`
+	Name flexString `json:"name"`
+}
+
+func (g *kumaParent) UnmarshalJSON(data []byte) error {
+	*g = kumaParent{}
+	if len(data) > 0 && data[0] == '{' {
+		type plain kumaParent
+		return json.Unmarshal(data, (*plain)(g))
+	}
+	var value flexString
+	if err := value.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(string(value)); err == nil {
+		g.ID = value
+	} else {
+		g.Name = value
+	}
+	return nil
+}
+
+// kumaMaintenance is a scheduled maintenance. Depending on the strategy its
+// window is sent as start/end, startDate/endDate or a timeslotList.
+type kumaMaintenance struct {
+	Title        flexString     `json:"title"`
+	Description  flexString     `json:"description"`
+	Start        flexString     `json:"start"`
+	End          flexString     `json:"end"`
+	StartDate    flexString     `json:"startDate"`
+	EndDate      flexString     `json:"endDate"`
+	TimeslotList []kumaTimeslot `json:"timeslotList"`
+}
+
+type kumaTimeslot struct {
+	StartDate flexString `json:"startDate"`
+	EndDate   flexString `json:"endDate"`
+}
+
+type kumaTag struct {
+	Name  flexString `json:"name"`
+	Value flexString `json:"value"`
+}
+
+// decodePayload decodes raw into a kumaPayload. Only bodies that aren't a
+// JSON object fail; fields of an unexpected type are left empty.
+func decodePayload(raw []byte) (kumaPayload, error) {
+	var p kumaPayload
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return p, errors.New("payload is not a JSON object")
+	}
+	err := json.Unmarshal(trimmed, &p)
+	var typeErr *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		return p, err
+	}
+	return p, nil
+}
+
+func (p kumaPayload) heartbeat() kumaHeartbeat {
+	if p.Heartbeat == nil {
+		return kumaHeartbeat{}
+	}
+	return *p.Heartbeat
+}
+
+func (p kumaPayload) monitor() kumaMonitor {
+	if p.Monitor == nil {
+		return kumaMonitor{}
+	}
+	return *p.Monitor
+}
+
+// isTest reports whether the payload is a notification sent by Uptime Kuma's
+// "Test" button rather than a real monitor event. The test button sends
+// neither a heartbeat nor a monitor; maintenance and certificate expiry
+// notices, which don't either, are recognized by their content.
+func (p kumaPayload) isTest() bool {
+	if p.Heartbeat != nil || p.Monitor != nil || p.Maintenance != nil {
+		return false
+	}
+	_, isCert := parseCertExpiry(p)
+	return !isCert
+}
+
+// isImportant reports whether the payload marks a state transition. Payloads
+// without a heartbeat, such as test notifications, always count as important.
+func (p kumaPayload) isImportant() bool {
+	return p.Heartbeat == nil || bool(p.Heartbeat.Important)
+}
+
+// monitorKey identifies the monitor the payload belongs to, preferring the
+// stable monitor.id over the editable name.
+func (p kumaPayload) monitorKey() string {
+	if id := p.monitor().ID; id != "" {
+		return string(id)
+	}
+	return string(p.monitor().Name)
+}
+
+// statusCode returns heartbeat.status as sent, e.g. "0" for DOWN, or "" when
+// it is missing.
+func (p kumaPayload) statusCode() string {
+	status := p.heartbeat().Status
+	if !status.valid {
+		return ""
+	}
+	return strconv.Itoa(status.value)
+}
+
+// status maps heartbeat.status to an emoji and label.
+func (p kumaPayload) status(l messageLabels) (emoji, label string) {
+	return statusLabel(p.statusCode(), l)
+}
+
+// statusLabel maps a heartbeat status code to an emoji and label.
+func statusLabel(status string, l messageLabels) (emoji, label string) {
+	switch status {
+	case "0":
+		return l.emojiDown, "DOWN"
+	case "1":
+		return l.emojiUp, "UP"
+	case "3":
+		return "🛠️", "MAINTENANCE"
+	default:
+		return "ℹ️", "UNKNOWN"
+	}
+}
+
+// url returns monitor.url, or "" for the bare "https://" placeholder Uptime
+// Kuma stores for non-HTTP monitors.
+func (p kumaPayload) url() string {
+	value := string(p.monitor().URL)
+	if value == "https://" || value == "http://" {
+		return ""
+	}
+	return value
+}
+
+// displayName returns the name alerts are shown under: monitor.name, else
+// the host of monitor.url, else the first segment of msg (Uptime Kuma writes
+// "[name] [status] ..."), else fallback.
+func (p kumaPayload) displayName(fallback string) string {
+	if name := string(p.monitor().Name); name != "" {
+		return name
+	}
+	if parsed, err := url.Parse(p.url()); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	msg := string(p.Msg)
+	if rest, ok := strings.CutPrefix(msg, "["); ok {
+		if segment, _, ok := strings.Cut(rest, "]"); ok && strings.TrimSpace(segment) != "" {
+			return strings.TrimSpace(segment)
+		}
+	} else if segment, _, ok := strings.Cut(msg, " - "); ok && strings.TrimSpace(segment) != "" {
+		return strings.TrimSpace(segment)
+	}
+	return fallback
+}
+
+// group returns the group the monitor belongs to: monitor.pathName without
+// the monitor's own name, else the parent's name, else "#" and the parent's
+// ID. Monitors outside a group yield "".
+func (p kumaPayload) group() string {
+	monitor := p.monitor()
+	if parent, ok := strings.CutSuffix(string(monitor.PathName), " / "+string(monitor.Name)); ok && monitor.Name != "" && strings.TrimSpace(parent) != "" {
+		return strings.TrimSpace(parent)
+	}
+	if monitor.Parent.Name != "" {
+		return string(monitor.Parent.Name)
+	}
+	if monitor.Parent.ID != "" {
+		return "#" + string(monitor.Parent.ID)
+	}
+	return ""
+}
+
+// isHTTP reports whether the payload is from an HTTP-type monitor with a
+// URL, which makes a separate port redundant.
+func (p kumaPayload) isHTTP() bool {
+	return httpMonitorTypes[string(p.monitor().Type)] && p.url() != ""
+}
+
+// message prefers the top-level msg and falls back to heartbeat.msg.
+func (p kumaPayload) message() string {
+	if p.Msg != "" {
+		return string(p.Msg)
+	}
+	if msg := p.heartbeat().Msg; msg != "N/A" {
+		return string(msg)
+	}
+	return ""
+}
+
+// ping returns heartbeat.ping in milliseconds; ok is false when the monitor
+// didn't measure it (missing, null or 0).
+func (p kumaPayload) ping() (ms string, ok bool) {
+	ping := p.heartbeat().Ping
+	if !ping.valid || ping.value == 0 {
+		return "", false
+	}
+	return ping.String(), true
+}
+
+// displayTime returns the heartbeat timestamp to show. With a location the
+// heartbeat's instant is converted into it and formatted with layout;
+// otherwise, or when the instant is unknown, localDateTime is returned as
+// sent.
+func (p kumaPayload) displayTime(location *time.Location, layout string) string {
+	heartbeat := p.heartbeat()
+	if location == nil {
+		return string(heartbeat.LocalDateTime)
+	}
+	heartbeatTime, ok := p.instant()
+	if !ok {
+		return string(heartbeat.LocalDateTime)
+	}
+	if layout == "" {
+		layout = displayTimeLayout
+	}
+	return heartbeatTime.In(location).Format(layout)
+}
+
+// instant returns when the heartbeat happened: heartbeat.time, which is UTC,
+// or else localDateTime in the zone given by timezoneOffset or timezone.
+func (p kumaPayload) instant() (time.Time, bool) {
+	heartbeat := p.heartbeat()
+	if t, ok := parseHeartbeatTime(string(heartbeat.Time)); ok {
+		return t, true
+	}
+	location, ok := parseUTCOffset(string(heartbeat.TimezoneOffset))
+	if !ok {
+		if heartbeat.Timezone == "" {
+			return time.Time{}, false
+		}
+		var err error
+		if location, err = time.LoadLocation(string(heartbeat.Timezone)); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return parseLocalDateTime(string(heartbeat.LocalDateTime), location)
+}
+
+// relativeTime describes how long ago the heartbeat was. Missing,
+// unparseable and future times yield false so the caller can omit the hint.
+func (p kumaPayload) relativeTime(now time.Time, l messageLabels) (string, bool) {
+	heartbeatTime, ok := p.instant()
+	if !ok {
+		return "", false
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return relativeTime(heartbeatTime, now, l)
+}
+
+// tags renders monitor.tags as "name" or "name:value" strings.
+func (p kumaPayload) tags() []string {
+	var tags []string
+	for _, tag := range p.monitor().Tags {
+		if tag.Name == "" {
+			continue
+		}
+		name := string(tag.Name)
+		if tag.Value != "" {
+			name += ":" + string(tag.Value)
+		}
+		tags = append(tags, name)
+	}
+	return tags
+}
+
+// flexString decodes a JSON string or number into its trimmed text. Other
+// values, including null, decode as "".
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	*s = ""
+	switch {
+	case len(data) == 0:
+	case data[0] == '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*s = flexString(strings.TrimSpace(text))
+	case data[0] == '-' || (data[0] >= '0' && data[0] <= '9'):
+		*s = flexString(data)
+	}
+	return nil
+}
+
+// flexBool decodes a boolean sent as a JSON boolean, a number (non-zero is
+// true) or a string accepted by strconv.ParseBool. Anything else is false.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	*b = false
+	switch string(data) {
+	case "true":
+		*b = true
+		return nil
+	case "false", "null":
+		return nil
+	}
+	var text flexString
+	if err := text.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if number, err := strconv.ParseFloat(string(text), 64); err == nil {
+		*b = number != 0
+		return nil
+	}
+	value, _ := strconv.ParseBool(string(text))
+	*b = flexBool(value)
+	return nil
+}
+
+// flexInt decodes an integer sent as a JSON number or numeric string; valid
+// is false for anything else.
+type flexInt struct {
+	value int
+	valid bool
+}
+
+func (i *flexInt) UnmarshalJSON(data []byte) error {
+	var text flexString
+	if err := text.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	value, err := strconv.Atoi(string(text))
+	*i = flexInt{value: value, valid: err == nil}
+	return nil
+}
+
+// flexFloat decodes a number sent as a JSON number or numeric string; valid
+// is false for anything else.
+type flexFloat struct {
+	value float64
+	valid bool
+}
+
+// String returns the number as sent, or "" when it isn't valid.
+func (f flexFloat) String() string {
+	if !f.valid {
+		return ""
+	}
+	return strconv.FormatFloat(f.value, 'f', -1, 64)
+}
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	var text flexString
+	if err := text.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	value, err := strconv.ParseFloat(string(text), 64)
+	*f = flexFloat{value: value, valid: err == nil}
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testPayload decodes raw, failing the test if it isn't a payload.
+func testPayload(t *testing.T, raw string) kumaPayload {
+	t.Helper()
+	p, err := decodePayload([]byte(raw))
+	if err != nil {
+		t.Fatalf("decodePayload(%s): %v", raw, err)
+	}
+	return p
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		wantErr       bool
+		wantKey       string
+		wantStatus    string
+		wantImportant bool
+		wantPing      string
+		wantGroup     string
+	}{
+		{
+			name:          "numbers",
+			raw:           `{"monitor":{"id":7,"name":"db"},"heartbeat":{"status":0,"important":true,"ping":12.5}}`,
+			wantKey:       "7",
+			wantStatus:    "0",
+			wantImportant: true,
+			wantPing:      "12.5",
+		},
+		{
+			name:          "numbers as strings",
+			raw:           `{"monitor":{"id":"7","name":"db"},"heartbeat":{"status":"1","important":"1","ping":"3"}}`,
+			wantKey:       "7",
+			wantStatus:    "1",
+			wantImportant: true,
+			wantPing:      "3",
+		},
+		{
+			name:       "important as number zero",
+			raw:        `{"monitor":{"name":"db"},"heartbeat":{"status":1,"important":0}}`,
+			wantKey:    "db",
+			wantStatus: "1",
+		},
+		{
+			name:          "null objects",
+			raw:           `{"monitor":null,"heartbeat":null,"msg":"Testing"}`,
+			wantImportant: true,
+		},
+		{
+			name:       "field of the wrong type",
+			raw:        `{"monitor":{"id":3,"tags":"none"},"heartbeat":{"status":[0]}}`,
+			wantKey:    "3",
+			wantStatus: "",
+		},
+		{
+			name:       "parent ID",
+			raw:        `{"monitor":{"id":3,"parent":12},"heartbeat":{"status":0}}`,
+			wantKey:    "3",
+			wantStatus: "0",
+			wantGroup:  "#12",
+		},
+		{
+			name:       "path name",
+			raw:        `{"monitor":{"name":"db","pathName":"Prod / db","parent":{"id":1,"name":"ignored"}},"heartbeat":{"status":0}}`,
+			wantKey:    "db",
+			wantStatus: "0",
+			wantGroup:  "Prod",
+		},
+		{name: "array", raw: `[1,2]`, wantErr: true},
+		{name: "empty", raw: ` `, wantErr: true},
+		{name: "truncated", raw: `{"monitor":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := decodePayload([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := p.monitorKey(); got != tt.wantKey {
+				t.Errorf("monitorKey = %q, want %q", got, tt.wantKey)
+			}
+			if got := p.statusCode(); got != tt.wantStatus {
+				t.Errorf("statusCode = %q, want %q", got, tt.wantStatus)
+			}
+			if got := p.isImportant(); got != tt.wantImportant {
+				t.Errorf("isImportant = %v, want %v", got, tt.wantImportant)
+			}
+			if got, _ := p.ping(); got != tt.wantPing {
+				t.Errorf("ping = %q, want %q", got, tt.wantPing)
+			}
+			if got := p.group(); got != tt.wantGroup {
+				t.Errorf("group = %q, want %q", got, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestPayloadDisplayName(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: `{"monitor":{"name":"db","url":"https://db.example.com"}}`, want: "db"},
+		{raw: `{"monitor":{"url":"https://db.example.com:8443/health"}}`, want: "db.example.com"},
+		{raw: `{"monitor":{"url":"https://"},"msg":"[db] [🔴 Down] timeout"}`, want: "db"},
+		{raw: `{"msg":"db - connection refused"}`, want: "db"},
+		{raw: `{"msg":"connection refused"}`, want: "fallback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := testPayload(t, tt.raw).displayName("fallback"); got != tt.want {
+				t.Errorf("displayName(%s) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultMonitorName(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "monitor name", raw: `{"monitor":{"name":"db"},"heartbeat":{"status":0}}`, want: "db"},
+		{name: "url host", raw: `{"monitor":{"url":"https://db.example.com/health"},"heartbeat":{"status":0}}`, want: "db.example.com"},
+		{name: "msg segment", raw: `{"heartbeat":{"status":0},"msg":"db - connection refused"}`, want: "db"},
+		{name: "default", raw: `{"heartbeat":{"status":0},"msg":"connection refused"}`, want: "Edge probe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"DEFAULT_MONITOR_NAME": " Edge probe "})
+			if rec := s.post(tt.raw); rec.Code != http.StatusAccepted {
+				t.Fatalf("response %d %s", rec.Code, rec.Body)
+			}
+			if len(s.notifier.jobs) != 1 {
+				t.Fatalf("%d messages sent, want 1", len(s.notifier.jobs))
+			}
+			job := s.notifier.jobs[0]
+			if job.monitorName != tt.want || !strings.Contains(job.message.text, escapeMarkdown(tt.want)) {
+				t.Errorf("monitor %q, message\n%s\nwant %q", job.monitorName, job.message.text, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonObjectPayload(t *testing.T) {
+	for _, body := range []string{`[1,2]`, `42`, `"db is down"`, `null`} {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s strict=%v", body, strict), func(t *testing.T) {
+				s := newWebhookServer(t, map[string]string{"STRICT_PAYLOAD": fmt.Sprint(strict)})
+				rec := s.post(body)
+				if strict {
+					if rec.Code != http.StatusUnprocessableEntity || len(s.notifier.jobs) != 0 {
+						t.Errorf("response %d with %d messages sent, want 422 and none", rec.Code, len(s.notifier.jobs))
+					}
+					return
+				}
+				if rec.Code != http.StatusAccepted || len(s.notifier.jobs) != 1 {
+					t.Fatalf("response %d with %d messages sent, want 202 and one", rec.Code, len(s.notifier.jobs))
+				}
+				text := s.notifier.jobs[0].message.text
+				if !strings.Contains(text, escapeMarkdown(s.cfg.messageLabels.notObject)) || !strings.Contains(text, "```\n"+body+"\n```") {
+					t.Errorf("message does not show the note and the raw body:\n%s", text)
+				}
+			})
+		}
+	}
+}
+
+func TestGroupLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		monitor string
+		want    string // group line; empty means none
+	}{
+		{name: "path name", monitor: `{"name":"db","pathName":"Prod / EU / db"}`, want: "📁 Group: Prod / EU"},
+		{name: "parent name", monitor: `{"name":"db","parent":{"id":3,"name":"Prod"}}`, want: "📁 Group: Prod"},
+		{name: "parent object ID", monitor: `{"name":"db","parent":{"id":3}}`, want: "📁 Group: #3"},
+		{name: "parent ID as string", monitor: `{"name":"db","parent":"3"}`, want: "📁 Group: #3"},
+		{name: "top level", monitor: `{"name":"db","pathName":"db","parent":null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `{"monitor":` + tt.monitor + `,"heartbeat":{"status":0}}`
+			opts := messageOptions{labels: messageLanguages["en"]}
+			text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+			lines := strings.Split(text, "\n")
+			group := slices.IndexFunc(lines, func(line string) bool { return strings.HasPrefix(line, "📁 ") })
+			if tt.want == "" {
+				if group >= 0 {
+					t.Errorf("unexpected group line %q", lines[group])
+				}
+				return
+			}
+			if group < 0 || lines[group] != tt.want {
+				t.Fatalf("message has no line %q:\n%s", tt.want, text)
+			}
+			if group+1 >= len(lines) || lines[group+1] != "📊 Service: db" {
+				t.Errorf("the group line is not right above the monitor name:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestBuildTelegramMessageKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "monitor", raw: `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"timeout"}`, want: "DOWN"},
+		{name: "maintenance", raw: `{"maintenance":{"title":"Upgrade","timeslotList":[{"startDate":"10:00","endDate":"11:00"}]}}`, want: "10:00 ~ 11:00"},
+		{name: "certificate", raw: `{"msg":"[db][https://db.example.com] certificate db.example.com will be expired in 7 days"}`, want: "db.example.com"},
+		{name: "not an object", raw: `[1,2]`, want: "[1,2]"},
+		{name: "not JSON", raw: `hello`, want: "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := decodePayload([]byte(tt.raw))
+			opts := messageOptions{labels: messageLanguages["en"]}
+			text, _ := buildTelegramMessage(p, []byte(tt.raw), opts)
+			if !strings.Contains(text, tt.want) {
+				t.Errorf("message does not contain %q:\n%s", tt.want, text)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// pinMessage pins messageID in the client's chat without notifying members.
+func (c *telegramClient) pinMessage(ctx context.Context, messageID int64) error {
+	return c.callAPI(ctx, "pinChatMessage", map[string]any{
+		"chat_id":              c.chatID,
+		"message_id":           messageID,
+		"disable_notification": true,
+	}, nil)
+}
+
+// unpinMessage unpins messageID in the client's chat.
+func (c *telegramClient) unpinMessage(ctx context.Context, messageID int64) error {
+	return c.callAPI(ctx, "unpinChatMessage", map[string]any{
+		"chat_id":    c.chatID,
+		"message_id": messageID,
+	}, nil)
+}
+
+// pinTracker pins DOWN alerts and unpins them when the monitor recovers. The
+// pinned message is remembered per monitor in states.
+type pinTracker struct {
+	telegram *telegramNotifier
+	states   *monitorStates
+
+	rightsWarning sync.Once
+}
+
+func newPinTracker(telegram *telegramNotifier, states *monitorStates) *pinTracker {
+	return &pinTracker{telegram: telegram, states: states}
+}
+
+// observe pins or unpins after job was sent as sent. Failures are logged and
+// never affect the webhook response.
+func (p *pinTracker) observe(ctx context.Context, job delivery, sent sentMessage) {
+	if job.monitorID == "" {
+		return
+	}
+
+	switch job.status {
+	case "0":
+		if previous, ok := p.swap(job.monitorID, sent.MessageID); ok {
+			p.unpin(ctx, job, previous)
+		}
+		if err := p.telegram.client().forChat(job.chatID, job.threadID).pinMessage(ctx, sent.MessageID); err != nil {
+			p.warn("failed to pin DOWN message", err)
+			p.take(job.monitorID)
+		}
+	case "1":
+		if previous, ok := p.take(job.monitorID); ok {
+			p.unpin(ctx, job, previous)
+		}
+	}
+}
+
+func (p *pinTracker) unpin(ctx context.Context, job delivery, messageID int64) {
+	if err := p.telegram.client().forChat(job.chatID, job.threadID).unpinMessage(ctx, messageID); err != nil {
+		p.warn("failed to unpin message", err)
+	}
+}
+
+func (p *pinTracker) swap(monitorID string, messageID int64) (int64, bool) {
+	previous := p.states.update(monitorID, func(state *monitorState) {
+		state.PinnedMessageID = messageID
+	})
+	return previous.PinnedMessageID, previous.PinnedMessageID != 0
+}
+
+func (p *pinTracker) take(monitorID string) (int64, bool) {
+	previous := p.states.update(monitorID, func(state *monitorState) {
+		state.PinnedMessageID = 0
+	})
+	return previous.PinnedMessageID, previous.PinnedMessageID != 0
+}
+
+// warn logs pin failures. A missing pin right is reported only once since it
+// will keep failing until an admin changes the bot's permissions.
+func (p *pinTracker) warn(msg string, err error) {
+	if isMissingRightsError(err) {
+		p.rightsWarning.Do(func() {
+			slog.Warn("bot lacks the right to pin messages; grant it \"Pin messages\" or disable PIN_DOWN_MESSAGES", "error", err)
+		})
+		return
+	}
+	slog.Warn(msg, "error", err)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestPinTracker(t *testing.T) {
+	fake := newFakeTelegram(t)
+	store := newMemoryStateStore()
+	pins := newPinTracker(newTelegramNotifier(testConfig(fake)), newMonitorStates(store))
+	ctx := context.Background()
+	alert := func(status string, messageID int64) {
+		pins.observe(ctx, delivery{monitorID: "7", status: status, chatID: "5"}, sentMessage{MessageID: messageID})
+	}
+
+	alert("0", 10)
+	alert("0", 11) // a repeated DOWN moves the pin to the newer alert
+	alert("1", 12)
+	alert("1", 13) // nothing is pinned any more
+
+	pinned, unpinned := fake.sent("pinChatMessage"), fake.sent("unpinChatMessage")
+	if len(pinned) != 2 || pinned[0].body["message_id"] != 10.0 || pinned[1].body["message_id"] != 11.0 {
+		t.Errorf("pinned %v, want messages 10 and 11", pinned)
+	}
+	if len(unpinned) != 2 || unpinned[0].body["message_id"] != 10.0 || unpinned[1].body["message_id"] != 11.0 {
+		t.Errorf("unpinned %v, want messages 10 and 11", unpinned)
+	}
+	for _, call := range append(pinned, unpinned...) {
+		if call.body["chat_id"] != "5" {
+			t.Errorf("%s in chat %v, want the alert's chat 5", call.method, call.body["chat_id"])
+		}
+	}
+	if state, _ := store.get("7"); state.PinnedMessageID != 0 {
+		t.Errorf("pinned message %d remembered after recovery", state.PinnedMessageID)
+	}
+}
+
+func TestPinTrackerWithoutRights(t *testing.T) {
+	fake := newFakeTelegram(t)
+	fake.respond = func(call telegramCall) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"description":"Bad Request: not enough rights to manage pinned messages in the chat"}`
+	}
+	states := newMonitorStates(newMemoryStateStore())
+	pins := newPinTracker(newTelegramNotifier(testConfig(fake)), states)
+
+	pins.observe(context.Background(), delivery{monitorID: "7", status: "0"}, sentMessage{MessageID: 10})
+	// The failed pin is forgotten so the recovery doesn't try to unpin it.
+	pins.observe(context.Background(), delivery{monitorID: "7", status: "1"}, sentMessage{MessageID: 11})
+	if calls := fake.sent("unpinChatMessage"); len(calls) != 0 {
+		t.Errorf("unpinned %v after the pin failed", calls)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// parseProxyURL validates TELEGRAM_PROXY_URL. Credentials may be given in
+// the URL's user info and are left out of errors.
+func parseProxyURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("malformed URL: %w", redactError(err, value))
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("%q must be an http, https or socks5 URL", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q has no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// loadCAFile returns the system roots extended with the PEM certificates in
+// path.
+func loadCAFile(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// telegramTransport returns the transport for Telegram requests: the default
+// one, which honours HTTP_PROXY and HTTPS_PROXY, unless TELEGRAM_PROXY_URL or
+// TELEGRAM_CA_FILE is set.
+func telegramTransport(cfg config) http.RoundTripper {
+	if cfg.telegramProxyURL == nil && cfg.telegramCAs == nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.telegramProxyURL != nil {
+		transport.Proxy = http.ProxyURL(cfg.telegramProxyURL)
+	}
+	if cfg.telegramCAs != nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: cfg.telegramCAs}
+	}
+	return transport
+}
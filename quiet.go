@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDigestEvents bounds the number of lines in a quiet hours digest so it
+// stays within Telegram's message size limit.
+const maxDigestEvents = 50
+
+// quietHours is a daily window, possibly spanning midnight, in which alerts
+// are held back and later sent as one digest.
+type quietHours struct {
+	start, end   time.Duration // offsets from midnight
+	location     *time.Location
+	breakthrough []string // monitor name patterns that are never held back
+}
+
+// parseQuietHours parses a QUIET_HOURS value such as "23:00-07:00".
+func parseQuietHours(value string, location *time.Location) (*quietHours, error) {
+	startStr, endStr, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("%q must look like 23:00-07:00", value)
+	}
+	start, err := parseClock(startStr)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(endStr)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("%q: start and end must differ", value)
+	}
+	return &quietHours{start: start, end: end, location: location}, nil
+}
+
+// parseClock parses "HH:MM" into an offset from midnight.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: must be HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// active reports whether now falls within the quiet window.
+func (q *quietHours) active(now time.Time) bool {
+	offset := sinceMidnight(now.In(q.location))
+	if q.start < q.end {
+		return offset >= q.start && offset < q.end
+	}
+	return offset >= q.start || offset < q.end
+}
+
+// nextEnd returns the first end of the quiet window after now.
+func (q *quietHours) nextEnd(now time.Time) time.Time {
+	local := now.In(q.location)
+	year, month, day := local.Date()
+	end := time.Date(year, month, day, 0, 0, 0, 0, q.location).Add(q.end)
+	if !end.After(local) {
+		end = time.Date(year, month, day+1, 0, 0, 0, 0, q.location).Add(q.end)
+	}
+	return end
+}
+
+// breaksThrough reports whether alerts of monitorName bypass quiet hours.
+func (q *quietHours) breaksThrough(monitorName string) bool {
+	for _, pattern := range q.breakthrough {
+		if matched, _ := path.Match(pattern, monitorName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// quietEvent is an alert held back during quiet hours.
+type quietEvent struct {
+	monitorID   string
+	monitorName string
+	status      string
+	at          time.Time
+}
+
+// quietBuffer collects events during quiet hours and passes them to onEnd
+// once the window is over.
+type quietBuffer struct {
+	hours *quietHours
+	onEnd func([]quietEvent)
+
+	mu     sync.Mutex
+	events []quietEvent
+	timer  *time.Timer
+}
+
+func newQuietBuffer(hours *quietHours, onEnd func([]quietEvent)) *quietBuffer {
+	return &quietBuffer{hours: hours, onEnd: onEnd}
+}
+
+// hold buffers the payload's event if quiet hours are active and reports
+// whether it did.
+func (b *quietBuffer) hold(payload kumaPayload, monitorName string, now time.Time) bool {
+	if !b.hours.active(now) || b.hours.breaksThrough(monitorName) {
+		return false
+	}
+
+	event := quietEvent{
+		monitorID:   payload.monitorKey(),
+		monitorName: monitorName,
+		status:      payload.statusCode(),
+		at:          now,
+	}
+	if heartbeatTime, ok := parseHeartbeatTime(string(payload.heartbeat().Time)); ok {
+		event.at = heartbeatTime
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, event)
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.hours.nextEnd(now).Sub(now), b.flush)
+	}
+	return true
+}
+
+// flush hands the buffered events to onEnd. It is called when the window
+// ends and on shutdown.
+func (b *quietBuffer) flush() {
+	b.mu.Lock()
+	events := b.events
+	b.events = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(events) > 0 {
+		b.onEnd(events)
+	}
+}
+
+// buildQuietDigest renders the events held back during quiet hours, one line
+// per event. A DOWN followed by an UP of the same monitor is collapsed into a
+// single "was down for" line.
+func buildQuietDigest(events []quietEvent, f formatter, l messageLabels, location *time.Location) string {
+	type digestLine struct {
+		event     quietEvent
+		recovered time.Duration // set when the DOWN was followed by an UP
+	}
+
+	var lines []digestLine
+	pendingDown := map[string]int{} // monitor key -> index of its open DOWN line
+	for _, event := range events {
+		key := event.monitorID
+		if key == "" {
+			key = event.monitorName
+		}
+		if index, ok := pendingDown[key]; ok && event.status == "1" {
+			lines[index].recovered = max(event.at.Sub(lines[index].event.at), time.Second)
+			delete(pendingDown, key)
+			continue
+		}
+		if event.status == "0" {
+			pendingDown[key] = len(lines)
+		}
+		lines = append(lines, digestLine{event: event})
+	}
+
+	var builder strings.Builder
+	builder.WriteString("🌙 " + f.bold(fmt.Sprintf(l.quietDigestTitle, len(events))) + "\n")
+	for i, line := range lines {
+		if i == maxDigestEvents {
+			builder.WriteString("\n" + f.escape(fmt.Sprintf(l.moreEvents, len(lines)-i)))
+			break
+		}
+		at := line.event.at.In(location).Format("15:04")
+		name := line.event.monitorName
+		if name == "" {
+			name = line.event.monitorID
+		}
+		builder.WriteByte('\n')
+		if line.recovered > 0 {
+			builder.WriteString("🔁 " + f.code(name) + " " + f.escape(fmt.Sprintf(l.wasDownFor, formatDuration(line.recovered.Round(time.Second)))+" ("+at+")"))
+			continue
+		}
+		emoji, status := statusLabel(line.event.status, l)
+		builder.WriteString(emoji + " " + f.code(name) + " " + f.escape(status+" ("+at+")"))
+	}
+	return builder.String()
+}
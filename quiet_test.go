@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	for _, value := range []string{"23:00-07:00", "09:30 - 18:00", "00:00-23:59"} {
+		if _, err := parseQuietHours(value, time.UTC); err != nil {
+			t.Errorf("parseQuietHours(%q): %v", value, err)
+		}
+	}
+	for _, value := range []string{"23:00", "25:00-07:00", "7-8", "07:00-07:00"} {
+		if _, err := parseQuietHours(value, time.UTC); err == nil {
+			t.Errorf("parseQuietHours(%q) succeeded", value)
+		}
+	}
+}
+
+func TestQuietHoursWindow(t *testing.T) {
+	q, err := parseQuietHours("23:00-07:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hours past 24 fall on the next day.
+	day := func(hour, minute int) time.Time { return time.Date(2024, 5, 1, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		now     time.Time
+		active  bool
+		nextEnd time.Time
+	}{
+		{now: day(22, 59), active: false, nextEnd: day(24+7, 0)},
+		{now: day(23, 0), active: true, nextEnd: day(24+7, 0)},
+		{now: day(3, 0), active: true, nextEnd: day(7, 0)},
+		{now: day(7, 0), active: false, nextEnd: day(24+7, 0)},
+	}
+	for _, tt := range tests {
+		if got := q.active(tt.now); got != tt.active {
+			t.Errorf("active at %s = %v, want %v", tt.now.Format("15:04"), got, tt.active)
+		}
+		if got := q.nextEnd(tt.now); !got.Equal(tt.nextEnd) {
+			t.Errorf("nextEnd at %s = %s, want %s", tt.now.Format("15:04"), got, tt.nextEnd)
+		}
+	}
+}
+
+func TestQuietBuffer(t *testing.T) {
+	q, err := parseQuietHours("23:00-07:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.breakthrough = []string{"core-*"}
+	var digests [][]quietEvent
+	b := newQuietBuffer(q, func(events []quietEvent) { digests = append(digests, events) })
+	night := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+
+	if !b.hold(testPayload(t, testDown), "db", night) {
+		t.Error("an alert during quiet hours was not held")
+	}
+	if b.hold(testPayload(t, `{"monitor":{"name":"core-api"},"heartbeat":{"status":0}}`), "core-api", night) {
+		t.Error("a breakthrough monitor was held")
+	}
+	if b.hold(testPayload(t, testDown), "db", night.Add(12*time.Hour)) {
+		t.Error("an alert outside quiet hours was held")
+	}
+
+	b.flush()
+	if len(digests) != 1 || len(digests[0]) != 1 || digests[0][0].monitorName != "db" {
+		t.Fatalf("digests = %+v, want one with the held DOWN", digests)
+	}
+	// The DOWN's heartbeat time is used rather than when it arrived.
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC); !digests[0][0].at.Equal(want) {
+		t.Errorf("event time %s, want the heartbeat's %s", digests[0][0].at, want)
+	}
+	b.flush()
+	if len(digests) != 1 {
+		t.Error("an empty buffer sent a digest")
+	}
+}
+
+func TestBuildQuietDigest(t *testing.T) {
+	night := time.Date(2024, 5, 1, 23, 10, 0, 0, time.UTC)
+	events := []quietEvent{
+		{monitorID: "1", monitorName: "db", status: "0", at: night},
+		{monitorID: "2", monitorName: "api", status: "0", at: night.Add(5 * time.Minute)},
+		{monitorID: "1", monitorName: "db", status: "1", at: night.Add(12 * time.Minute)},
+	}
+	got := buildQuietDigest(events, formatter{}, messageLanguages["en"], time.UTC)
+	want := "🌙 3 notifications during quiet hours\n" +
+		"\n🔁 db was down for 12m, recovered (23:10)" +
+		"\n❌ api DOWN (23:15)"
+	if got != want {
+		t.Errorf("digest:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestQuietHoursWebhook(t *testing.T) {
+	// A window around the current time, so quiet hours are in effect.
+	now := time.Now().UTC()
+	window := now.Add(-time.Hour).Format("15:04") + "-" + now.Add(time.Hour).Format("15:04")
+	s := newWebhookServer(t, map[string]string{"QUIET_HOURS": window, "QUIET_HOURS_TZ": "UTC"})
+	var digests [][]quietEvent
+	s.quiet = newQuietBuffer(s.cfg.quietHours, func(events []quietEvent) { digests = append(digests, events) })
+
+	rec := s.post(testDown)
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"quiet":true`) || len(s.notifier.jobs) != 0 {
+		t.Errorf("DOWN during quiet hours: %d %s with %d messages sent; want it held", rec.Code, rec.Body, len(s.notifier.jobs))
+	}
+	if rec := s.post(`{"msg":"Testing Telegram notification"}`); rec.Code != http.StatusAccepted || len(s.notifier.jobs) != 1 {
+		t.Errorf("test notification during quiet hours: %d with %d messages sent; want it delivered", rec.Code, len(s.notifier.jobs))
+	}
+	s.quiet.flush()
+	if len(digests) != 1 || len(digests[0]) != 1 {
+		t.Errorf("digests = %+v, want the held DOWN", digests)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiter is a token bucket limiter keyed by client (or a single global
+// key). Each bucket refills at rate tokens per second up to burst.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// currentLimiter returns the limiter for the rate configured in cfg, nil
+// when requests aren't limited. The limiter in current is replaced by a new
+// one when a reload changed the rate; its clients start with full buckets.
+func currentLimiter(current *atomic.Pointer[rateLimiter], cfg config) *rateLimiter {
+	if cfg.rateLimitRPS <= 0 {
+		return nil
+	}
+	limiter := current.Load()
+	if limiter != nil && limiter.rate == cfg.rateLimitRPS && limiter.burst == float64(cfg.rateLimitBurst) {
+		return limiter
+	}
+	next := newRateLimiter(cfg.rateLimitRPS, cfg.rateLimitBurst)
+	if !current.CompareAndSwap(limiter, next) {
+		return current.Load()
+	}
+	return next
+}
+
+// allow takes a token from key's bucket. When none is left it reports how
+// long until the next token is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune drops buckets that have refilled completely, at most once a minute,
+// so memory does not grow with every client ever seen.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// writeRateLimited rejects a request with 429 and a Retry-After header in
+// whole seconds.
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
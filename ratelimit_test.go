@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("request past the burst: allowed %v, wait %s; want refused, 500ms", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another client shared the exhausted bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("no token after refilling for 500ms at 2/s")
+	}
+	if ok, _ := l.allow("a", now.Add(500*time.Millisecond)); ok {
+		t.Error("more than one token refilled in 500ms")
+	}
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	const body = `{"monitor":{"name":"db"},"heartbeat":{"status":0},"msg":"down"}`
+	s := newWebhookServer(t, map[string]string{"RATE_LIMIT_RPS": "1", "RATE_LIMIT_BURST": "2", "TRUSTED_PROXY_CIDRS": "10.0.0.0/8"})
+	post := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return s.serve(req)
+	}
+
+	for i := range 2 {
+		if rec := post("192.0.2.1:1234", ""); rec.Code != http.StatusAccepted {
+			t.Fatalf("request %d: status %d, want 202", i+1, rec.Code)
+		}
+	}
+	rec := post("192.0.2.1:1234", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("request past the burst: status %d, Retry-After %q; want 429, 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// X-Forwarded-For is ignored from clients that aren't trusted proxies,
+	// so it can't be used to get a fresh bucket.
+	if rec := post("192.0.2.1:1234", "198.51.100.7"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For: status %d, want 429", rec.Code)
+	}
+	if rec := post("192.0.2.2:1234", ""); rec.Code != http.StatusAccepted {
+		t.Errorf("another client: status %d, want 202", rec.Code)
+	}
+	// Behind a trusted proxy each forwarded client has its own bucket.
+	for _, client := range []string{"198.51.100.7", "198.51.100.8"} {
+		if rec := post("10.0.0.1:1234", client); rec.Code != http.StatusAccepted {
+			t.Errorf("client %s behind the proxy: status %d, want 202", client, rec.Code)
+		}
+	}
+	if len(s.notifier.jobs) != 5 {
+		t.Errorf("%d messages sent, want 5", len(s.notifier.jobs))
+	}
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantRate  float64
+		wantBurst int
+		wantErr   bool
+	}{
+		{name: "off by default", env: nil},
+		{name: "per minute", env: map[string]string{"RATE_LIMIT_PER_MINUTE": "30"}, wantRate: 0.5, wantBurst: 1},
+		{name: "per second with burst", env: map[string]string{"RATE_LIMIT_RPS": "2.5", "RATE_LIMIT_BURST": "10"}, wantRate: 2.5, wantBurst: 10},
+		{name: "both", env: map[string]string{"RATE_LIMIT_RPS": "1", "RATE_LIMIT_PER_MINUTE": "60"}, wantErr: true},
+		{name: "zero", env: map[string]string{"RATE_LIMIT_PER_MINUTE": "0"}, wantErr: true},
+		{name: "bad scope", env: map[string]string{"RATE_LIMIT_PER_MINUTE": "10", "RATE_LIMIT_SCOPE": "user"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(testSettings(tt.env))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (cfg.rateLimitRPS != tt.wantRate || tt.wantRate > 0 && cfg.rateLimitBurst != tt.wantBurst) {
+				t.Errorf("rate %v burst %d, want %v and %d", cfg.rateLimitRPS, cfg.rateLimitBurst, tt.wantRate, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestCurrentLimiter(t *testing.T) {
+	var limiters atomic.Pointer[rateLimiter]
+	cfg := config{rateLimitRPS: 1, rateLimitBurst: 2}
+	first := currentLimiter(&limiters, cfg)
+	if first == nil || currentLimiter(&limiters, cfg) != first {
+		t.Fatal("an unchanged configuration did not keep its limiter")
+	}
+	cfg.rateLimitBurst = 5
+	if next := currentLimiter(&limiters, cfg); next == first || next.burst != 5 {
+		t.Errorf("limiter = %+v, want a new one with burst 5", next)
+	}
+	cfg.rateLimitRPS = 0
+	if currentLimiter(&limiters, cfg) != nil {
+		t.Error("rate limiting was not turned off")
+	}
+}
+
+func TestGlobalRateLimitCountsUnauthorized(t *testing.T) {
+	s := newWebhookServer(t, map[string]string{"RATE_LIMIT_PER_MINUTE": "1", "RATE_LIMIT_BURST": "2", "RATE_LIMIT_SCOPE": "global"})
+	send := func(remoteAddr, token string) int {
+		req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(`{"msg":"hi"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = remoteAddr
+		return s.serve(req).Code
+	}
+
+	// Guessing tokens uses up the budget like any other request.
+	if code := send("192.0.2.1:1234", "guess"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status %d, want 401", code)
+	}
+	if code := send("192.0.2.2:1234", testWebhookToken); code != http.StatusAccepted {
+		t.Fatalf("second request: status %d, want 202", code)
+	}
+	if code := send("192.0.2.3:1234", testWebhookToken); code != http.StatusTooManyRequests {
+		t.Errorf("third request from a new client: status %d, want 429 from the shared bucket", code)
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	l := newRateLimiter(1, 5)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.allow("idle", now)
+	l.allow("busy", now.Add(55*time.Second))
+	l.allow("new", now.Add(time.Minute))
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("a bucket that had refilled was kept")
+	}
+	if len(l.buckets) != 2 {
+		t.Errorf("%d buckets, want busy and new", len(l.buckets))
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	l := newRateLimiter(0.001, 50)
+	now := time.Now()
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := l.allow(fmt.Sprint(i%2), now); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 100 {
+		t.Errorf("%d requests allowed, want the burst of 50 for each of 2 clients", got)
+	}
+}
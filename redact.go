@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// redactTelegramURL masks the bot token in text, which is typically a Bot API
+// URL such as https://api.telegram.org/bot<token>/sendMessage or an error
+// message that embeds one.
+func redactTelegramURL(text, botToken string) string {
+	if botToken == "" {
+		return text
+	}
+	text = strings.ReplaceAll(text, "bot"+botToken, "bot***")
+	return strings.ReplaceAll(text, botToken, "***")
+}
+
+// redactedError hides the bot token from an error's message while keeping the
+// original error available to errors.Is and errors.As.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError returns err with any occurrence of botToken masked.
+func redactError(err error, botToken string) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	redacted := redactTelegramURL(msg, botToken)
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{err: err, msg: redacted}
+}
+
+// configSecrets returns the configured credentials that must not be logged.
+func configSecrets(cfg config) []string {
+	secrets := []string{cfg.telegramBotToken, cfg.webhookToken, cfg.webhookHMACKey}
+	for _, token := range cfg.webhookTokens {
+		secrets = append(secrets, token.token)
+	}
+	return secrets
+}
+
+// redactSecrets masks every secret in text. Secrets shorter than
+// minRedactedSecret are left alone, since masking them would garble
+// unrelated words.
+func redactSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) >= minRedactedSecret {
+			text = redactTelegramURL(text, secret)
+		}
+	}
+	return text
+}
+
+const minRedactedSecret = 8
+
+// redactingWriter masks secrets in everything written to the log, as a last
+// line of defence for errors and values that embed a token.
+type redactingWriter struct {
+	w       io.Writer
+	secrets func() []string
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p), r.secrets())); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs sends the default logger's output from level up to the
+// returned buffer until the test ends.
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &logs
+}
+
+func TestRedactTelegramURL(t *testing.T) {
+	const token = "123456:secret-token"
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "https://api.telegram.org/bot" + token + "/sendMessage", want: "https://api.telegram.org/bot***/sendMessage"},
+		{text: `Post "https://api.telegram.org/bot` + token + `/getMe": EOF`, want: `Post "https://api.telegram.org/bot***/getMe": EOF`},
+		{text: "token " + token + " rejected", want: "token *** rejected"},
+		{text: "nothing to hide", want: "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := redactTelegramURL(tt.text, token); got != tt.want {
+			t.Errorf("redactTelegramURL(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got := redactTelegramURL("bot/sendMessage", ""); got != "bot/sendMessage" {
+		t.Errorf("an empty token changed the text to %q", got)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	cfg := config{
+		telegramBotToken: testBotToken,
+		webhookToken:     testWebhookToken,
+		webhookHMACKey:   "short",
+		webhookTokens:    []webhookToken{{token: "team-a-secret-token", chatID: "-100"}},
+	}
+	text := "POST /bot" + testBotToken + "/sendMessage with " + testWebhookToken + " and team-a-secret-token, key short"
+	want := "POST /bot***/sendMessage with *** and ***, key short"
+	if got := redactSecrets(text, configSecrets(cfg)); got != want {
+		t.Errorf("redactSecrets = %q, want %q", got, want)
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var out bytes.Buffer
+	secret := "first-secret"
+	w := &redactingWriter{w: &out, secrets: func() []string { return []string{secret} }}
+	line := "token=first-secret\n"
+	if n, err := w.Write([]byte(line)); err != nil || n != len(line) {
+		t.Fatalf("Write = %d, %v; want %d, nil", n, err, len(line))
+	}
+	// The secrets are looked up on every write, so a reloaded token is
+	// masked too.
+	secret = "second-secret"
+	_, _ = w.Write([]byte("token=second-secret first-secret\n"))
+	if got := out.String(); got != "token=***\ntoken=*** first-secret\n" {
+		t.Errorf("written %q", got)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	err := redactError(fmt.Errorf("post /bot%s/getMe: %w", testBotToken, context.DeadlineExceeded), testBotToken)
+	if strings.Contains(err.Error(), testBotToken) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("redactError = %v, want the token masked and the cause kept", err)
+	}
+	plain := errors.New("no token here")
+	if redactError(plain, testBotToken) != plain {
+		t.Error("an error without the token was wrapped")
+	}
+}
+
+func TestLogRawPayload(t *testing.T) {
+	const body = `{"monitor":{"name":"db","hostname":"db01.internal.corp"},"heartbeat":{"status":0},"msg":"down"}`
+	for _, enabled := range []bool{false, true} {
+		logs := captureLogs(t, slog.LevelInfo)
+		s := newWebhookServer(t, map[string]string{"LOG_RAW_PAYLOAD": fmt.Sprint(enabled)})
+		s.post(body)
+		if logged := strings.Contains(logs.String(), "db01.internal.corp"); logged != enabled {
+			t.Errorf("LOG_RAW_PAYLOAD=%v: payload logged = %v\n%s", enabled, logged, logs)
+		}
+	}
+}
+
+func TestBotTokenNeverLogged(t *testing.T) {
+	logs := captureLogs(t, slog.LevelDebug)
+
+	fake := newFakeTelegram(t)
+	d := &dispatcher{notifiers: []notifier{newTelegramNotifier(testConfig(fake))}, requestTimeout: time.Second}
+	if _, err := d.deliver(context.Background(), delivery{message: outgoingMessage{text: "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A server that is gone makes the HTTP client fail with an error that
+	// names the URL.
+	gone := httptest.NewServer(nil)
+	gone.Close()
+	cfg := testConfig(fake)
+	cfg.telegramBaseURL = gone.URL
+	d.notifiers = []notifier{newTelegramNotifier(cfg)}
+	_, err := d.deliver(context.Background(), delivery{message: outgoingMessage{text: "hi"}})
+	if err == nil {
+		t.Fatal("send to a closed server succeeded")
+	}
+
+	if strings.Contains(err.Error(), testBotToken) || !strings.Contains(err.Error(), "/bot***/sendMessage") {
+		t.Errorf("error = %v, want the URL with the bot token masked", err)
+	}
+	if strings.Contains(logs.String(), testBotToken) {
+		t.Errorf("logs reveal the bot token:\n%s", logs)
+	}
+	if !strings.Contains(logs.String(), "endpoint="+fake.URL+"/bot***/sendMessage") {
+		t.Errorf("logs do not show the redacted endpoint:\n%s", logs)
+	}
+}
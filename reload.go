@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// withReloadable returns cfg with the fields controlled by reloadableSettings
+// taken from next.
+func (cfg config) withReloadable(next config) config {
+	cfg.webhookToken = next.webhookToken
+	cfg.webhookTokens = next.webhookTokens
+	cfg.authMode = next.authMode
+	cfg.authAllowHeader = next.authAllowHeader
+	cfg.authAllowQuery = next.authAllowQuery
+	cfg.webhookHMACKey = next.webhookHMACKey
+	cfg.telegramBotToken = next.telegramBotToken
+	cfg.telegramBaseURL = next.telegramBaseURL
+	cfg.telegramChatID = next.telegramChatID
+	cfg.telegramThreadID = next.telegramThreadID
+	cfg.telegramProxyURL = next.telegramProxyURL
+	cfg.telegramCAs = next.telegramCAs
+	cfg.telegramWebhookSecret = next.telegramWebhookSecret
+	cfg.parseMode = next.parseMode
+	cfg.linkPreview = next.linkPreview
+	cfg.rateLimitRPS = next.rateLimitRPS
+	cfg.rateLimitBurst = next.rateLimitBurst
+	cfg.rateLimitGlobal = next.rateLimitGlobal
+	cfg.routingRules = next.routingRules
+	cfg.uptimeKumaURL = next.uptimeKumaURL
+	cfg.logURLTemplate = next.logURLTemplate
+	cfg.logRawPayload = next.logRawPayload
+	cfg.verboseTest = next.verboseTest
+	cfg.importantOnly = next.importantOnly
+	cfg.suppressOrphanRecovery = next.suppressOrphanRecovery
+	cfg.suppressRepeatRecovery = next.suppressRepeatRecovery
+	cfg.compactDataMaxInline = next.compactDataMaxInline
+	cfg.ackMuteTimeout = next.ackMuteTimeout
+	cfg.strictPayload = next.strictPayload
+	cfg.maxPayloadBytes = next.maxPayloadBytes
+	cfg.displayLocation = next.displayLocation
+	cfg.timeFormat = next.timeFormat
+	cfg.showPortForHTTP = next.showPortForHTTP
+	cfg.terseWhenMinimal = next.terseWhenMinimal
+	cfg.defaultMonitorName = next.defaultMonitorName
+	cfg.showRelativeTime = next.showRelativeTime
+	cfg.showUnmeasuredPing = next.showUnmeasuredPing
+	cfg.trustedProxies = next.trustedProxies
+	cfg.allowedSources = next.allowedSources
+	cfg.messageLabels = next.messageLabels
+	cfg.messageTemplate = next.messageTemplate
+	return cfg
+}
+
+// telegramNotifier sends through the current Telegram client. A reload
+// swaps in a client built from the new configuration; sends already under
+// way finish with the client they started with.
+type telegramNotifier struct {
+	current atomic.Pointer[telegramClient]
+}
+
+func newTelegramNotifier(cfg config) *telegramNotifier {
+	t := &telegramNotifier{}
+	t.current.Store(newTelegramClient(cfg))
+	return t
+}
+
+// client returns the current client.
+func (t *telegramNotifier) client() *telegramClient {
+	return t.current.Load()
+}
+
+func (t *telegramNotifier) name() string { return notifierTelegram }
+
+func (t *telegramNotifier) send(ctx context.Context, job delivery) (sentMessage, error) {
+	return t.client().send(ctx, job)
+}
+
+// reload replaces the client with one built from cfg. The per-chat send
+// order and the MAX_TELEGRAM_CONCURRENCY cap carry over to the new client.
+// With verify set the new client must pass getMe first; otherwise the
+// current client is kept and the error returned.
+func (t *telegramNotifier) reload(cfg config, verify bool) error {
+	current := t.client()
+	next := newTelegramClient(cfg)
+	next.chatLocks, next.inflight = current.chatLocks, current.inflight
+	if verify {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.requestTimeout)
+		defer cancel()
+		if _, err := next.getMe(ctx); err != nil {
+			return fmt.Errorf("new Telegram settings rejected: %w", err)
+		}
+	}
+	t.current.Store(next)
+	return nil
+}
+
+// telegramConnectionSettings select the Telegram client's token and
+// endpoint. When one of them changes on reload the new client is verified
+// before it takes over, so a mistyped token does not stop alerts.
+var telegramConnectionSettings = []string{"TELEGRAM_API_BASE_URL", "TELEGRAM_BOT_TOKEN", "TELEGRAM_CA_FILE", "TELEGRAM_PROXY_URL"}
+
+// configReloader re-reads the configuration on SIGHUP and swaps it into live
+// and, with a new client, into telegram.
+type configReloader struct {
+	live     *atomic.Pointer[config]
+	telegram *telegramNotifier
+	// environ returns the process environment; .env, the command line and
+	// CONFIG_FILE complete it without changing it, so settings removed
+	// from those revert to their defaults.
+	environ func() []string
+
+	mu        sync.Mutex
+	lastState reloadStatus
+}
+
+func newConfigReloader(live *atomic.Pointer[config], telegram *telegramNotifier) *configReloader {
+	return &configReloader{live: live, telegram: telegram, environ: os.Environ, lastState: reloadStatus{loadedAt: time.Now()}}
+}
+
+// reloadStatus is what /status reports about reloading.
+type reloadStatus struct {
+	// loadedAt is when the configuration in use was loaded.
+	loadedAt time.Time
+	// lastAttempt is when a reload was last tried, zero if never, and
+	// lastErr why it failed, nil when it succeeded.
+	lastAttempt time.Time
+	lastErr     error
+}
+
+func (r *configReloader) status() reloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastState
+}
+
+// reload loads the configuration again from the environment, .env, the
+// command line and CONFIG_FILE. On success the reloadable settings are
+// swapped in and the changes are logged; otherwise the current
+// configuration, Telegram client included, is kept. Either way the outcome
+// is recorded for /status.
+func (r *configReloader) reload() error {
+	err := r.swap()
+	now := time.Now()
+	r.mu.Lock()
+	r.lastState.lastAttempt, r.lastState.lastErr = now, err
+	if err == nil {
+		r.lastState.loadedAt = now
+	}
+	r.mu.Unlock()
+	return err
+}
+
+func (r *configReloader) swap() error {
+	next, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	current := r.live.Load()
+	var changed, restart []string
+	for name := range configSettings {
+		if next.settings[name] == current.settings[name] {
+			continue
+		}
+		if reloadableSettings[name] {
+			changed = append(changed, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	slices.Sort(changed)
+	slices.Sort(restart)
+
+	updated := current.withReloadable(next)
+	// The settings that only apply after a restart are kept as they were
+	// loaded, so they are reported again on the next reload until then.
+	updated.settings = maps.Clone(next.settings)
+	for _, name := range restart {
+		if value, ok := current.settings[name]; ok {
+			updated.settings[name] = value
+		} else {
+			delete(updated.settings, name)
+		}
+	}
+	if r.telegram != nil {
+		verify := slices.Contains(current.notifiers, notifierTelegram) && slices.ContainsFunc(changed, func(name string) bool {
+			return slices.Contains(telegramConnectionSettings, name)
+		})
+		if err := r.telegram.reload(updated, verify); err != nil {
+			return err
+		}
+	}
+	r.live.Store(&updated)
+
+	// Values are left out since several settings are secrets.
+	if len(changed) == 0 {
+		slog.Info("reloaded configuration, no reloadable settings changed", "routing_rules_before", len(current.routingRules), "routing_rules", len(updated.routingRules))
+	} else {
+		slog.Info("reloaded configuration", "changed", strings.Join(changed, ", "), "routing_rules_before", len(current.routingRules), "routing_rules", len(updated.routingRules))
+	}
+	if len(restart) > 0 {
+		slog.Warn("settings changed that only apply after a restart", "settings", strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+func (r *configReloader) load() (config, error) {
+	env := environSettings(r.environ())
+	if err := env.loadDotEnv(".env"); err != nil {
+		slog.Warn("failed to load .env", "error", err)
+	}
+	applyEnvFlags(flag.CommandLine, env)
+	return loadConfig(env)
+}
+
+// watchSIGHUP reloads the configuration whenever the process receives SIGHUP.
+func (r *configReloader) watchSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := r.reload(); err != nil {
+				slog.Error("failed to reload configuration, keeping the current one", "error", err)
+			}
+		}
+	}()
+}
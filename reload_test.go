@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// environ renders env in the form of os.Environ.
+func environ(env settings) func() []string {
+	return func() []string {
+		var entries []string
+		for name, value := range env {
+			entries = append(entries, name+"="+value)
+		}
+		return entries
+	}
+}
+
+// startReloader loads env as the running configuration and returns a
+// reloader for it whose Telegram client talks to fake.
+func startReloader(t *testing.T, fake *fakeTelegram, env settings) *configReloader {
+	t.Helper()
+	env["TELEGRAM_API_BASE_URL"] = fake.URL
+	cfg, err := loadConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newConfigReloader(liveConfig(cfg), newTelegramNotifier(cfg))
+	r.environ = environ(env)
+	return r
+}
+
+func TestReloadSwapsTelegramClient(t *testing.T) {
+	fake := newFakeTelegram(t)
+	r := startReloader(t, fake, testSettings(nil))
+	before := r.telegram.client()
+
+	next := testSettings(map[string]string{"TELEGRAM_CHAT_ID": "2", "TELEGRAM_PARSE_MODE": "HTML", "TELEGRAM_API_BASE_URL": fake.URL})
+	r.environ = environ(next)
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := r.telegram.client()
+	if client == before || client.chatID != "2" || client.parseMode != parseModeHTML {
+		t.Fatalf("client = %+v, want a new one for chat 2 in HTML", client)
+	}
+	if client.chatLocks != before.chatLocks {
+		t.Error("the chat send order was not carried over to the new client")
+	}
+	if cfg := r.live.Load(); cfg.telegramChatID != "2" || cfg.parseMode != parseModeHTML {
+		t.Errorf("live chat %s, parse mode %s; want 2, HTML", cfg.telegramChatID, cfg.parseMode)
+	}
+	if _, err := r.telegram.send(context.Background(), delivery{message: outgoingMessage{text: "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := fake.sent("sendMessage"); len(sent) != 1 || sent[0].body["chat_id"] != "2" {
+		t.Errorf("sent %v, want a message to chat 2", sent)
+	}
+}
+
+func TestReloadKeepsConfigOnError(t *testing.T) {
+	fake := newFakeTelegram(t)
+	r := startReloader(t, fake, testSettings(nil))
+	before, client := r.live.Load(), r.telegram.client()
+
+	r.environ = environ(testSettings(map[string]string{"TELEGRAM_CHAT_ID": "2", "DEDUP_WINDOW": "soon"}))
+	if err := r.reload(); err == nil {
+		t.Fatal("reload of an invalid configuration succeeded")
+	}
+	if r.live.Load() != before || r.telegram.client() != client {
+		t.Error("an invalid configuration replaced the running one")
+	}
+}
+
+func TestReloadRejectsBadBotToken(t *testing.T) {
+	fake := newFakeTelegram(t)
+	r := startReloader(t, fake, testSettings(nil))
+	before, client := r.live.Load(), r.telegram.client()
+
+	r.environ = environ(testSettings(map[string]string{"TELEGRAM_BOT_TOKEN": "123:wrong", "TELEGRAM_API_BASE_URL": fake.URL}))
+	err := r.reload()
+	if err == nil || !strings.Contains(err.Error(), "getMe") {
+		t.Fatalf("error = %v, want the failed getMe", err)
+	}
+	if r.live.Load() != before || r.telegram.client() != client {
+		t.Error("a bot token Telegram refused replaced the running one")
+	}
+	if len(fake.sent("getMe")) != 0 {
+		t.Error("getMe was answered with the old token")
+	}
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	fake := newFakeTelegram(t)
+	r := startReloader(t, fake, testSettings(nil))
+	templateFile := filepath.Join(t.TempDir(), "message.tmpl")
+	if err := os.WriteFile(templateFile, []byte("{{.MonitorName}}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r.environ = environ(testSettings(map[string]string{"TELEGRAM_CHAT_ID": "2", "MESSAGE_TEMPLATE_FILE": templateFile, "TELEGRAM_API_BASE_URL": fake.URL}))
+	r.watchSIGHUP()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); r.live.Load().telegramChatID != "2"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP did not reload the configuration")
+		}
+	}
+	if r.live.Load().messageTemplate == nil || r.telegram.client().chatID != "2" {
+		t.Error("the template or the Telegram client was not reloaded")
+	}
+}
+
+func TestReloadRestartOnlySettings(t *testing.T) {
+	fake := newFakeTelegram(t)
+	r := startReloader(t, fake, testSettings(map[string]string{"QUEUE_SIZE": "10"}))
+
+	r.environ = environ(testSettings(map[string]string{"QUEUE_SIZE": "20", "MESSAGE_TITLE": "Kuma", "TELEGRAM_API_BASE_URL": fake.URL}))
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := r.live.Load()
+	if cfg.queueSize != 10 || cfg.settings["QUEUE_SIZE"] != "10" {
+		t.Errorf("queue size %d (setting %q), want the startup value 10", cfg.queueSize, cfg.settings["QUEUE_SIZE"])
+	}
+	if cfg.settings["MESSAGE_TITLE"] != "Kuma" {
+		t.Errorf("MESSAGE_TITLE = %q, want the reloaded value", cfg.settings["MESSAGE_TITLE"])
+	}
+}
+
+func TestStatusAfterFailedReload(t *testing.T) {
+	fake := newFakeTelegram(t)
+	env := testSettings(nil)
+	r := startReloader(t, fake, env)
+	handler := statusHandler(r.live, r)
+	status := func(token string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, statusPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, body
+	}
+
+	if code, _ := status("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("status without the webhook token = %d, want 401", code)
+	}
+	if code, body := status(testWebhookToken); code != http.StatusOK || body["ok"] != true || body["last_reload"] != nil {
+		t.Errorf("status before any reload = %d %v", code, body)
+	}
+
+	r.environ = environ(testSettings(map[string]string{"TELEGRAM_BOT_TOKEN": "123:wrong", "TELEGRAM_API_BASE_URL": fake.URL}))
+	if err := r.reload(); err == nil {
+		t.Fatal("reload with a refused bot token succeeded")
+	}
+	_, body := status(testWebhookToken)
+	lastReload, _ := body["last_reload"].(map[string]any)
+	if body["ok"] != false || lastReload["ok"] != false || !strings.Contains(fmt.Sprint(lastReload["error"]), "getMe") {
+		t.Errorf("status after a failed reload = %v, want the getMe error", body)
+	}
+	if _, err := r.telegram.send(context.Background(), delivery{message: outgoingMessage{text: "still here"}}); err != nil {
+		t.Fatalf("the previous notifier stopped working: %v", err)
+	}
+	if sent := fake.sent("sendMessage"); len(sent) != 1 || sent[0].body["chat_id"] != "1" {
+		t.Errorf("sent %v, want the alert through the previous notifier", sent)
+	}
+
+	r.environ = environ(env)
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := status(testWebhookToken); body["ok"] != true {
+		t.Errorf("status after a successful reload = %v, want ok", body)
+	}
+}
+
+func TestStatusAccess(t *testing.T) {
+	fake := newFakeTelegram(t)
+	r := startReloader(t, fake, testSettings(map[string]string{"ALLOWED_SOURCE_CIDRS": "10.0.0.0/8"}))
+	handler := statusHandler(r.live, r)
+	tests := []struct {
+		remoteAddr string
+		wantCode   int
+	}{
+		{remoteAddr: "10.1.2.3:4000", wantCode: http.StatusOK},
+		{remoteAddr: "192.0.2.1:4000", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, statusPath, nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Errorf("status from %s = %d, want %d", tt.remoteAddr, rec.Code, tt.wantCode)
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Notifiers []string `json:"notifiers"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Notifiers) != 1 || body.Notifiers[0] != notifierTelegram {
+			t.Errorf("notifiers = %v, want [telegram]", body.Notifiers)
+		}
+	}
+}
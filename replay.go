@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// replayPayload renders the payload saved in path with the configured message
+// options and writes the text to out, so templates and escaping can be
+// checked without running the server or contacting Telegram.
+func replayPayload(cfg config, path string, out io.Writer) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	payload, err := decodePayload(raw)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	text, attachment := buildTelegramMessage(payload, raw, newMessageOptions(cfg))
+	if _, err := fmt.Fprintln(out, text); err != nil {
+		return err
+	}
+	if attachment != nil {
+		_, err = fmt.Fprintf(out, "\n[attachment %s, %d bytes]\n", attachment.name, len(attachment.content))
+	}
+	return err
+}
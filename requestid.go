@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// requestIDHeader carries the ID that correlates a webhook request with its
+// log lines. An ID sent by a proxy is reused, otherwise one is generated.
+const requestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withRequestID assigns each request an ID, returned in the X-Request-ID
+// response header and available to next through requestIDFrom, and writes
+// an access log line once next has responded.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		slog.Info("request", "request_id", id, "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(), "bytes", recorder.bytes)
+	})
+}
+
+// requestIDFrom returns the ID withRequestID assigned to the request ctx
+// belongs to, or "".
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusRecorder remembers the status code and size of the response written
+// through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// requestID returns the request's X-Request-ID when it is safe to log and put
+// in a URL, or a new random ID.
+func requestID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(requestIDHeader)); validRequestID(id) {
+		return id
+	}
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expandLogURL fills the {request_id}, {monitor} and {monitor_id}
+// placeholders of LOG_URL_TEMPLATE, escaping the values for a query string.
+func expandLogURL(template, requestID, monitorName, monitorID string) string {
+	return strings.NewReplacer(
+		"{request_id}", url.QueryEscape(requestID),
+		"{monitor}", url.QueryEscape(monitorName),
+		"{monitor_id}", url.QueryEscape(monitorID),
+	).Replace(template)
+}
+
+// validateLogURLTemplate checks that template expands to an http(s) URL.
+func validateLogURLTemplate(template string) error {
+	if !strings.Contains(template, "{request_id}") {
+		return fmt.Errorf("%q must contain {request_id}", template)
+	}
+	if link := expandLogURL(template, "id", "monitor", "1"); !isLinkableURL(link) {
+		return fmt.Errorf("%q must be an http or https URL", template)
+	}
+	return nil
+}
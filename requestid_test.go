@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	tests := []struct {
+		header string
+		want   string // empty means a generated ID
+	}{
+		{header: "abc-123_x.y", want: "abc-123_x.y"},
+		{header: " trimmed ", want: "trimmed"},
+		{header: ""},
+		{header: "has space"},
+		{header: "a&b=c"},
+		{header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(requestIDHeader, tt.header)
+		got := requestID(req)
+		if tt.want != "" && got != tt.want || tt.want == "" && !generated.MatchString(got) {
+			t.Errorf("requestID with header %q = %q", tt.header, got)
+		}
+	}
+}
+
+func TestValidateLogURLTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{template: "https://logs.example.com/search?q={request_id}"},
+		{template: "https://logs.example.com/search?q={monitor}", wantErr: true},
+		{template: "ftp://logs.example.com/{request_id}", wantErr: true},
+		{template: "{request_id}", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateLogURLTemplate(tt.template); (err != nil) != tt.wantErr {
+			t.Errorf("validateLogURLTemplate(%q) = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLogURLInAlert(t *testing.T) {
+	s := newWebhookServer(t, map[string]string{
+		"LOG_URL_TEMPLATE": "https://logs.example.com/explore?q={request_id}&monitor={monitor}&id={monitor_id}",
+	})
+	req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, strings.NewReader(`{"monitor":{"id":7,"name":"db (primary)"},"heartbeat":{"status":0},"msg":"down"}`))
+	req.Header.Set("Authorization", "Bearer "+testWebhookToken)
+	req.Header.Set(requestIDHeader, "req-42")
+	rec := s.serve(req)
+	if rec.Code != http.StatusAccepted || rec.Header().Get(requestIDHeader) != "req-42" {
+		t.Fatalf("response %d with request ID %q", rec.Code, rec.Header().Get(requestIDHeader))
+	}
+
+	// In a MarkdownV2 link target only ")" and "\" are escaped.
+	want := "[" + escapeMarkdown(s.cfg.messageLabels.logs) + "](https://logs.example.com/explore?q=req-42&monitor=db+%28primary%29&id=7)"
+	if text := s.notifier.jobs[0].message.text; !strings.Contains(text, want) {
+		t.Errorf("message does not contain %s:\n%s", want, text)
+	}
+	if s.notifier.jobs[0].requestID != "req-42" {
+		t.Errorf("delivery request ID = %q, want req-42", s.notifier.jobs[0].requestID)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// routeRule sends notifications of monitors whose name matches Monitor to
+// ChatID instead of TELEGRAM_CHAT_ID, and optionally only during the
+// monitor's active hours.
+type routeRule struct {
+	// Monitor is a glob pattern (path.Match syntax) matched against
+	// monitor.name, e.g. "team-a-*" for a prefix match.
+	Monitor string `json:"monitor"`
+	// ChatID may be given as a JSON number or string. It may be omitted
+	// when the rule only sets a schedule.
+	ChatID flexString `json:"chat_id,omitempty"`
+	// ThreadID optionally selects a forum topic in ChatID.
+	ThreadID int64 `json:"thread_id,omitempty"`
+	// ActiveHours such as "09:00-18:00" limits alerts to that daily window;
+	// alerts outside it are dropped.
+	ActiveHours string `json:"active_hours,omitempty"`
+	// ActiveDays limits alerts to these weekdays ("mon" ... "sun").
+	ActiveDays []string `json:"active_days,omitempty"`
+	// Timezone the schedule is evaluated in, defaulting to DISPLAY_TIMEZONE
+	// or the system zone.
+	Timezone string `json:"timezone,omitempty"`
+
+	chatID       string
+	activeWindow *quietHours
+	activeDays   map[time.Weekday]bool
+	location     *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// routingConfig is the format of the ROUTING_CONFIG_PATH file.
+type routingConfig struct {
+	Rules []routeRule `json:"rules"`
+}
+
+// loadRoutingRules reads and validates the routing rules at configPath.
+// Schedules without a timezone are evaluated in location.
+func loadRoutingRules(configPath string, location *time.Location) ([]routeRule, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read routing config %s: %w", configPath, err)
+	}
+
+	var routing routingConfig
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&routing); err != nil {
+		return nil, fmt.Errorf("parse routing config %s: %w", configPath, err)
+	}
+
+	for i := range routing.Rules {
+		if err := routing.Rules[i].validate(location); err != nil {
+			return nil, fmt.Errorf("routing rule %d: %w", i+1, err)
+		}
+	}
+	return routing.Rules, nil
+}
+
+// validate checks the rule and prepares its chat ID and schedule. Schedules
+// without a timezone are evaluated in location.
+func (rule *routeRule) validate(location *time.Location) error {
+	if rule.Monitor == "" {
+		return errors.New("monitor pattern is required")
+	}
+	if _, err := path.Match(rule.Monitor, ""); err != nil {
+		return fmt.Errorf("invalid monitor pattern %q: %w", rule.Monitor, err)
+	}
+	rule.chatID = string(rule.ChatID)
+	scheduled := rule.ActiveHours != "" || len(rule.ActiveDays) > 0
+	if rule.chatID == "" && !scheduled {
+		return errors.New("chat_id or a schedule is required")
+	}
+	if rule.ThreadID < 0 {
+		return errors.New("thread_id must be a positive integer")
+	}
+
+	var err error
+	rule.location = location
+	if rule.Timezone != "" {
+		rule.location, err = time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	if rule.ActiveHours != "" {
+		rule.activeWindow, err = parseQuietHours(rule.ActiveHours, rule.location)
+		if err != nil {
+			return fmt.Errorf("invalid active_hours: %w", err)
+		}
+	}
+	for _, day := range rule.ActiveDays {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+		if !ok {
+			return fmt.Errorf("invalid active_days entry %q: must be mon, tue, ... sun", day)
+		}
+		if rule.activeDays == nil {
+			rule.activeDays = make(map[time.Weekday]bool)
+		}
+		rule.activeDays[weekday] = true
+	}
+	return nil
+}
+
+// active reports whether the rule's schedule allows alerts at now. Rules
+// without a schedule are always active.
+func (r routeRule) active(now time.Time) bool {
+	if r.activeDays != nil && !r.activeDays[now.In(r.location).Weekday()] {
+		return false
+	}
+	return r.activeWindow == nil || r.activeWindow.active(now)
+}
+
+// routeFor returns the first rule whose pattern matches monitorName. Rules are
+// evaluated in file order, so more specific patterns should come first.
+func routeFor(rules []routeRule, monitorName string) (routeRule, bool) {
+	if monitorName == "" {
+		return routeRule{}, false
+	}
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.Monitor, monitorName); matched {
+			return rule, true
+		}
+	}
+	return routeRule{}, false
+}
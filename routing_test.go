@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeRoutingConfig writes content to a routing config file and returns its
+// path.
+func writeRoutingConfig(t *testing.T, content string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "routing.json")
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestLoadRoutingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "chat", content: `{"rules":[{"monitor":"team-a-*","chat_id":-100200,"thread_id":3}]}`},
+		{name: "schedule only", content: `{"rules":[{"monitor":"intranet","active_hours":"09:00-18:00","active_days":["Mon","fri"],"timezone":"Asia/Shanghai"}]}`},
+		{name: "no chat or schedule", content: `{"rules":[{"monitor":"db"}]}`, wantErr: true},
+		{name: "no pattern", content: `{"rules":[{"chat_id":"1"}]}`, wantErr: true},
+		{name: "bad pattern", content: `{"rules":[{"monitor":"[","chat_id":"1"}]}`, wantErr: true},
+		{name: "bad hours", content: `{"rules":[{"monitor":"db","active_hours":"9-18"}]}`, wantErr: true},
+		{name: "bad day", content: `{"rules":[{"monitor":"db","active_days":["monday"]}]}`, wantErr: true},
+		{name: "bad timezone", content: `{"rules":[{"monitor":"db","active_hours":"09:00-18:00","timezone":"Mars/Base"}]}`, wantErr: true},
+		{name: "unknown field", content: `{"rules":[{"monitor":"db","chat":"1"}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadRoutingRules(writeRoutingConfig(t, tt.content), time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouteRuleActive(t *testing.T) {
+	rules, err := loadRoutingRules(writeRoutingConfig(t, `{"rules":[
+		{"monitor":"office-*","active_hours":"09:00-18:00","active_days":["mon","tue","wed","thu","fri"],"timezone":"Asia/Shanghai"},
+		{"monitor":"batch-*","active_hours":"22:00-06:00"}
+	]}`), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shanghai := time.FixedZone("CST", 8*60*60)
+	tests := []struct {
+		monitor string
+		now     time.Time
+		want    bool
+	}{
+		{monitor: "office-wiki", now: time.Date(2024, 6, 3, 10, 0, 0, 0, shanghai), want: true},  // Monday
+		{monitor: "office-wiki", now: time.Date(2024, 6, 3, 2, 0, 0, 0, time.UTC), want: true},   // 10:00 in Shanghai
+		{monitor: "office-wiki", now: time.Date(2024, 6, 3, 18, 0, 0, 0, shanghai), want: false}, // the end is exclusive
+		{monitor: "office-wiki", now: time.Date(2024, 6, 8, 10, 0, 0, 0, shanghai), want: false}, // Saturday
+		{monitor: "batch-etl", now: time.Date(2024, 6, 3, 23, 0, 0, 0, time.UTC), want: true},
+		{monitor: "batch-etl", now: time.Date(2024, 6, 3, 5, 59, 0, 0, time.UTC), want: true},
+		{monitor: "batch-etl", now: time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		rule, ok := routeFor(rules, tt.monitor)
+		if !ok {
+			t.Fatalf("no rule for %s", tt.monitor)
+		}
+		if got := rule.active(tt.now); got != tt.want {
+			t.Errorf("%s active at %s = %v, want %v", tt.monitor, tt.now.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+func TestScheduledMonitorWebhook(t *testing.T) {
+	// Windows around the current time: one that has begun and one that
+	// starts later.
+	now := time.Now().UTC()
+	window := func(from, to time.Duration) string {
+		return now.Add(from).Format("15:04") + "-" + now.Add(to).Format("15:04")
+	}
+	configPath := writeRoutingConfig(t, fmt.Sprintf(`{"rules":[
+		{"monitor":"open","chat_id":"5","active_hours":%q,"timezone":"UTC"},
+		{"monitor":"closed","chat_id":"5","active_hours":%q,"timezone":"UTC"}
+	]}`, window(-time.Hour, time.Hour), window(2*time.Hour, 3*time.Hour)))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "inside its hours", body: `{"monitor":{"name":"open"},"heartbeat":{"status":0},"msg":"down"}`, wantCode: http.StatusAccepted},
+		{name: "outside its hours", body: `{"monitor":{"name":"closed"},"heartbeat":{"status":0},"msg":"down"}`, wantCode: http.StatusNoContent},
+		{name: "alert mentioning a test outside its hours", body: `{"monitor":{"name":"closed"},"heartbeat":{"status":0},"msg":"latest test failed"}`, wantCode: http.StatusNoContent},
+		{name: "unscheduled monitor", body: `{"monitor":{"name":"other"},"heartbeat":{"status":0},"msg":"down"}`, wantCode: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"ROUTING_CONFIG_PATH": configPath})
+			rec := s.post(tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("response %d %s, want %d", rec.Code, rec.Body, tt.wantCode)
+			}
+			if sent := len(s.notifier.jobs) == 1; sent != (tt.wantCode == http.StatusAccepted) {
+				t.Errorf("%d messages sent for response %d", len(s.notifier.jobs), rec.Code)
+			}
+		})
+	}
+}
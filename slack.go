@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// parseModeSlack renders Slack mrkdwn. It can't be selected with
+// TELEGRAM_PARSE_MODE; messages are rendered in it for the Slack notifier.
+const parseModeSlack = "slack"
+
+// slackEscaper escapes the characters Slack treats as control sequences.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackClient posts alerts to a Slack incoming webhook.
+type slackClient struct {
+	webhookURL string
+	userAgent  string
+	httpClient *http.Client
+}
+
+// slackAPIError is a non-2xx response from the incoming webhook.
+type slackAPIError struct {
+	statusCode  int
+	description string
+}
+
+func (e *slackAPIError) Error() string {
+	return fmt.Sprintf("slack webhook returned status %d: %s", e.statusCode, e.description)
+}
+
+func (c *slackClient) name() string { return notifierSlack }
+
+// send posts the Slack rendering of job. Messages rendered without one, such
+// as those spooled before Slack was enabled, are sent as plain text.
+// Incoming webhooks post to the channel they were created for, so routing
+// rules and keyboards don't apply.
+func (c *slackClient) send(ctx context.Context, job delivery) (sentMessage, error) {
+	text := job.message.slackText
+	if text == "" {
+		text = slackEscaper.Replace(job.message.plainText)
+	}
+	if strings.TrimSpace(text) == "" {
+		return sentMessage{}, errors.New("slack message is empty")
+	}
+
+	body, err := json.Marshal(map[string]any{"text": text})
+	if err != nil {
+		return sentMessage{}, fmt.Errorf("marshal slack request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return sentMessage{}, fmt.Errorf("create slack request: %w", redactError(err, c.webhookURL))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return sentMessage{}, fmt.Errorf("slack request failed: %w", redactError(err, c.webhookURL))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return sentMessage{}, &slackAPIError{statusCode: resp.StatusCode, description: strings.TrimSpace(string(body))}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return sentMessage{}, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// spoolRecord is a delivery that failed for good, stored as one JSON file in
+// the spool directory until it can be resent.
+type spoolRecord struct {
+	CreatedAt   time.Time                `json:"created_at"`
+	ChatID      string                   `json:"chat_id,omitempty"`
+	ThreadID    int64                    `json:"thread_id,omitempty"`
+	Text        string                   `json:"text"`
+	PlainText   string                   `json:"plain_text,omitempty"`
+	SlackText   string                   `json:"slack_text,omitempty"`
+	Notifier    string                   `json:"notifier,omitempty"`
+	Keyboard    [][]inlineKeyboardButton `json:"keyboard,omitempty"`
+	Document    *spoolDocument           `json:"document,omitempty"`
+	MonitorID   string                   `json:"monitor_id,omitempty"`
+	MonitorName string                   `json:"monitor_name,omitempty"`
+	Status      string                   `json:"status,omitempty"`
+	// Raw is the webhook body, written to the dead-letter file if the
+	// message turns out to be undeliverable.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// spoolDocument is the attachment of a spooled message.
+type spoolDocument struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
+}
+
+// spool persists messages that failed with a retryable error in dir and
+// periodically resends them in the order they failed.
+type spool struct {
+	dir    string
+	maxAge time.Duration
+	send   func(context.Context, delivery) error
+	// retryable reports whether a failed resend is worth another attempt;
+	// other failures move the message to deadLetters, which may be nil.
+	retryable   func(error) bool
+	deadLetters *deadLetterWriter
+
+	seq  atomic.Uint64
+	mu   sync.Mutex // serializes retry passes
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSpool(dir string, maxAge time.Duration, send func(context.Context, delivery) error, retryable func(error) bool, deadLetters *deadLetterWriter) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool directory: %w", err)
+	}
+	return &spool{dir: dir, maxAge: maxAge, send: send, retryable: retryable, deadLetters: deadLetters}, nil
+}
+
+// write stores job for a later retry. File names start with the time so
+// sorting them replays deliveries in order.
+func (s *spool) write(job delivery) error {
+	record := spoolRecord{
+		CreatedAt:   time.Now().UTC(),
+		ChatID:      job.chatID,
+		ThreadID:    job.threadID,
+		Text:        job.message.text,
+		PlainText:   job.message.plainText,
+		SlackText:   job.message.slackText,
+		Notifier:    job.notifier,
+		Keyboard:    job.message.keyboard,
+		MonitorID:   job.monitorID,
+		MonitorName: job.monitorName,
+		Status:      job.status,
+	}
+	if doc := job.message.document; doc != nil {
+		record.Document = &spoolDocument{Name: doc.name, Content: doc.content}
+	}
+	if json.Valid(job.raw) {
+		record.Raw = job.raw
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal spool record: %w", err)
+	}
+
+	name := fmt.Sprintf("%020d-%06d.json", record.CreatedAt.UnixNano(), s.seq.Add(1)%1_000_000)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	return nil
+}
+
+// start retries the spool every interval until close is called.
+func (s *spool) start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.retry()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *spool) close() {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+}
+
+// retry resends spooled messages oldest first, deleting each one that was
+// delivered and dropping those older than maxAge. A message that fails again
+// with a retryable error stays spooled, and later messages to the same chat
+// wait for the next pass so they are not delivered ahead of it. Messages that
+// fail for good are moved to the dead-letter file.
+func (s *spool) retry() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		slog.Error("failed to read spool directory", "dir", s.dir, "error", err)
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	blocked := make(map[string]bool) // notifier and chat of messages that failed in this pass
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("failed to read spool file", "file", path, "error", err)
+			continue
+		}
+		var record spoolRecord
+		if err := json.Unmarshal(content, &record); err != nil {
+			slog.Error("dropping corrupt spool file", "file", path, "error", err)
+			os.Remove(path)
+			continue
+		}
+		if s.maxAge > 0 && time.Since(record.CreatedAt) > s.maxAge {
+			slog.Warn("dropping stale spooled message", "file", path, "monitor_name", record.MonitorName, "age", time.Since(record.CreatedAt).Round(time.Second))
+			os.Remove(path)
+			continue
+		}
+
+		destination := record.Notifier + "/" + record.ChatID
+		if blocked[destination] {
+			continue
+		}
+		job := delivery{
+			message:     outgoingMessage{text: record.Text, plainText: record.PlainText, slackText: record.SlackText, keyboard: record.Keyboard},
+			raw:         record.Raw,
+			monitorID:   record.MonitorID,
+			monitorName: record.MonitorName,
+			status:      record.Status,
+			chatID:      record.ChatID,
+			threadID:    record.ThreadID,
+			notifier:    record.Notifier,
+		}
+		if record.Document != nil {
+			job.message.document = &document{name: record.Document.Name, content: record.Document.Content}
+		}
+		if err := s.send(context.Background(), job); err != nil {
+			if s.retryable(err) {
+				blocked[destination] = true
+				continue
+			}
+			slog.Error("dropping spooled message that can't be delivered", "file", path, "monitor_name", record.MonitorName, "error", err)
+			if s.deadLetters != nil {
+				if err := s.deadLetters.write(record.Raw, err); err != nil {
+					slog.Error("failed to write dead letter", "error", err)
+				}
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Error("failed to remove delivered spool file", "file", path, "error", err)
+		}
+	}
+}
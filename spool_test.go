@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var (
+	errChatNotFound = &telegramAPIError{statusCode: http.StatusBadRequest, description: "Bad Request: chat not found"}
+	errUnavailable  = &telegramAPIError{statusCode: http.StatusServiceUnavailable, description: "Service Unavailable"}
+)
+
+// spoolFiles returns the names of the messages waiting in dir.
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestSpoolRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// jobs are spooled in order; fail maps a message text to the
+		// error its resend fails with.
+		jobs       []delivery
+		fail       map[string]error
+		wantSent   []string
+		wantLeft   int
+		wantLetter int
+	}{
+		{
+			name:     "all delivered in order",
+			jobs:     []delivery{{message: outgoingMessage{text: "a"}}, {message: outgoingMessage{text: "b"}}},
+			wantSent: []string{"a", "b"},
+		},
+		{
+			name:       "rejected message does not block later ones",
+			jobs:       []delivery{{message: outgoingMessage{text: "a"}, raw: []byte(`{"msg":"a"}`)}, {message: outgoingMessage{text: "b"}}},
+			fail:       map[string]error{"a": errChatNotFound},
+			wantSent:   []string{"b"},
+			wantLetter: 1,
+		},
+		{
+			name: "temporary failure holds back its chat only",
+			jobs: []delivery{
+				{chatID: "1", message: outgoingMessage{text: "a"}},
+				{chatID: "1", message: outgoingMessage{text: "b"}},
+				{chatID: "2", message: outgoingMessage{text: "c"}},
+			},
+			fail:     map[string]error{"a": errUnavailable},
+			wantSent: []string{"c"},
+			wantLeft: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			letters := filepath.Join(t.TempDir(), "dead.jsonl")
+			var sent []string
+			send := func(_ context.Context, job delivery) error {
+				if err := tt.fail[job.message.text]; err != nil {
+					return err
+				}
+				sent = append(sent, job.message.text)
+				return nil
+			}
+			d := &dispatcher{}
+			s, err := newSpool(dir, 0, send, d.retryable, newDeadLetterWriter(letters))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, job := range tt.jobs {
+				if err := s.write(job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s.retry()
+
+			if !slices.Equal(sent, tt.wantSent) {
+				t.Errorf("sent %v, want %v", sent, tt.wantSent)
+			}
+			if left := len(spoolFiles(t, dir)); left != tt.wantLeft {
+				t.Errorf("%d messages left in the spool, want %d", left, tt.wantLeft)
+			}
+			content, _ := os.ReadFile(letters)
+			if n := strings.Count(string(content), "\n"); n != tt.wantLetter {
+				t.Errorf("%d dead letters, want %d", n, tt.wantLetter)
+			}
+		})
+	}
+}
+
+func TestSpoolKeepsAttachment(t *testing.T) {
+	dir := t.TempDir()
+	var got delivery
+	s, err := newSpool(dir, 0, func(_ context.Context, job delivery) error {
+		got = job
+		return nil
+	}, func(error) bool { return true }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := delivery{
+		message: outgoingMessage{
+			text:     "text",
+			keyboard: [][]inlineKeyboardButton{{{Text: "open", URL: "https://example.com"}}},
+			document: &document{name: compactDataFilename, content: []byte(`{"a":1}`)},
+		},
+		raw:       []byte(`{"monitor":{"id":1}}`),
+		chatID:    "5",
+		threadID:  7,
+		monitorID: "1",
+	}
+	if err := s.write(job); err != nil {
+		t.Fatal(err)
+	}
+	s.retry()
+
+	if got.message.document == nil || got.message.document.name != compactDataFilename || string(got.message.document.content) != `{"a":1}` {
+		t.Errorf("document = %+v, want the spooled attachment", got.message.document)
+	}
+	if string(got.raw) != string(job.raw) || got.chatID != "5" || got.threadID != 7 || len(got.message.keyboard) != 1 {
+		t.Errorf("replayed job = %+v, want %+v", got, job)
+	}
+}
+
+func TestDeadLetterSpoolsRetryableErrorsOnly(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantSpool bool
+	}{
+		{name: "server error", err: errUnavailable, wantSpool: true},
+		{name: "rate limited", err: &telegramAPIError{statusCode: http.StatusTooManyRequests}, wantSpool: true},
+		{name: "network error", err: errors.New("connection refused"), wantSpool: true},
+		{name: "chat not found", err: errChatNotFound},
+		{name: "bot blocked", err: &telegramAPIError{statusCode: http.StatusForbidden, description: "Forbidden: bot was blocked by the user"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := &dispatcher{}
+			s, err := newSpool(dir, 0, nil, d.retryable, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.spool = s
+			d.deadLetter(delivery{message: outgoingMessage{text: "a"}}, tt.err)
+			if spooled := len(spoolFiles(t, dir)) == 1; spooled != tt.wantSpool {
+				t.Errorf("spooled = %v, want %v", spooled, tt.wantSpool)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// monitorState is what is remembered about a single monitor between
+// notifications.
+type monitorState struct {
+	DownSince       time.Time `json:"down_since,omitzero"`
+	PinnedMessageID int64     `json:"pinned_message_id,omitempty"`
+	AckedAt         time.Time `json:"acked_at,omitzero"`
+	// Up is set when the last heartbeat seen was UP.
+	Up bool `json:"up,omitempty"`
+}
+
+func (s monitorState) empty() bool {
+	return s == monitorState{}
+}
+
+// stateStore keeps monitorState values by monitor ID.
+type stateStore interface {
+	get(monitorID string) (monitorState, bool)
+	set(monitorID string, state monitorState) error
+	delete(monitorID string) error
+	// flush writes any buffered state to durable storage.
+	flush() error
+}
+
+// memoryStateStore is a stateStore that forgets everything on restart.
+type memoryStateStore struct {
+	mu     sync.RWMutex
+	states map[string]monitorState
+}
+
+func newMemoryStateStore() *memoryStateStore {
+	return &memoryStateStore{states: make(map[string]monitorState)}
+}
+
+func (s *memoryStateStore) get(monitorID string) (monitorState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[monitorID]
+	return state, ok
+}
+
+func (s *memoryStateStore) set(monitorID string, state monitorState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[monitorID] = state
+	return nil
+}
+
+func (s *memoryStateStore) delete(monitorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, monitorID)
+	return nil
+}
+
+func (s *memoryStateStore) flush() error { return nil }
+
+// snapshot returns a copy of every stored state.
+func (s *memoryStateStore) snapshot() map[string]monitorState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	states := make(map[string]monitorState, len(s.states))
+	for id, state := range s.states {
+		states[id] = state
+	}
+	return states
+}
+
+// fileStateStore is a stateStore persisted as a JSON file that is rewritten
+// after every change, so tracking survives restarts.
+type fileStateStore struct {
+	*memoryStateStore
+	path string
+
+	saveMu sync.Mutex
+}
+
+// newFileStateStore loads the state saved at path. A missing or unreadable
+// file is logged and the store starts empty rather than failing startup.
+func newFileStateStore(path string) *fileStateStore {
+	store := &fileStateStore{memoryStateStore: newMemoryStateStore(), path: path}
+
+	content, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		slog.Warn("failed to read state file, starting empty", "path", path, "error", err)
+	default:
+		if err := json.Unmarshal(content, &store.states); err != nil {
+			slog.Warn("state file is corrupt, starting empty", "path", path, "error", err)
+			store.states = make(map[string]monitorState)
+		}
+		// A file holding null decodes without error into a nil map.
+		if store.states == nil {
+			store.states = make(map[string]monitorState)
+		}
+	}
+	return store
+}
+
+func (s *fileStateStore) set(monitorID string, state monitorState) error {
+	_ = s.memoryStateStore.set(monitorID, state)
+	return s.flush()
+}
+
+func (s *fileStateStore) delete(monitorID string) error {
+	_ = s.memoryStateStore.delete(monitorID)
+	return s.flush()
+}
+
+// flush atomically replaces the state file with the current state.
+func (s *fileStateStore) flush() error {
+	content, err := json.Marshal(s.snapshot())
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
+
+// monitorStates serializes read-modify-write updates of a stateStore shared
+// by the DOWN and pin trackers.
+type monitorStates struct {
+	mu    sync.Mutex
+	store stateStore
+}
+
+func newMonitorStates(store stateStore) *monitorStates {
+	return &monitorStates{store: store}
+}
+
+// update applies fn to the state of monitorID and returns the state as it was
+// before. Empty states are deleted. Persistence errors are logged only, since
+// losing tracking state must never block an alert.
+func (m *monitorStates) update(monitorID string, fn func(state *monitorState)) monitorState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous, _ := m.store.get(monitorID)
+	state := previous
+	fn(&state)
+
+	var err error
+	switch {
+	case state == previous:
+		return previous
+	case state.empty():
+		err = m.store.delete(monitorID)
+	default:
+		err = m.store.set(monitorID, state)
+	}
+	if err != nil {
+		slog.Warn("failed to save monitor state", "monitor_id", monitorID, "error", err)
+	}
+	return previous
+}
+
+// get returns the current state of monitorID.
+func (m *monitorStates) get(monitorID string) (monitorState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.get(monitorID)
+}
+
+// flush persists the state on shutdown.
+func (m *monitorStates) flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.flush()
+}
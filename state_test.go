@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := newFileStateStore(path)
+	since := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if err := store.set("1", monitorState{DownSince: since, PinnedMessageID: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.set("2", monitorState{PinnedMessageID: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.delete("2"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newFileStateStore(path)
+	if state, ok := reloaded.get("1"); !ok || !state.DownSince.Equal(since) || state.PinnedMessageID != 7 {
+		t.Errorf("state after restart = %+v, %v; want the DOWN with its pinned message", state, ok)
+	}
+	if _, ok := reloaded.get("2"); ok {
+		t.Error("a deleted state came back after restart")
+	}
+}
+
+func TestFileStateStoreStartsEmpty(t *testing.T) {
+	for name, content := range map[string]string{"null": "null", "corrupt": "{not json", "empty": ""} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			store := newFileStateStore(path)
+			if err := store.set("1", monitorState{PinnedMessageID: 7}); err != nil {
+				t.Fatal(err)
+			}
+			if state, ok := store.get("1"); !ok || state.PinnedMessageID != 7 {
+				t.Errorf("get = %+v, %v after set", state, ok)
+			}
+		})
+	}
+	t.Run("missing", func(t *testing.T) {
+		store := newFileStateStore(filepath.Join(t.TempDir(), "missing", "state.json"))
+		if _, ok := store.get("1"); ok {
+			t.Error("a missing file produced state")
+		}
+	})
+}
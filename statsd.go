@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const defaultStatsdPrefix = "uptimekuma_tgbot"
+
+// statsdClient emits StatsD counters and timers over UDP. Sends are fire and
+// forget: a missing or slow collector never delays alerts. A nil client
+// emits nothing.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+}
+
+func newStatsdClient(addr, prefix string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{conn: conn, prefix: prefix}, nil
+}
+
+// count adds value to the counter name.
+func (s *statsdClient) count(name string, value int64) {
+	s.emit(name, fmt.Sprintf("%d|c", value))
+}
+
+// timing records d in milliseconds under name.
+func (s *statsdClient) timing(name string, d time.Duration) {
+	s.emit(name, fmt.Sprintf("%d|ms", d.Milliseconds()))
+}
+
+func (s *statsdClient) emit(name, value string) {
+	if s == nil {
+		return
+	}
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+	_, _ = s.conn.Write([]byte(name + ":" + value))
+}
+
+func (s *statsdClient) close() {
+	if s != nil {
+		s.conn.Close()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// listenStatsd returns a UDP listener standing in for a StatsD collector.
+func listenStatsd(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readPackets returns the next n packets received by conn.
+func readPackets(t *testing.T, conn net.PacketConn, n int) []string {
+	t.Helper()
+	packets := make([]string, 0, n)
+	buf := make([]byte, 512)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(packets) < n {
+		size, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %v: %v", packets, err)
+		}
+		packets = append(packets, string(buf[:size]))
+	}
+	return packets
+}
+
+func TestStatsdDelivery(t *testing.T) {
+	collector := listenStatsd(t)
+	cfg, err := loadConfig(testSettings(map[string]string{"STATSD_ADDR": collector.LocalAddr().String()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := newStatsdClient(cfg.statsdAddr, cfg.statsdPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.close()
+
+	n := &fakeNotifier{id: notifierTelegram, errs: []error{nil, errUnavailable}}
+	d := &dispatcher{notifiers: []notifier{n}, requestTimeout: time.Second, stats: stats}
+	for range 2 {
+		_, _ = d.deliver(context.Background(), delivery{message: outgoingMessage{text: "hi"}})
+	}
+
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^uptimekuma_tgbot\.telegram\.latency:\d+\|ms$`),
+		regexp.MustCompile(`^uptimekuma_tgbot\.telegram\.sent:1\|c$`),
+		regexp.MustCompile(`^uptimekuma_tgbot\.telegram\.latency:\d+\|ms$`),
+		regexp.MustCompile(`^uptimekuma_tgbot\.telegram\.failed:1\|c$`),
+	}
+	for i, packet := range readPackets(t, collector, len(want)) {
+		if !want[i].MatchString(packet) {
+			t.Errorf("packet %d = %q, want %s", i, packet, want[i])
+		}
+	}
+}
+
+func TestStatsdPrefix(t *testing.T) {
+	collector := listenStatsd(t)
+	stats, err := newStatsdClient(collector.LocalAddr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stats.close()
+	stats.count("webhook.received", 3)
+	stats.timing("slack.latency", 1500*time.Millisecond)
+	got := readPackets(t, collector, 2)
+	if got[0] != "webhook.received:3|c" || got[1] != "slack.latency:1500|ms" {
+		t.Errorf("packets = %q", got)
+	}
+
+	var disabled *statsdClient
+	disabled.count("ignored", 1)
+	disabled.close()
+}
+
+func TestLoadStatsdAddr(t *testing.T) {
+	if _, err := loadConfig(testSettings(map[string]string{"STATSD_ADDR": "localhost"})); err == nil {
+		t.Error("STATSD_ADDR without a port accepted")
+	}
+	cfg, err := loadConfig(testSettings(map[string]string{"STATSD_ADDR": "127.0.0.1:8125", "STATSD_PREFIX": "kuma"}))
+	if err != nil || cfg.statsdPrefix != "kuma" {
+		t.Errorf("prefix %q, error %v; want kuma", cfg.statsdPrefix, err)
+	}
+}
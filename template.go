@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Names of the optional per-event templates a template file may define with
+// {{define "..."}}. When the matching one is missing the file's top-level
+// template is used instead.
+const (
+	templateNameDown = "down"
+	templateNameUp   = "up"
+	templateNameTest = "test"
+)
+
+// templateData is the value message templates are executed with.
+//
+// All string fields are raw (unescaped) values; pass them through the
+// escape, bold or code helpers before writing them into the message.
+type templateData struct {
+	MonitorName   string         // monitor.name, or the fallback described in kumaPayload.displayName
+	Group         string         // group of the monitor, empty outside a group
+	Hostname      string         // monitor.hostname
+	Port          string         // monitor.port, empty when 0
+	Status        string         // DOWN, UP or UNKNOWN
+	StatusEmoji   string         // emoji matching Status
+	Message       string         // top-level msg, falling back to heartbeat.msg
+	HeartbeatMsg  string         // heartbeat.msg
+	Ping          string         // heartbeat.ping in milliseconds
+	LocalDateTime string         // heartbeat.localDateTime
+	Tags          []string       // monitor.tags rendered as "name" or "name:value"
+	IsTest        bool           // true for notifications sent by the Test button
+	Payload       map[string]any // the complete decoded webhook payload
+}
+
+// loadMessageTemplate parses the user supplied message template at path.
+func loadMessageTemplate(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read template %s: %w", path, err)
+	}
+
+	tmpl, err := template.New("message").Funcs(templateFuncs(formatter{})).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// templateFuncs exposes the formatter helpers to templates. Every helper
+// accepts any value so missing payload fields render as empty strings instead
+// of "<no value>".
+func templateFuncs(f formatter) template.FuncMap {
+	return template.FuncMap{
+		"escape":         func(value any) string { return f.escape(templateString(value)) },
+		"escapeMarkdown": func(value any) string { return escapeMarkdown(templateString(value)) },
+		"bold":           func(value any) string { return f.bold(templateString(value)) },
+		"code":           func(value any) string { return f.code(templateString(value)) },
+		"join":           strings.Join,
+	}
+}
+
+func templateString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(value))
+}
+
+// newTemplateData extracts the documented template fields from p. Payload is
+// decoded from raw, the body p came from, since templates may read any field.
+func newTemplateData(p kumaPayload, raw []byte, l messageLabels, defaultMonitorName string) templateData {
+	emoji, status := p.status(l)
+	data := templateData{
+		MonitorName:   p.displayName(defaultMonitorName),
+		Group:         p.group(),
+		Hostname:      string(p.monitor().Hostname),
+		Port:          string(p.monitor().Port),
+		Status:        status,
+		StatusEmoji:   emoji,
+		Message:       p.message(),
+		HeartbeatMsg:  string(p.heartbeat().Msg),
+		Ping:          p.heartbeat().Ping.String(),
+		LocalDateTime: string(p.heartbeat().LocalDateTime),
+		Tags:          p.tags(),
+		IsTest:        p.isTest(),
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data.Payload); err != nil {
+		data.Payload = nil
+	}
+	if data.Port == "0" {
+		data.Port = ""
+	}
+	return data
+}
+
+// renderTemplate executes the template matching the payload's event type with
+// helpers bound to f and returns the trimmed output.
+func renderTemplate(tmpl *template.Template, p kumaPayload, raw []byte, f formatter, l messageLabels, defaultMonitorName string) (string, error) {
+	bound, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	bound = bound.Funcs(templateFuncs(f))
+
+	data := newTemplateData(p, raw, l, defaultMonitorName)
+	name := ""
+	switch {
+	case data.IsTest:
+		name = templateNameTest
+	case data.Status == "DOWN":
+		name = templateNameDown
+	case data.Status == "UP":
+		name = templateNameUp
+	}
+	if name != "" {
+		if named := bound.Lookup(name); named != nil {
+			bound = named
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := bound.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
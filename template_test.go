@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplate writes a message template file and returns its path.
+func writeTemplate(t *testing.T, content string) string {
+	t.Helper()
+	templatePath := filepath.Join(t.TempDir(), "message.tmpl")
+	if err := os.WriteFile(templatePath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return templatePath
+}
+
+func TestTemplateMessage(t *testing.T) {
+	const body = `{"monitor":{"name":"db-1"},"heartbeat":{"status":0,"msg":"timeout (5s)"},"msg":"down"}`
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "helpers", template: `{{.StatusEmoji}} {{bold .MonitorName}} {{escape .HeartbeatMsg}}`, want: "❌ *db\\-1* timeout \\(5s\\)"},
+		{name: "payload map", template: `{{code (index .Payload "msg")}}`, want: "`down`"},
+		// A template that fails while executing falls back to the
+		// built-in layout.
+		{name: "execution error", template: `{{.NoSuchField}}`, want: "`db\\-1`"},
+		{name: "empty output", template: `{{if .IsTest}}test{{end}}`, want: "`db\\-1`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"TEMPLATE_PATH": writeTemplate(t, tt.template)})
+			s.post(body)
+			if texts := s.notifier.texts(); len(texts) != 1 || !strings.Contains(texts[0], tt.want) {
+				t.Errorf("sent %q, want a message containing %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePerEvent(t *testing.T) {
+	templatePath := writeTemplate(t, `default {{.Status}}
+{{define "down"}}down {{.MonitorName}} {{.Hostname}}:{{.Port}} {{join .Tags ","}}{{end}}
+{{define "test"}}test {{.IsTest}}{{end}}`)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "down", body: `{"monitor":{"name":"db","hostname":"db.internal","port":5432,"tags":[{"name":"prod"},{"name":"team","value":"a"}]},"heartbeat":{"status":0}}`, want: "down db db.internal:5432 prod,team:a"},
+		{name: "up without its own template", body: `{"monitor":{"name":"db"},"heartbeat":{"status":1}}`, want: "default UP"},
+		{name: "test", body: `{"msg":"Testing Telegram notification"}`, want: "test true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebhookServer(t, map[string]string{"MESSAGE_TEMPLATE_FILE": templatePath, "MESSAGE_LANGUAGE": "en"})
+			s.post(tt.body)
+			if texts := s.notifier.texts(); len(texts) != 1 || texts[0] != tt.want {
+				t.Errorf("sent %q, want %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateStartupErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "parse error", path: writeTemplate(t, `{{.MonitorName`)},
+		{name: "unknown function", path: writeTemplate(t, `{{shout .MonitorName}}`)},
+		{name: "missing file", path: filepath.Join(t.TempDir(), "missing.tmpl")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(testSettings(map[string]string{"MESSAGE_TEMPLATE_FILE": tt.path}))
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid MESSAGE_TEMPLATE_FILE") {
+				t.Errorf("error = %v, want the template rejected at startup", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heartbeatTimeLayouts are the formats Uptime Kuma uses for heartbeat.time,
+// which is always expressed in UTC.
+var heartbeatTimeLayouts = []string{
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+	time.RFC3339Nano,
+}
+
+// displayTimeLayout matches the format of Uptime Kuma's localDateTime.
+const displayTimeLayout = "2006-01-02 15:04:05"
+
+// parseHeartbeatTime parses a heartbeat.time value as UTC.
+func parseHeartbeatTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range heartbeatTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseLocalDateTime parses a localDateTime value as a wall clock time in
+// location.
+func parseLocalDateTime(value string, location *time.Location) (time.Time, bool) {
+	t, err := time.ParseInLocation(displayTimeLayout, strings.TrimSpace(value), location)
+	return t, err == nil
+}
+
+// parseUTCOffset parses a timezoneOffset such as "+08:00" or "-0530" into a
+// fixed zone.
+func parseUTCOffset(value string) (*time.Location, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			_, offset := t.Zone()
+			return time.FixedZone(value, offset), true
+		}
+	}
+	return nil, false
+}
+
+// relativeTime renders how long ago t was relative to now using the phrases in
+// l, e.g. "3 分钟前". It returns false for times in the future.
+func relativeTime(t, now time.Time, l messageLabels) (string, bool) {
+	elapsed := now.Sub(t)
+	switch {
+	case elapsed < 0:
+		return "", false
+	case elapsed < time.Minute:
+		return l.justNow, true
+	case elapsed < time.Hour:
+		return fmt.Sprintf(l.minutesAgo, int(elapsed/time.Minute)), true
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf(l.hoursAgo, int(elapsed/time.Hour)), true
+	default:
+		return fmt.Sprintf(l.daysAgo, int(elapsed/(24*time.Hour))), true
+	}
+}
+
+// formatDowntime renders d in whole seconds as "1d 2h 3m 4s", leaving out
+// zero units.
+func formatDowntime(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	var parts []string
+	for _, unit := range []struct {
+		suffix  string
+		seconds int64
+	}{{"d", 86400}, {"h", 3600}, {"m", 60}, {"s", 1}} {
+		if seconds >= unit.seconds {
+			parts = append(parts, strconv.FormatInt(seconds/unit.seconds, 10)+unit.suffix)
+			seconds %= unit.seconds
+		}
+	}
+	if len(parts) == 0 {
+		return "0s"
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatDuration renders d like time.Duration.String but without trailing
+// zero units, e.g. "5m" instead of "5m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	en, zh := messageLanguages["en"], messageLanguages["zh"]
+	tests := []struct {
+		ago    time.Duration
+		labels messageLabels
+		want   string
+		wantOK bool
+	}{
+		{ago: 30 * time.Second, labels: en, want: "just now", wantOK: true},
+		{ago: 5*time.Minute + 59*time.Second, labels: en, want: "5 min ago", wantOK: true},
+		{ago: 3 * time.Hour, labels: en, want: "3 h ago", wantOK: true},
+		{ago: 50 * time.Hour, labels: en, want: "2 d ago", wantOK: true},
+		{ago: 2 * time.Minute, labels: zh, want: "2 分钟前", wantOK: true},
+		{ago: -time.Minute, labels: en},
+	}
+	for _, tt := range tests {
+		got, ok := relativeTime(now.Add(-tt.ago), now, tt.labels)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("relativeTime(%s ago) = %q, %v; want %q, %v", tt.ago, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestMessageRelativeTime(t *testing.T) {
+	raw := `{"monitor":{"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 11:55:00.000","localDateTime":"2024-05-01 19:55:00"}}`
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, show := range []bool{false, true} {
+		opts := messageOptions{labels: messageLanguages["en"], showRelativeTime: show, now: now}
+		text, _ := buildTelegramMessage(testPayload(t, raw), []byte(raw), opts)
+		if got := strings.Contains(text, "2024-05-01 19:55:00 (5 min ago)"); got != show {
+			t.Errorf("SHOW_RELATIVE_TIME=%v: relative time shown = %v in\n%s", show, got, text)
+		}
+	}
+}
+
+func TestFormatDowntime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "0s"},
+		{d: 1400 * time.Millisecond, want: "1s"},
+		{d: 90 * time.Second, want: "1m 30s"},
+		{d: 26*time.Hour + 5*time.Second, want: "1d 2h 5s"},
+	}
+	for _, tt := range tests {
+		if got := formatDowntime(tt.d); got != tt.want {
+			t.Errorf("formatDowntime(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeartbeatTime(t *testing.T) {
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, value := range []string{"2024-05-01 10:00:00", " 2024-05-01 10:00:00.000 ", "2024-05-01T12:00:00+02:00"} {
+		if got, ok := parseHeartbeatTime(value); !ok || !got.Equal(want) {
+			t.Errorf("parseHeartbeatTime(%q) = %v, %v; want %v", value, got, ok, want)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "2024-05-01"} {
+		if _, ok := parseHeartbeatTime(value); ok {
+			t.Errorf("parseHeartbeatTime(%q) succeeded", value)
+		}
+	}
+}
+
+func TestParseUTCOffset(t *testing.T) {
+	tests := []struct {
+		value  string
+		offset int // seconds east of UTC
+		ok     bool
+	}{
+		{value: "+08:00", offset: 8 * 3600, ok: true},
+		{value: "-0530", offset: -(5*3600 + 30*60), ok: true},
+		{value: "+02", offset: 2 * 3600, ok: true},
+		{value: "Asia/Shanghai"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		location, ok := parseUTCOffset(tt.value)
+		if ok != tt.ok {
+			t.Errorf("parseUTCOffset(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			continue
+		}
+		if ok {
+			if _, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, location).Zone(); offset != tt.offset {
+				t.Errorf("parseUTCOffset(%q) offset = %d, want %d", tt.value, offset, tt.offset)
+			}
+		}
+	}
+}
+
+func TestDisplayTime(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const zoned = "2006-01-02 15:04:05 MST"
+	tests := []struct {
+		name      string
+		heartbeat string
+		location  *time.Location
+		layout    string
+		want      string
+	}{
+		{name: "UTC time", heartbeat: `{"time":"2024-05-01 10:00:00","localDateTime":"2024-05-01 10:00:00"}`, location: shanghai, want: "2024-05-01 18:00:00"},
+		{name: "layout", heartbeat: `{"time":"2024-05-01 10:00:00.123"}`, location: shanghai, layout: "01-02 15:04", want: "05-01 18:00"},
+		{name: "local time with offset", heartbeat: `{"localDateTime":"2024-05-01 18:00:00","timezoneOffset":"+08:00"}`, location: time.UTC, want: "2024-05-01 10:00:00"},
+		{name: "local time with zone", heartbeat: `{"localDateTime":"2024-07-01 12:00:00","timezone":"Europe/Berlin"}`, location: time.UTC, want: "2024-07-01 10:00:00"},
+		{name: "before spring forward", heartbeat: `{"time":"2024-03-10 06:59:59"}`, location: newYork, layout: zoned, want: "2024-03-10 01:59:59 EST"},
+		{name: "after spring forward", heartbeat: `{"time":"2024-03-10 07:00:00"}`, location: newYork, layout: zoned, want: "2024-03-10 03:00:00 EDT"},
+		{name: "first 1:30 of fall back", heartbeat: `{"time":"2024-11-03 05:30:00"}`, location: newYork, layout: zoned, want: "2024-11-03 01:30:00 EDT"},
+		{name: "second 1:30 of fall back", heartbeat: `{"time":"2024-11-03 06:30:00"}`, location: newYork, layout: zoned, want: "2024-11-03 01:30:00 EST"},
+		{name: "no timezone fields", heartbeat: `{"localDateTime":"2024-05-01 18:00:00"}`, location: time.UTC, want: "2024-05-01 18:00:00"},
+		{name: "unparseable", heartbeat: `{"time":"soon","localDateTime":"around noon","timezoneOffset":"+08:00"}`, location: time.UTC, want: "around noon"},
+		{name: "unknown zone", heartbeat: `{"localDateTime":"2024-05-01 18:00:00","timezone":"Mars/Base"}`, location: time.UTC, want: "2024-05-01 18:00:00"},
+		{name: "not converted", heartbeat: `{"time":"2024-05-01 10:00:00","localDateTime":"2024-05-01 18:00:00"}`, want: "2024-05-01 18:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPayload(t, `{"heartbeat":`+tt.heartbeat+`}`)
+			if got := p.displayTime(tt.location, tt.layout); got != tt.want {
+				t.Errorf("displayTime = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayTimezoneSetting(t *testing.T) {
+	if _, err := loadConfig(testSettings(map[string]string{"DISPLAY_TIMEZONE": "Mars/Base"})); err == nil {
+		t.Error("unknown DISPLAY_TIMEZONE accepted")
+	}
+	s := newWebhookServer(t, map[string]string{"DISPLAY_TIMEZONE": "Asia/Shanghai", "MESSAGE_LANGUAGE": "en"})
+	s.post(`{"monitor":{"name":"db"},"heartbeat":{"status":0,"time":"2024-05-01 10:00:00","localDateTime":"2024-05-01 10:00:00"},"msg":"down"}`)
+	if len(s.notifier.jobs) != 1 || !strings.Contains(s.notifier.jobs[0].message.text, "2024\\-05\\-01 18:00:00") {
+		t.Errorf("sent %q, want the heartbeat time in Shanghai", s.notifier.texts())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// certReloader serves the certificate from TLS_CERT_FILE/TLS_KEY_FILE and
+// reloads it on SIGHUP, so renewed certificates are picked up without a
+// restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the key pair again. The previous certificate stays in use
+// when it fails.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watchSIGHUP reloads the certificate whenever the process receives SIGHUP.
+func (r *certReloader) watchSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := r.reload(); err != nil {
+				slog.Error("failed to reload TLS certificate, keeping the current one", "error", err)
+				continue
+			}
+			slog.Info("reloaded TLS certificate", "file", r.certFile)
+		}
+	}()
+}
+
+// tlsConfig returns the listener configuration serving r's certificate.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+}
+
+// requireClientCertificates makes config reject connections without a client
+// certificate signed by cas. When allowedNames is not empty the certificate's
+// common name or one of its DNS names must also be listed.
+func requireClientCertificates(config *tls.Config, cas *x509.CertPool, allowedNames []string) {
+	config.ClientCAs = cas
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(allowedNames) == 0 {
+		return
+	}
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		cert := state.PeerCertificates[0]
+		for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+			if slices.Contains(allowedNames, name) {
+				return nil
+			}
+		}
+		return fmt.Errorf("client certificate %q is not in TLS_ALLOWED_CLIENT_CNS", cert.Subject.CommonName)
+	}
+}